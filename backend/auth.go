@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"devops-ide/pkg/authtoken"
+	"devops-ide/services"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// defaultAccessPolicy is used unless ACCESS_POLICY_FILE points to another policy
+//
+//go:embed access-policy.json
+var defaultAccessPolicy []byte
+
+// Realm reported in WWW-Authenticate challenges
+const authRealm = "devops-ide"
+
+type contextKey int
+
+const identityKey contextKey = iota
+
+// loadAccessPolicy reads ACCESS_POLICY_FILE, or the built-in policy when it is not set
+func loadAccessPolicy() (*services.AccessPolicy, error) {
+	path := os.Getenv("ACCESS_POLICY_FILE")
+	if path == "" {
+		return services.ParseAccessPolicy(defaultAccessPolicy)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read access policy: %v", err)
+	}
+	return services.ParseAccessPolicy(data)
+}
+
+// newTokenVerifier checks session tokens against the keys the auth service publishes and
+// access tokens against its verify endpoint. AUTH_DEV_HMAC_SECRET additionally accepts
+// HS256 tokens for local development.
+func newTokenVerifier(logger *zap.Logger) *authtoken.Verifier {
+	config := authtoken.Config{
+		Issuer:           getEnv("AUTH_ISSUER", "devops-ide-auth"),
+		Audience:         getEnv("AUTH_AUDIENCE", "devops-ide"),
+		JWKSURL:          getEnv("AUTH_JWKS_URL", "http://localhost:8081/.well-known/jwks.json"),
+		IntrospectionURL: getEnv("AUTH_VERIFY_URL", "http://localhost:8081/auth/verify"),
+		Leeway:           30 * time.Second,
+	}
+	if secret := os.Getenv("AUTH_DEV_HMAC_SECRET"); secret != "" {
+		logger.Warn("Accepting HS256 tokens signed with AUTH_DEV_HMAC_SECRET, do not use in production")
+		config.HMACSecret = []byte(secret)
+	}
+	return authtoken.NewVerifier(config)
+}
+
+// authenticate rejects API requests without a valid bearer token and stores the caller
+// identity in the request context for authorize
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := bearerToken(r)
+		if err != nil {
+			s.challenge(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		if token == "" {
+			s.challenge(w, http.StatusUnauthorized, "", "")
+			return
+		}
+
+		identity, err := s.verifier.Verify(r.Context(), token)
+		if err != nil {
+			s.challenge(w, http.StatusUnauthorized, "invalid_token", err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey, identity)))
+	})
+}
+
+// bearerToken reads the Authorization header. Browsers cannot set headers on websocket
+// and EventSource requests, so those may pass the token as ?access_token= instead.
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" && (websocket.IsWebSocketUpgrade(r) || strings.Contains(r.Header.Get("Accept"), "text/event-stream")) {
+		return r.URL.Query().Get("access_token"), nil
+	}
+	return authtoken.BearerToken(header)
+}
+
+// challenge writes a Bearer challenge as described in RFC 6750, without error details
+// when the request carried no credentials at all
+func (s *Server) challenge(w http.ResponseWriter, status int, code, description string) {
+	if code == "" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", authRealm))
+		s.errorResponse(w, status, "Authentication required")
+		return
+	}
+
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q, error=%q, error_description=%q",
+		authRealm, code, strings.ReplaceAll(description, `"`, `'`)))
+	s.errorResponse(w, status, description)
+}
+
+// identityFromContext returns the caller verified by authenticate
+func identityFromContext(ctx context.Context) *authtoken.Identity {
+	identity, _ := ctx.Value(identityKey).(*authtoken.Identity)
+	return identity
+}
+
+// authorize only runs the handler when the caller's roles grant the permission
+func (s *Server) authorize(permission string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.permitted(w, r, permission) {
+			handler(w, r)
+		}
+	}
+}
+
+// permitted reports whether the caller holds the permission, answering 403 with the
+// missing permission when it does not. Access tokens also need a scope covering it.
+func (s *Server) permitted(w http.ResponseWriter, r *http.Request, permission string) bool {
+	identity := identityFromContext(r.Context())
+	if identity != nil && s.policy.Allows(identity.Roles, permission) && services.ScopesAllow(identity.Scopes, permission) {
+		return true
+	}
+
+	fields := []zap.Field{zap.String("permission", permission), zap.String("path", r.URL.Path)}
+	if identity != nil {
+		fields = append(fields, zap.String("user_id", identity.UserID), zap.Strings("roles", identity.Roles))
+		if len(identity.Scopes) > 0 {
+			fields = append(fields, zap.Strings("scopes", identity.Scopes))
+		}
+	}
+	s.logger.Warn("Permission denied", fields...)
+
+	s.jsonResponse(w, http.StatusForbidden, Response{
+		Error: fmt.Sprintf("Missing permission %s", permission),
+		Data:  map[string]string{"permission": permission},
+	})
+	return false
+}
+
+// getPermissionsHandler returns the caller's roles and what they grant, so the IDE can
+// hide actions the user may not run
+func (s *Server) getPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	identity := identityFromContext(r.Context())
+
+	commands := make(map[string]bool)
+	for _, command := range s.devopsHelper.GetAvailableCommands() {
+		permission := s.policy.CommandPermission(command.Name)
+		commands[command.Name] = s.policy.Allows(identity.Roles, permission) && services.ScopesAllow(identity.Scopes, permission)
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Data: map[string]interface{}{
+		"identity":    identity,
+		"permissions": s.policy.Permissions(identity.Roles),
+		"commands":    commands,
+	}})
+}
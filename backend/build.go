@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"devops-ide/services"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"go.uber.org/zap"
+)
+
+// BuildImageRequest describes an image build from a directory of the file-service workspace
+type BuildImageRequest struct {
+	Context    string            `json:"context"`
+	Dockerfile string            `json:"dockerfile"`
+	Tags       []string          `json:"tags"`
+	BuildArgs  map[string]string `json:"buildArgs"`
+	Target     string            `json:"target"`
+	Labels     map[string]string `json:"labels"`
+	Platform   string            `json:"platform"`
+	NoCache    bool              `json:"noCache"`
+	Pull       bool              `json:"pull"`
+	Scan       bool              `json:"scan"`
+}
+
+// BuildResult is the payload of the result event sent once the image is built
+type BuildResult struct {
+	ImageID string   `json:"imageId"`
+	Tags    []string `json:"tags"`
+}
+
+// buildImageHandler builds an image with BuildKit and streams build events as newline
+// delimited JSON. When scan is set the built image is scanned with Trivy and checked
+// against the configured scan policy. An image violating the policy is removed and the
+// build fails.
+func (s *Server) buildImageHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+	trivy, ok := s.trivy(w, r)
+	if !ok {
+		return
+	}
+
+	var req BuildImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	contextDir, err := s.workspaceDir(req.Context)
+	if err != nil && !os.IsNotExist(err) {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if info, err := os.Stat(contextDir); err != nil || !info.IsDir() {
+		s.errorResponse(w, http.StatusNotFound, "Build context not found in workspace")
+		return
+	}
+
+	if req.Dockerfile == "" {
+		req.Dockerfile = "Dockerfile"
+	}
+	dockerfile := filepath.ToSlash(filepath.Clean(req.Dockerfile))
+	if filepath.IsAbs(dockerfile) || dockerfile == ".." || strings.HasPrefix(dockerfile, "../") {
+		s.errorResponse(w, http.StatusBadRequest, "Dockerfile must be inside the build context")
+		return
+	}
+	if _, err := os.Stat(filepath.Join(contextDir, filepath.FromSlash(dockerfile))); err != nil {
+		s.errorResponse(w, http.StatusNotFound, "Dockerfile not found in build context")
+		return
+	}
+
+	excludes, err := services.ReadDockerignore(contextDir)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	buildArgs := make(map[string]*string, len(req.BuildArgs))
+	for key, value := range req.BuildArgs {
+		value := value
+		buildArgs[key] = &value
+	}
+
+	// The context is streamed to the daemon while it is being archived
+	buildContext, err := services.BuildContext(contextDir, excludes, dockerfile, ".dockerignore")
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer buildContext.Close()
+
+	ctx := r.Context()
+	response, err := docker.ImageBuild(ctx, buildContext, types.ImageBuildOptions{
+		Tags:        req.Tags,
+		Dockerfile:  dockerfile,
+		BuildArgs:   buildArgs,
+		Target:      req.Target,
+		Labels:      req.Labels,
+		Platform:    req.Platform,
+		NoCache:     req.NoCache,
+		PullParent:  req.Pull,
+		Remove:      true,
+		ForceRemove: true,
+		Version:     types.BuilderBuildKit,
+	})
+	if err != nil {
+		s.logger.Error("Failed to start image build", zap.Error(err), zap.String("context", req.Context))
+		s.errorResponse(w, dockerErrorStatus(err), fmt.Sprintf("Failed to start image build: %v", err))
+		return
+	}
+	defer response.Body.Close()
+
+	controller := http.NewResponseController(w)
+	// Builds routinely outlast the server WriteTimeout
+	controller.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	emit := func(event services.BuildEvent) bool {
+		if err := encoder.Encode(event); err != nil {
+			return false
+		}
+		controller.Flush()
+		return true
+	}
+
+	s.logger.Info("Image build started", zap.String("context", req.Context), zap.Strings("tags", req.Tags))
+
+	imageID, err := s.relayBuildOutput(response.Body, emit)
+	if err != nil {
+		s.logger.Error("Image build failed", zap.Error(err), zap.String("context", req.Context))
+		emit(services.BuildEvent{Type: services.BuildEventError, Error: err.Error()})
+		return
+	}
+
+	if !emit(services.BuildEvent{Type: services.BuildEventResult, Data: BuildResult{ImageID: imageID, Tags: req.Tags}}) {
+		return
+	}
+	s.logger.Info("Image build completed", zap.String("image_id", imageID), zap.Strings("tags", req.Tags))
+
+	if !req.Scan {
+		return
+	}
+
+	// Scan by tag where possible so Trivy reports the image by name
+	target := imageID
+	if len(req.Tags) > 0 {
+		target = req.Tags[0]
+	}
+
+	summary, err := trivy.ScanImage(target)
+	if err != nil {
+		s.logger.Error("Failed to scan built image", zap.Error(err), zap.String("image", target))
+		summary = &services.ScanSummary{Target: target, ScanType: "image", Message: err.Error(), Timestamp: time.Now()}
+	}
+
+	result := trivy.Policy.Evaluate(summary)
+	emit(services.BuildEvent{Type: services.BuildEventScan, Data: summary})
+	emit(services.BuildEvent{Type: services.BuildEventPolicy, Data: result})
+	if result.Passed {
+		return
+	}
+
+	// The image must not be used, so it is removed even when the client has gone away
+	s.logger.Warn("Built image violates the scan policy", zap.String("image_id", imageID), zap.Strings("violations", result.Violations))
+	message := fmt.Sprintf("image violates the scan policy: %s", strings.Join(result.Violations, "; "))
+	if _, err := docker.ImageRemove(context.WithoutCancel(ctx), imageID, types.ImageRemoveOptions{Force: true, PruneChildren: true}); err != nil {
+		s.logger.Error("Failed to remove image violating the scan policy", zap.Error(err), zap.String("image_id", imageID))
+		message += fmt.Sprintf(", and removing it failed: %v", err)
+	}
+	emit(services.BuildEvent{Type: services.BuildEventError, Error: message})
+}
+
+// relayBuildOutput translates the daemon's build stream into build events and returns
+// the ID of the built image, or the error reported by the build
+func (s *Server) relayBuildOutput(body io.Reader, emit func(services.BuildEvent) bool) (string, error) {
+	decoder := json.NewDecoder(body)
+	var imageID string
+
+	for {
+		var message jsonmessage.JSONMessage
+		if err := decoder.Decode(&message); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return "", err
+		}
+
+		if message.Error != nil {
+			return "", message.Error
+		}
+
+		switch {
+		case message.ID == "moby.buildkit.trace" && message.Aux != nil:
+			var trace []byte
+			if err := json.Unmarshal(*message.Aux, &trace); err != nil {
+				return "", err
+			}
+
+			events, err := services.DecodeBuildTrace(trace)
+			if err != nil {
+				s.logger.Warn("Failed to decode BuildKit trace", zap.Error(err))
+			}
+			for _, event := range events {
+				if !emit(event) {
+					return "", fmt.Errorf("client disconnected")
+				}
+			}
+		case message.ID == "moby.image.id" && message.Aux != nil:
+			var result types.BuildResult
+			if err := json.Unmarshal(*message.Aux, &result); err != nil {
+				return "", err
+			}
+			imageID = result.ID
+		case message.Stream != "":
+			if !emit(services.BuildEvent{Type: services.BuildEventLog, Stream: 1, Message: message.Stream}) {
+				return "", fmt.Errorf("client disconnected")
+			}
+		}
+	}
+
+	if imageID == "" {
+		return "", fmt.Errorf("build finished without producing an image")
+	}
+	return imageID, nil
+}
+
+// workspaceDir resolves a relative path inside the file-service workspace. Symlinks are
+// followed before the check, so a link in a cloned repository cannot point outside it.
+// A missing path fails with an error os.IsNotExist recognizes.
+func (s *Server) workspaceDir(rel string) (string, error) {
+	root, err := filepath.EvalSymlinks(s.workspacePath)
+	if err != nil {
+		return "", fmt.Errorf("workspace is not available: %v", err)
+	}
+
+	dir := filepath.Join(root, filepath.FromSlash(rel))
+	if !withinDir(root, dir) {
+		return "", fmt.Errorf("path %q is outside the workspace", rel)
+	}
+
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	if !withinDir(root, resolved) {
+		return "", fmt.Errorf("path %q is outside the workspace", rel)
+	}
+	return resolved, nil
+}
+
+// withinDir reports whether path is dir or below it, both cleaned
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"devops-ide/services"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// ComposeRequest identifies a compose file in the workspace and what to do with the project
+type ComposeRequest struct {
+	File     string   `json:"file"`
+	Project  string   `json:"project"`
+	Services []string `json:"services"`
+	Build    bool     `json:"build"`
+	Volumes  bool     `json:"volumes"`
+	Service  string   `json:"service"`
+	Replicas int      `json:"replicas"`
+}
+
+// ComposeProjectStatus groups the containers of a Compose project by service
+type ComposeProjectStatus struct {
+	Name        string                 `json:"name"`
+	WorkingDir  string                 `json:"workingDir,omitempty"`
+	ConfigFiles string                 `json:"configFiles,omitempty"`
+	Running     int                    `json:"running"`
+	Total       int                    `json:"total"`
+	Services    []ComposeServiceStatus `json:"services"`
+}
+
+// ComposeServiceStatus lists the containers running a Compose service
+type ComposeServiceStatus struct {
+	Name       string      `json:"name"`
+	Running    int         `json:"running"`
+	Total      int         `json:"total"`
+	Containers []Container `json:"containers"`
+}
+
+// getComposeProjectsHandler lists Compose projects found through the labels Compose puts on containers
+func (s *Server) getComposeProjectsHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	args := filters.NewArgs(filters.Arg("label", services.ComposeProjectLabel))
+	containers, err := docker.ContainerList(r.Context(), types.ContainerListOptions{All: true, Filters: args})
+	if err != nil {
+		s.logger.Error("Failed to list compose containers", zap.Error(err))
+		s.errorResponse(w, dockerErrorStatus(err), "Failed to list compose projects")
+		return
+	}
+
+	projects := make(map[string]*ComposeProjectStatus)
+	serviceIndex := make(map[string]map[string]int)
+
+	for _, c := range containers {
+		name := c.Labels[services.ComposeProjectLabel]
+		project, ok := projects[name]
+		if !ok {
+			project = &ComposeProjectStatus{
+				Name:        name,
+				WorkingDir:  c.Labels[services.ComposeWorkingDirLabel],
+				ConfigFiles: c.Labels[services.ComposeConfigFilesLabel],
+			}
+			projects[name] = project
+			serviceIndex[name] = make(map[string]int)
+		}
+
+		serviceName := c.Labels[services.ComposeServiceLabel]
+		index, ok := serviceIndex[name][serviceName]
+		if !ok {
+			index = len(project.Services)
+			serviceIndex[name][serviceName] = index
+			project.Services = append(project.Services, ComposeServiceStatus{Name: serviceName})
+		}
+
+		service := &project.Services[index]
+		service.Containers = append(service.Containers, toContainer(c))
+		service.Total++
+		project.Total++
+		if c.State == "running" {
+			service.Running++
+			project.Running++
+		}
+	}
+
+	result := make([]ComposeProjectStatus, 0, len(projects))
+	for _, project := range projects {
+		sort.Slice(project.Services, func(i, j int) bool {
+			return project.Services[i].Name < project.Services[j].Name
+		})
+		result = append(result, *project)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	s.jsonResponse(w, http.StatusOK, Response{Data: result})
+}
+
+// composeConfigHandler parses a compose file from the workspace
+func (s *Server) composeConfigHandler(w http.ResponseWriter, r *http.Request) {
+	compose, ok := s.compose(w, r)
+	if !ok {
+		return
+	}
+
+	var req ComposeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	file, ok := s.composeFile(w, req.File)
+	if !ok {
+		return
+	}
+
+	project, err := compose.Config(r.Context(), file, req.Project)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Data: project})
+}
+
+func (s *Server) composeUpHandler(w http.ResponseWriter, r *http.Request) {
+	compose, ok := s.compose(w, r)
+	if !ok {
+		return
+	}
+
+	var req ComposeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	file, ok := s.composeFile(w, req.File)
+	if !ok {
+		return
+	}
+
+	project := mux.Vars(r)["project"]
+	s.runComposeCommand(w, r, fmt.Sprintf("Project %s is up", project), func(ctx context.Context) (string, error) {
+		return compose.Up(ctx, file, project, req.Services, req.Build)
+	})
+}
+
+func (s *Server) composeDownHandler(w http.ResponseWriter, r *http.Request) {
+	compose, ok := s.compose(w, r)
+	if !ok {
+		return
+	}
+
+	var req ComposeRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	// The compose file is optional, Compose finds the project containers by label
+	var file string
+	if req.File != "" {
+		var ok bool
+		if file, ok = s.composeFile(w, req.File); !ok {
+			return
+		}
+	}
+
+	project := mux.Vars(r)["project"]
+	s.runComposeCommand(w, r, fmt.Sprintf("Project %s is down", project), func(ctx context.Context) (string, error) {
+		return compose.Down(ctx, file, project, req.Volumes)
+	})
+}
+
+func (s *Server) composeScaleHandler(w http.ResponseWriter, r *http.Request) {
+	compose, ok := s.compose(w, r)
+	if !ok {
+		return
+	}
+
+	var req ComposeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Service == "" {
+		s.errorResponse(w, http.StatusBadRequest, "A service and replica count are required")
+		return
+	}
+
+	file, ok := s.composeFile(w, req.File)
+	if !ok {
+		return
+	}
+
+	project := mux.Vars(r)["project"]
+	message := fmt.Sprintf("Service %s scaled to %d", req.Service, req.Replicas)
+	s.runComposeCommand(w, r, message, func(ctx context.Context) (string, error) {
+		return compose.Scale(ctx, file, project, req.Service, req.Replicas)
+	})
+}
+
+// runComposeCommand runs a compose operation to completion and returns its output. Pulls
+// and builds can take minutes, so the write deadline is lifted and a client disconnect
+// does not interrupt Compose halfway through.
+func (s *Server) runComposeCommand(w http.ResponseWriter, r *http.Request, message string, run func(ctx context.Context) (string, error)) {
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	output, err := run(context.WithoutCancel(r.Context()))
+	if errors.Is(err, services.ErrUnknownComposeService) {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		s.errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{
+		Message: message,
+		Data:    map[string]string{"output": output},
+	})
+}
+
+// compose returns the Compose service pointed at the Docker endpoint selected for the request
+func (s *Server) compose(w http.ResponseWriter, r *http.Request) (*services.ComposeService, bool) {
+	name := dockerEndpointName(r)
+	env, err := s.devopsHelper.Docker.Env(name)
+	if err != nil {
+		s.dockerEndpointUnavailable(w, name)
+		return nil, false
+	}
+
+	compose := *s.devopsHelper.Compose
+	compose.Env = append(append([]string(nil), compose.Env...), env...)
+	return &compose, true
+}
+
+// composeFile resolves a compose file inside the workspace, writing the error response if it is missing
+func (s *Server) composeFile(w http.ResponseWriter, rel string) (string, bool) {
+	if rel == "" {
+		s.errorResponse(w, http.StatusBadRequest, "A compose file is required")
+		return "", false
+	}
+
+	file, err := s.workspaceDir(rel)
+	if err != nil && !os.IsNotExist(err) {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+
+	if info, err := os.Stat(file); err != nil || info.IsDir() {
+		s.errorResponse(w, http.StatusNotFound, "Compose file not found in workspace")
+		return "", false
+	}
+
+	return file, true
+}
+
+// getComposeLogsHandler streams the logs of every container in a project, or of one
+// service with ?service=, prefixed with the container name like docker compose logs.
+// It accepts the same query parameters as the container logs endpoint.
+func (s *Server) getComposeLogsHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	project := mux.Vars(r)["project"]
+
+	req, err := parseLogRequest(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	args := filters.NewArgs(filters.Arg("label", services.ComposeProjectLabel+"="+project))
+	if service := r.URL.Query().Get("service"); service != "" {
+		args.Add("label", services.ComposeServiceLabel+"="+service)
+	}
+
+	ctx := r.Context()
+	containers, err := docker.ContainerList(ctx, types.ContainerListOptions{All: true, Filters: args})
+	if err != nil {
+		s.logger.Error("Failed to list compose containers", zap.Error(err), zap.String("project", project))
+		s.errorResponse(w, dockerErrorStatus(err), "Failed to list project containers")
+		return
+	}
+
+	if len(containers) == 0 {
+		s.errorResponse(w, http.StatusNotFound, "Compose project not found")
+		return
+	}
+
+	lines := make(chan logLine, 64)
+	var wg sync.WaitGroup
+
+	for _, c := range containers {
+		inspect, err := docker.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			s.logger.Warn("Failed to inspect compose container", zap.Error(err), zap.String("container_id", c.ID))
+			continue
+		}
+
+		logs, err := docker.ContainerLogs(ctx, c.ID, req.options)
+		if err != nil {
+			s.logger.Warn("Failed to get compose container logs", zap.Error(err), zap.String("container_id", c.ID))
+			continue
+		}
+
+		prefix := strings.TrimPrefix(inspect.Name, "/") + " | "
+		containerLines := make(chan logLine, 64)
+		go demultiplexLogs(ctx, logs, inspect.Config != nil && inspect.Config.Tty, containerLines)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer logs.Close()
+
+			for line := range containerLines {
+				line.Text = prefix + line.Text
+				select {
+				case lines <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+
+	s.writeLogStream(w, r, req, lines)
+}
@@ -0,0 +1,539 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/go-connections/nat"
+	"github.com/docker/go-units"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// CreateContainerRequest describes a container to create from an image
+type CreateContainerRequest struct {
+	Name          string            `json:"name"`
+	Image         string            `json:"image"`
+	Cmd           []string          `json:"cmd"`
+	Env           map[string]string `json:"env"`
+	Ports         []string          `json:"ports"`
+	Mounts        []MountRequest    `json:"mounts"`
+	Network       string            `json:"network"`
+	Labels        map[string]string `json:"labels"`
+	Memory        string            `json:"memory"`
+	CPUs          float64           `json:"cpus"`
+	RestartPolicy string            `json:"restartPolicy"`
+	Start         bool              `json:"start"`
+}
+
+// MountRequest describes a bind mount or named volume attached to a new container
+type MountRequest struct {
+	Type     string `json:"type"`
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"readOnly"`
+}
+
+// dockerErrorStatus maps Docker engine errors onto HTTP status codes
+func dockerErrorStatus(err error) int {
+	switch {
+	case errdefs.IsNotFound(err):
+		return http.StatusNotFound
+	case errdefs.IsConflict(err):
+		return http.StatusConflict
+	case errdefs.IsForbidden(err):
+		return http.StatusForbidden
+	case errdefs.IsInvalidParameter(err):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// queryFilters builds Docker list filters from the given query parameters
+func queryFilters(r *http.Request, keys ...string) filters.Args {
+	args := filters.NewArgs()
+	query := r.URL.Query()
+	for _, key := range keys {
+		for _, value := range query[key] {
+			args.Add(key, value)
+		}
+	}
+	return args
+}
+
+// toContainer converts a container list entry into the API representation
+func toContainer(c types.Container) Container {
+	container := Container{
+		ID:      c.ID[:12],
+		Name:    c.Names[0],
+		Image:   c.Image,
+		Status:  c.Status,
+		State:   c.State,
+		Created: c.Created,
+		Command: c.Command,
+		Labels:  c.Labels,
+		Ports:   make([]string, 0, len(c.Ports)),
+		Health:  healthFromStatus(c.Status),
+	}
+
+	for _, p := range c.Ports {
+		container.Ports = append(container.Ports, formatPort(p))
+	}
+
+	return container
+}
+
+// healthFromStatus reads the health state Docker appends to the list status, e.g.
+// "Up 2 minutes (healthy)" or "Up 3 seconds (health: starting)", so listing does not
+// need an inspect call per container. Containers without a healthcheck have none.
+func healthFromStatus(status string) string {
+	switch {
+	case strings.HasSuffix(status, "(healthy)"):
+		return "healthy"
+	case strings.HasSuffix(status, "(unhealthy)"):
+		return "unhealthy"
+	case strings.HasSuffix(status, "(health: starting)"):
+		return "starting"
+	default:
+		return ""
+	}
+}
+
+// formatPort renders a port the way docker ps does, e.g. 0.0.0.0:8080->80/tcp
+func formatPort(p types.Port) string {
+	if p.PublicPort == 0 {
+		return fmt.Sprintf("%d/%s", p.PrivatePort, p.Type)
+	}
+	return fmt.Sprintf("%s:%d->%d/%s", p.IP, p.PublicPort, p.PrivatePort, p.Type)
+}
+
+// dockerEndpointName returns the Docker endpoint selected with ?endpoint= or the
+// X-Docker-Endpoint header, empty for the default endpoint
+func dockerEndpointName(r *http.Request) string {
+	if name := r.URL.Query().Get("endpoint"); name != "" {
+		return name
+	}
+	return r.Header.Get("X-Docker-Endpoint")
+}
+
+// docker returns the client of the Docker endpoint selected for the request, writing
+// the error response when the endpoint is unknown
+func (s *Server) docker(w http.ResponseWriter, r *http.Request) (*client.Client, bool) {
+	name := dockerEndpointName(r)
+	docker, err := s.devopsHelper.Docker.Client(name)
+	if err != nil {
+		s.dockerEndpointUnavailable(w, name)
+		return nil, false
+	}
+	return docker, true
+}
+
+// dockerEndpointUnavailable writes a 503 response when the default endpoint is missing,
+// like before endpoints could be named, and a 404 for an unknown named endpoint
+func (s *Server) dockerEndpointUnavailable(w http.ResponseWriter, name string) {
+	if name == "" {
+		s.errorResponse(w, http.StatusServiceUnavailable, "Docker client not available")
+		return
+	}
+	s.errorResponse(w, http.StatusNotFound, fmt.Sprintf("Docker endpoint not found: %s", name))
+}
+
+// getContainersHandler lists containers with a single list call. It filters on status,
+// label, name, health and image (matching descendants like docker ps --filter ancestor),
+// sorts with sort=name|image|state|created and order=asc|desc (newest first by default)
+// and paginates with page and limit when a limit is given.
+func (s *Server) getContainersHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+
+	args := queryFilters(r, "status", "label", "name", "health")
+	for _, image := range query["image"] {
+		args.Add("ancestor", image)
+	}
+
+	less, err := containerOrder(query.Get("sort"), query.Get("order"))
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	containers, err := docker.ContainerList(r.Context(), types.ContainerListOptions{
+		All:     query.Get("all") != "false",
+		Filters: args,
+	})
+	if err != nil {
+		s.logger.Error("Failed to list containers", zap.Error(err))
+		s.errorResponse(w, dockerErrorStatus(err), "Failed to list containers")
+		return
+	}
+
+	result := make([]Container, 0, len(containers))
+	for _, c := range containers {
+		result = append(result, toContainer(c))
+	}
+	sort.SliceStable(result, func(i, j int) bool { return less(result[i], result[j]) })
+
+	start, end, pagination, err := paginate(r, len(result))
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	result = result[start:end]
+
+	s.jsonResponse(w, http.StatusOK, Response{Data: result, Pagination: pagination})
+}
+
+// containerOrder returns the comparison used to sort the container list
+func containerOrder(field, order string) (func(a, b Container) bool, error) {
+	var less func(a, b Container) bool
+	switch field {
+	case "", "created":
+		less = func(a, b Container) bool { return a.Created < b.Created }
+		if order == "" {
+			order = "desc"
+		}
+	case "name":
+		less = func(a, b Container) bool { return a.Name < b.Name }
+	case "image":
+		less = func(a, b Container) bool { return a.Image < b.Image }
+	case "state", "status":
+		less = func(a, b Container) bool { return a.State < b.State }
+	default:
+		return nil, fmt.Errorf("invalid sort field: %s", field)
+	}
+
+	switch order {
+	case "", "asc":
+		return less, nil
+	case "desc":
+		return func(a, b Container) bool { return less(b, a) }, nil
+	default:
+		return nil, fmt.Errorf("invalid sort order: %s", order)
+	}
+}
+
+// paginate reads page (default 1) and limit from the query and returns the bounds of
+// the requested page within total items. Without a limit every item is returned and
+// the pagination is nil.
+func paginate(r *http.Request, total int) (int, int, *Pagination, error) {
+	query := r.URL.Query()
+	if query.Get("limit") == "" {
+		return 0, total, nil, nil
+	}
+
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		return 0, 0, nil, fmt.Errorf("invalid limit")
+	}
+
+	page := 1
+	if value := query.Get("page"); value != "" {
+		if page, err = strconv.Atoi(value); err != nil || page <= 0 {
+			return 0, 0, nil, fmt.Errorf("invalid page")
+		}
+	}
+
+	start := (page - 1) * limit
+	if start > total {
+		start = total
+	}
+	end := start + limit
+	if end > total {
+		end = total
+	}
+
+	return start, end, &Pagination{
+		Page:  page,
+		Limit: limit,
+		Total: total,
+		Pages: (total + limit - 1) / limit,
+	}, nil
+}
+
+func (s *Server) createContainerHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateContainerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	config, hostConfig, networkConfig, err := req.containerConfig()
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+
+	// Pull the image first when it is not available locally. Pulls easily outlast the
+	// server write timeout, so the deadline is lifted for this request.
+	if _, _, err := docker.ImageInspectWithRaw(ctx, req.Image); errdefs.IsNotFound(err) {
+		s.logger.Info("Pulling image for new container", zap.String("image", req.Image))
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		progress, err := docker.ImagePull(ctx, req.Image, types.ImagePullOptions{})
+		if err != nil {
+			s.logger.Error("Failed to pull image", zap.Error(err), zap.String("image", req.Image))
+			s.errorResponse(w, dockerErrorStatus(err), "Failed to pull image")
+			return
+		}
+		_, err = io.Copy(io.Discard, progress)
+		progress.Close()
+		if err != nil {
+			s.logger.Error("Failed to pull image", zap.Error(err), zap.String("image", req.Image))
+			s.errorResponse(w, http.StatusInternalServerError, "Failed to pull image")
+			return
+		}
+	}
+
+	created, err := docker.ContainerCreate(ctx, config, hostConfig, networkConfig, nil, req.Name)
+	if err != nil {
+		s.logger.Error("Failed to create container", zap.Error(err), zap.String("image", req.Image))
+		s.errorResponse(w, dockerErrorStatus(err), fmt.Sprintf("Failed to create container: %v", err))
+		return
+	}
+
+	if req.Start {
+		if err := docker.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+			s.logger.Error("Failed to start container", zap.Error(err), zap.String("container_id", created.ID))
+			s.jsonResponse(w, http.StatusCreated, Response{
+				Message: "Container created but failed to start",
+				Data:    created,
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	s.jsonResponse(w, http.StatusCreated, Response{Message: "Container created successfully", Data: created})
+}
+
+// containerConfig translates the request into the Docker engine create parameters
+func (req *CreateContainerRequest) containerConfig() (*container.Config, *container.HostConfig, *network.NetworkingConfig, error) {
+	if req.Image == "" {
+		return nil, nil, nil, fmt.Errorf("image is required")
+	}
+
+	config := &container.Config{
+		Image:  req.Image,
+		Cmd:    req.Cmd,
+		Labels: req.Labels,
+	}
+
+	for key, value := range req.Env {
+		config.Env = append(config.Env, key+"="+value)
+	}
+	sort.Strings(config.Env)
+
+	exposedPorts, portBindings, err := nat.ParsePortSpecs(req.Ports)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid port mapping: %v", err)
+	}
+	config.ExposedPorts = exposedPorts
+
+	hostConfig := &container.HostConfig{
+		PortBindings:  portBindings,
+		RestartPolicy: container.RestartPolicy{Name: req.RestartPolicy},
+	}
+
+	for _, m := range req.Mounts {
+		if m.Target == "" {
+			return nil, nil, nil, fmt.Errorf("mount target is required")
+		}
+
+		mountType := mount.Type(m.Type)
+		if mountType == "" {
+			// Absolute host paths are bind mounts, anything else names a volume
+			mountType = mount.TypeVolume
+			if filepath.IsAbs(m.Source) {
+				mountType = mount.TypeBind
+			}
+		}
+
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+			Type:     mountType,
+			Source:   m.Source,
+			Target:   m.Target,
+			ReadOnly: m.ReadOnly,
+		})
+	}
+
+	if req.Memory != "" {
+		memory, err := units.RAMInBytes(req.Memory)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid memory limit: %v", err)
+		}
+		hostConfig.Resources.Memory = memory
+	}
+
+	if req.CPUs < 0 {
+		return nil, nil, nil, fmt.Errorf("invalid cpu limit: %v", req.CPUs)
+	}
+	hostConfig.Resources.NanoCPUs = int64(req.CPUs * 1e9)
+
+	var networkConfig *network.NetworkingConfig
+	if req.Network != "" {
+		hostConfig.NetworkMode = container.NetworkMode(req.Network)
+		networkConfig = &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				req.Network: {},
+			},
+		}
+	}
+
+	return config, hostConfig, networkConfig, nil
+}
+
+func (s *Server) restartContainerHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	options := container.StopOptions{}
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		timeout, err := strconv.Atoi(value)
+		if err != nil {
+			s.errorResponse(w, http.StatusBadRequest, "Invalid timeout")
+			return
+		}
+		options.Timeout = &timeout
+	}
+
+	if err := docker.ContainerRestart(r.Context(), id, options); err != nil {
+		s.logger.Error("Failed to restart container", zap.Error(err), zap.String("container_id", id))
+		s.errorResponse(w, dockerErrorStatus(err), "Failed to restart container")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Message: "Container restarted successfully"})
+}
+
+func (s *Server) pauseContainerHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	if err := docker.ContainerPause(r.Context(), id); err != nil {
+		s.logger.Error("Failed to pause container", zap.Error(err), zap.String("container_id", id))
+		s.errorResponse(w, dockerErrorStatus(err), "Failed to pause container")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Message: "Container paused successfully"})
+}
+
+func (s *Server) unpauseContainerHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	if err := docker.ContainerUnpause(r.Context(), id); err != nil {
+		s.logger.Error("Failed to unpause container", zap.Error(err), zap.String("container_id", id))
+		s.errorResponse(w, dockerErrorStatus(err), "Failed to unpause container")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Message: "Container unpaused successfully"})
+}
+
+func (s *Server) killContainerHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	signal := r.URL.Query().Get("signal")
+	if signal == "" {
+		signal = "SIGKILL"
+	}
+
+	if err := docker.ContainerKill(r.Context(), id, signal); err != nil {
+		s.logger.Error("Failed to kill container", zap.Error(err), zap.String("container_id", id), zap.String("signal", signal))
+		s.errorResponse(w, dockerErrorStatus(err), "Failed to kill container")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Message: fmt.Sprintf("Signal %s sent to container", signal)})
+}
+
+func (s *Server) removeContainerHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	query := r.URL.Query()
+
+	options := types.ContainerRemoveOptions{
+		Force:         query.Get("force") == "true",
+		RemoveVolumes: query.Get("volumes") == "true",
+	}
+
+	if err := docker.ContainerRemove(r.Context(), id, options); err != nil {
+		s.logger.Error("Failed to remove container", zap.Error(err), zap.String("container_id", id))
+		s.errorResponse(w, dockerErrorStatus(err), "Failed to remove container")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Message: "Container removed successfully"})
+}
+
+func (s *Server) renameContainerHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		s.errorResponse(w, http.StatusBadRequest, "A new container name is required")
+		return
+	}
+
+	if err := docker.ContainerRename(r.Context(), id, req.Name); err != nil {
+		s.logger.Error("Failed to rename container", zap.Error(err), zap.String("container_id", id))
+		s.errorResponse(w, dockerErrorStatus(err), "Failed to rename container")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Message: "Container renamed successfully"})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"devops-ide/services"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// getDockerEndpointsHandler lists the configured Docker endpoints with their health
+func (s *Server) getDockerEndpointsHandler(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, http.StatusOK, Response{Data: s.devopsHelper.Docker.Check(r.Context())})
+}
+
+// addDockerEndpointHandler registers or replaces a Docker endpoint at runtime
+func (s *Server) addDockerEndpointHandler(w http.ResponseWriter, r *http.Request) {
+	var req services.DockerEndpointConfig
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := s.devopsHelper.Docker.Add(req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.jsonResponse(w, http.StatusCreated, Response{Message: fmt.Sprintf("Docker endpoint %s registered", req.Name)})
+}
+
+func (s *Server) removeDockerEndpointHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	if err := s.devopsHelper.Docker.Remove(name); err != nil {
+		s.logger.Error("Failed to remove Docker endpoint", zap.Error(err), zap.String("endpoint", name))
+		s.errorResponse(w, dockerEndpointErrorStatus(err), err.Error())
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Message: "Docker endpoint removed successfully"})
+}
+
+// setDefaultDockerEndpointHandler selects the endpoint used when a request names none
+func (s *Server) setDefaultDockerEndpointHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	if err := s.devopsHelper.Docker.SetDefault(name); err != nil {
+		s.errorResponse(w, dockerEndpointErrorStatus(err), err.Error())
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Message: fmt.Sprintf("Docker endpoint %s is now the default", name)})
+}
+
+func dockerEndpointErrorStatus(err error) int {
+	if errors.Is(err, services.ErrUnknownDockerEndpoint) {
+		return http.StatusNotFound
+	}
+	return http.StatusConflict
+}
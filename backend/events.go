@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// Container lifecycle events pushed to the IDE, health_status also matches its
+// "health_status: healthy" style actions
+var containerEventActions = []string{
+	"create", "start", "restart", "stop", "die", "kill", "oom",
+	"pause", "unpause", "destroy", "rename", "health_status",
+}
+
+// StreamMessage is the envelope of messages pushed over the events stream, matching
+// the websocket service's {type, payload, timestamp} format
+type StreamMessage struct {
+	Type      string      `json:"type"`
+	Payload   interface{} `json:"payload"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// ContainerEvent is a container lifecycle change reported by Docker
+type ContainerEvent struct {
+	Action     string            `json:"action"`
+	Status     string            `json:"status,omitempty"`
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Image      string            `json:"image"`
+	ExitCode   string            `json:"exitCode,omitempty"`
+	Attributes map[string]string `json:"attributes"`
+	Time       time.Time         `json:"time"`
+}
+
+// ContainerStats is a resource usage sample of a running container
+type ContainerStats struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	CPUPercent    float64   `json:"cpuPercent"`
+	MemoryUsage   uint64    `json:"memoryUsage"`
+	MemoryLimit   uint64    `json:"memoryLimit"`
+	MemoryPercent float64   `json:"memoryPercent"`
+	NetworkRx     uint64    `json:"networkRx"`
+	NetworkTx     uint64    `json:"networkTx"`
+	BlockRead     uint64    `json:"blockRead"`
+	BlockWrite    uint64    `json:"blockWrite"`
+	PIDs          uint64    `json:"pids"`
+	Time          time.Time `json:"time"`
+}
+
+// containerEventsHandler pushes container lifecycle events, and with ?stats=true live
+// resource usage of running containers, over a websocket or as server-sent events.
+// Repeated ?container= parameters restrict the stream to specific containers.
+func (s *Server) containerEventsHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	messages := make(chan StreamMessage, 64)
+	go s.watchContainers(ctx, docker, messages, r.URL.Query()["container"], r.URL.Query().Get("stats") == "true")
+
+	if websocket.IsWebSocketUpgrade(r) {
+		s.writeEventsWebsocket(w, r, cancel, messages)
+		return
+	}
+	s.writeEventsSSE(w, r, messages)
+}
+
+// watchContainers forwards Docker events and, when enabled, keeps one stats stream per
+// running container, starting and stopping them as containers come and go
+func (s *Server) watchContainers(ctx context.Context, docker *client.Client, messages chan<- StreamMessage, containers []string, withStats bool) {
+	send := func(messageType string, payload interface{}) bool {
+		select {
+		case messages <- StreamMessage{Type: messageType, Payload: payload, Timestamp: time.Now().UTC()}:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	args := filters.NewArgs(filters.Arg("type", string(events.ContainerEventType)))
+	for _, action := range containerEventActions {
+		args.Add("event", action)
+	}
+	for _, container := range containers {
+		args.Add("container", container)
+	}
+
+	// Subscribe before listing containers so no start is missed in between
+	eventStream, errs := docker.Events(ctx, types.EventsOptions{Filters: args})
+
+	stats := make(map[string]context.CancelFunc)
+	startStats := func(id, name string) {
+		if _, ok := stats[id]; ok {
+			return
+		}
+		statsCtx, stop := context.WithCancel(ctx)
+		stats[id] = stop
+		go s.streamContainerStats(statsCtx, docker, id, name, send)
+	}
+	stopStats := func(id string) {
+		if stop, ok := stats[id]; ok {
+			stop()
+			delete(stats, id)
+		}
+	}
+
+	if withStats {
+		listArgs := filters.NewArgs()
+		for _, container := range containers {
+			listArgs.Add("id", container)
+			listArgs.Add("name", container)
+		}
+
+		running, err := docker.ContainerList(ctx, types.ContainerListOptions{Filters: listArgs})
+		if err != nil {
+			s.logger.Error("Failed to list containers for stats", zap.Error(err))
+			send("error", "Failed to list containers for stats")
+		}
+		for _, c := range running {
+			if len(containers) > 0 && !matchesContainer(c, containers) {
+				continue
+			}
+			startStats(c.ID, strings.TrimPrefix(c.Names[0], "/"))
+		}
+	}
+
+	for {
+		select {
+		case event := <-eventStream:
+			action, status, _ := strings.Cut(event.Action, ": ")
+			attributes := event.Actor.Attributes
+
+			if !send("container_event", ContainerEvent{
+				Action:     action,
+				Status:     status,
+				ID:         event.Actor.ID,
+				Name:       attributes["name"],
+				Image:      attributes["image"],
+				ExitCode:   attributes["exitCode"],
+				Attributes: attributes,
+				Time:       time.Unix(0, event.TimeNano).UTC(),
+			}) {
+				return
+			}
+
+			if withStats {
+				switch action {
+				case "start", "unpause":
+					startStats(event.Actor.ID, attributes["name"])
+				case "die", "pause", "destroy":
+					stopStats(event.Actor.ID)
+				}
+			}
+		case err := <-errs:
+			if ctx.Err() == nil {
+				s.logger.Error("Docker events stream failed", zap.Error(err))
+				send("error", fmt.Sprintf("Docker events stream failed: %v", err))
+			}
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// matchesContainer reports whether a listed container is one of the requested IDs or names.
+// The list filters above match either field, so this narrows the OR of both.
+func matchesContainer(c types.Container, containers []string) bool {
+	for _, container := range containers {
+		if strings.HasPrefix(c.ID, container) {
+			return true
+		}
+		for _, name := range c.Names {
+			if strings.TrimPrefix(name, "/") == container {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// streamContainerStats sends a stats sample roughly every second until the container
+// stops or the stream is cancelled
+func (s *Server) streamContainerStats(ctx context.Context, docker *client.Client, id, name string, send func(string, interface{}) bool) {
+	response, err := docker.ContainerStats(ctx, id, true)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Warn("Failed to stream container stats", zap.Error(err), zap.String("container_id", id))
+		}
+		return
+	}
+	defer response.Body.Close()
+
+	decoder := json.NewDecoder(response.Body)
+	for {
+		var sample types.StatsJSON
+		if err := decoder.Decode(&sample); err != nil {
+			return
+		}
+
+		if !send("container_stats", calculateStats(id, name, &sample)) {
+			return
+		}
+	}
+}
+
+// calculateStats derives the figures docker stats shows from a raw sample
+func calculateStats(id, name string, sample *types.StatsJSON) ContainerStats {
+	stats := ContainerStats{
+		ID:          id,
+		Name:        name,
+		MemoryLimit: sample.MemoryStats.Limit,
+		PIDs:        sample.PidsStats.Current,
+		Time:        sample.Read,
+	}
+
+	cpuDelta := float64(sample.CPUStats.CPUUsage.TotalUsage) - float64(sample.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(sample.CPUStats.SystemUsage) - float64(sample.PreCPUStats.SystemUsage)
+	onlineCPUs := float64(sample.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(sample.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		stats.CPUPercent = cpuDelta / systemDelta * onlineCPUs * 100
+	}
+
+	// Page cache is reclaimable, report usage without it like docker stats does
+	stats.MemoryUsage = sample.MemoryStats.Usage
+	cache := sample.MemoryStats.Stats["total_inactive_file"]
+	if cache == 0 {
+		cache = sample.MemoryStats.Stats["inactive_file"]
+	}
+	if cache < stats.MemoryUsage {
+		stats.MemoryUsage -= cache
+	}
+	if stats.MemoryLimit > 0 {
+		stats.MemoryPercent = float64(stats.MemoryUsage) / float64(stats.MemoryLimit) * 100
+	}
+
+	for _, network := range sample.Networks {
+		stats.NetworkRx += network.RxBytes
+		stats.NetworkTx += network.TxBytes
+	}
+
+	for _, entry := range sample.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			stats.BlockRead += entry.Value
+		case "write":
+			stats.BlockWrite += entry.Value
+		}
+	}
+
+	return stats
+}
+
+// writeEventsWebsocket upgrades the connection and writes messages as JSON text frames
+func (s *Server) writeEventsWebsocket(w http.ResponseWriter, r *http.Request, cancel context.CancelFunc, messages <-chan StreamMessage) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.logger.Error("Failed to upgrade events connection", zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	// The client only sends control frames, reading detects when it goes away
+	go func() {
+		defer cancel()
+
+		conn.SetReadDeadline(time.Now().Add(terminalPongWait))
+		conn.SetPongHandler(func(string) error {
+			conn.SetReadDeadline(time.Now().Add(terminalPongWait))
+			return nil
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(terminalPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message := <-messages:
+			conn.SetWriteDeadline(time.Now().Add(terminalWriteWait))
+			if err := conn.WriteJSON(message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(terminalWriteWait)); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEventsSSE writes messages as server-sent events named after the message type
+func (s *Server) writeEventsSSE(w http.ResponseWriter, r *http.Request, messages <-chan StreamMessage) {
+	controller := http.NewResponseController(w)
+	// The stream stays open for as long as the client watches
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		s.logger.Warn("Failed to clear write deadline for events stream", zap.Error(err))
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	controller.Flush()
+
+	heartbeat := time.NewTicker(logHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case message := <-messages:
+			data, err := json.Marshal(message)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", message.Type, data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
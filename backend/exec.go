@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	// Time allowed to write a message to the terminal
+	terminalWriteWait = 10 * time.Second
+
+	// Time allowed between pongs before the terminal is considered gone
+	terminalPongWait = 60 * time.Second
+
+	// Ping period, must be less than terminalPongWait
+	terminalPingPeriod = (terminalPongWait * 9) / 10
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 32 * 1024,
+	CheckOrigin:     checkOrigin,
+}
+
+// TerminalMessage is a control message exchanged with the IDE terminal. Binary
+// frames carry raw terminal bytes; text frames carry these JSON messages.
+type TerminalMessage struct {
+	Type     string `json:"type"`
+	Data     string `json:"data,omitempty"`
+	Cols     uint   `json:"cols,omitempty"`
+	Rows     uint   `json:"rows,omitempty"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+}
+
+// checkOrigin accepts non-browser clients and the origins allowed by CORS
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	for _, allowed := range allowedOrigins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// execContainerHandler opens an interactive TTY session inside a running container.
+// The command defaults to /bin/sh and can be overridden with repeated cmd parameters.
+func (s *Server) execContainerHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	query := r.URL.Query()
+	ctx := r.Context()
+
+	inspect, err := docker.ContainerInspect(ctx, id)
+	if err != nil {
+		s.logger.Error("Failed to inspect container", zap.Error(err), zap.String("container_id", id))
+		s.errorResponse(w, dockerErrorStatus(err), "Container not found")
+		return
+	}
+	if inspect.State == nil || !inspect.State.Running {
+		s.errorResponse(w, http.StatusConflict, "Container is not running")
+		return
+	}
+
+	cmd := query["cmd"]
+	if len(cmd) == 0 {
+		cmd = []string{"/bin/sh"}
+	}
+
+	exec, err := docker.ContainerExecCreate(ctx, id, types.ExecConfig{
+		User:         query.Get("user"),
+		WorkingDir:   query.Get("workdir"),
+		Env:          []string{"TERM=xterm-256color"},
+		Cmd:          cmd,
+		Tty:          true,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		s.logger.Error("Failed to create exec", zap.Error(err), zap.String("container_id", id))
+		s.errorResponse(w, dockerErrorStatus(err), "Failed to create exec session")
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied to the client
+		s.logger.Error("Failed to upgrade terminal connection", zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	attach, err := docker.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{Tty: true})
+	if err != nil {
+		s.logger.Error("Failed to attach exec", zap.Error(err), zap.String("exec_id", exec.ID))
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "Failed to attach exec session"),
+			time.Now().Add(terminalWriteWait))
+		return
+	}
+	// Closing the attach connection hangs up the shell when the terminal goes away
+	defer attach.Close()
+
+	cols, _ := strconv.ParseUint(query.Get("cols"), 10, 32)
+	rows, _ := strconv.ParseUint(query.Get("rows"), 10, 32)
+	s.resizeExec(r, docker, exec.ID, uint(cols), uint(rows))
+
+	s.logger.Info("Terminal session started",
+		zap.String("container_id", id),
+		zap.String("exec_id", exec.ID),
+		zap.Strings("cmd", cmd))
+
+	// Container output to terminal
+	outputDone := make(chan struct{})
+	go func() {
+		defer close(outputDone)
+
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := attach.Reader.Read(buf)
+			if n > 0 {
+				conn.SetWriteDeadline(time.Now().Add(terminalWriteWait))
+				if werr := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// Terminal input to container
+	inputDone := make(chan struct{})
+	go func() {
+		defer close(inputDone)
+
+		conn.SetReadDeadline(time.Now().Add(terminalPongWait))
+		conn.SetPongHandler(func(string) error {
+			conn.SetReadDeadline(time.Now().Add(terminalPongWait))
+			return nil
+		})
+
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if messageType == websocket.BinaryMessage {
+				if _, err := attach.Conn.Write(data); err != nil {
+					return
+				}
+				continue
+			}
+
+			var message TerminalMessage
+			if err := json.Unmarshal(data, &message); err != nil {
+				continue
+			}
+
+			switch message.Type {
+			case "input":
+				if _, err := attach.Conn.Write([]byte(message.Data)); err != nil {
+					return
+				}
+			case "resize":
+				s.resizeExec(r, docker, exec.ID, message.Cols, message.Rows)
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(terminalPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-outputDone:
+			// The process exited, report its exit code before closing
+			exit := TerminalMessage{Type: "exit"}
+			if result, err := docker.ContainerExecInspect(ctx, exec.ID); err == nil {
+				exit.ExitCode = &result.ExitCode
+			}
+
+			conn.SetWriteDeadline(time.Now().Add(terminalWriteWait))
+			conn.WriteJSON(exit)
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				time.Now().Add(terminalWriteWait))
+
+			s.logger.Info("Terminal session ended", zap.String("exec_id", exec.ID))
+			return
+		case <-inputDone:
+			s.logger.Info("Terminal disconnected", zap.String("exec_id", exec.ID))
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(terminalWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// resizeExec applies the terminal size to the exec TTY, ignoring unset dimensions
+func (s *Server) resizeExec(r *http.Request, docker *client.Client, execID string, cols, rows uint) {
+	if cols == 0 || rows == 0 {
+		return
+	}
+
+	err := docker.ContainerExecResize(r.Context(), execID, types.ResizeOptions{
+		Width:  cols,
+		Height: rows,
+	})
+	if err != nil {
+		s.logger.Warn("Failed to resize terminal", zap.Error(err), zap.String("exec_id", execID))
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"devops-ide/services"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// Image is the summary of a local image returned by the image list
+type Image struct {
+	ID         string            `json:"id"`
+	Tags       []string          `json:"tags"`
+	Digests    []string          `json:"digests"`
+	Size       int64             `json:"size"`
+	Created    time.Time         `json:"created"`
+	Containers int64             `json:"containers"`
+	Labels     map[string]string `json:"labels"`
+	ScanURL    string            `json:"scanUrl"`
+}
+
+// RegistryCredentials authenticate pulls and pushes against a registry
+type RegistryCredentials struct {
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identityToken"`
+	ServerAddress string `json:"serverAddress"`
+}
+
+// ImageTransferRequest names the image to pull or push and the registry credentials to use
+type ImageTransferRequest struct {
+	Image string `json:"image"`
+	RegistryCredentials
+}
+
+// registryAuth encodes the credentials for the X-Registry-Auth header
+func (c RegistryCredentials) registryAuth() (string, error) {
+	return registry.EncodeAuthConfig(registry.AuthConfig{
+		Username:      c.Username,
+		Password:      c.Password,
+		IdentityToken: c.IdentityToken,
+		ServerAddress: c.ServerAddress,
+	})
+}
+
+func (s *Server) getImagesHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	images, err := docker.ImageList(r.Context(), types.ImageListOptions{
+		All:     r.URL.Query().Get("all") == "true",
+		Filters: queryFilters(r, "reference", "dangling", "label"),
+	})
+	if err != nil {
+		s.logger.Error("Failed to list images", zap.Error(err))
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to list images")
+		return
+	}
+
+	// Scans run against the endpoint the images were listed from
+	scanQuery := ""
+	if name := dockerEndpointName(r); name != "" {
+		scanQuery = "?endpoint=" + url.QueryEscape(name)
+	}
+
+	result := make([]Image, 0, len(images))
+	for _, img := range images {
+		// Scan by tag where possible so Trivy reports the image by name
+		target := img.ID
+		if len(img.RepoTags) > 0 && img.RepoTags[0] != "<none>:<none>" {
+			target = img.RepoTags[0]
+		}
+
+		result = append(result, Image{
+			ID:         img.ID,
+			Tags:       img.RepoTags,
+			Digests:    img.RepoDigests,
+			Size:       img.Size,
+			Created:    time.Unix(img.Created, 0).UTC(),
+			Containers: img.Containers,
+			Labels:     img.Labels,
+			ScanURL:    "/api/images/" + target + "/scan" + scanQuery,
+		})
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Data: result})
+}
+
+func (s *Server) getImageHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	image, _, err := docker.ImageInspectWithRaw(r.Context(), id)
+	if err != nil {
+		s.logger.Error("Failed to inspect image", zap.Error(err), zap.String("image", id))
+		s.errorResponse(w, dockerErrorStatus(err), "Image not found")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Data: image})
+}
+
+func (s *Server) getImageHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	history, err := docker.ImageHistory(r.Context(), id)
+	if err != nil {
+		s.logger.Error("Failed to get image history", zap.Error(err), zap.String("image", id))
+		s.errorResponse(w, dockerErrorStatus(err), "Failed to get image history")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Data: history})
+}
+
+// pullImageHandler pulls an image and streams Docker's progress messages as newline delimited JSON
+func (s *Server) pullImageHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	var req ImageTransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Image == "" {
+		s.errorResponse(w, http.StatusBadRequest, "An image reference is required")
+		return
+	}
+
+	auth, err := req.registryAuth()
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid registry credentials")
+		return
+	}
+
+	progress, err := docker.ImagePull(r.Context(), req.Image, types.ImagePullOptions{RegistryAuth: auth})
+	if err != nil {
+		s.logger.Error("Failed to pull image", zap.Error(err), zap.String("image", req.Image))
+		s.errorResponse(w, dockerErrorStatus(err), fmt.Sprintf("Failed to pull image: %v", err))
+		return
+	}
+	defer progress.Close()
+
+	if err := streamProgress(w, progress); err != nil {
+		s.logger.Error("Image pull failed", zap.Error(err), zap.String("image", req.Image))
+		return
+	}
+
+	s.logger.Info("Image pulled", zap.String("image", req.Image))
+}
+
+// pushImageHandler pushes a tagged image and streams Docker's progress messages as newline delimited JSON
+func (s *Server) pushImageHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	var req ImageTransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Image == "" {
+		s.errorResponse(w, http.StatusBadRequest, "An image reference is required")
+		return
+	}
+
+	auth, err := req.registryAuth()
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid registry credentials")
+		return
+	}
+
+	progress, err := docker.ImagePush(r.Context(), req.Image, types.ImagePushOptions{RegistryAuth: auth})
+	if err != nil {
+		s.logger.Error("Failed to push image", zap.Error(err), zap.String("image", req.Image))
+		s.errorResponse(w, dockerErrorStatus(err), fmt.Sprintf("Failed to push image: %v", err))
+		return
+	}
+	defer progress.Close()
+
+	if err := streamProgress(w, progress); err != nil {
+		s.logger.Error("Image push failed", zap.Error(err), zap.String("image", req.Image))
+		return
+	}
+
+	s.logger.Info("Image pushed", zap.String("image", req.Image))
+}
+
+func (s *Server) tagImageHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	var req struct {
+		Repository string `json:"repository"`
+		Tag        string `json:"tag"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Repository == "" {
+		s.errorResponse(w, http.StatusBadRequest, "A target repository is required")
+		return
+	}
+
+	target := req.Repository
+	if req.Tag != "" {
+		target += ":" + req.Tag
+	}
+
+	if err := docker.ImageTag(r.Context(), id, target); err != nil {
+		s.logger.Error("Failed to tag image", zap.Error(err), zap.String("image", id), zap.String("target", target))
+		s.errorResponse(w, dockerErrorStatus(err), "Failed to tag image")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Message: fmt.Sprintf("Image tagged as %s", target)})
+}
+
+func (s *Server) removeImageHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	query := r.URL.Query()
+
+	deleted, err := docker.ImageRemove(r.Context(), id, types.ImageRemoveOptions{
+		Force:         query.Get("force") == "true",
+		PruneChildren: query.Get("noprune") != "true",
+	})
+	if err != nil {
+		s.logger.Error("Failed to remove image", zap.Error(err), zap.String("image", id))
+		s.errorResponse(w, dockerErrorStatus(err), "Failed to remove image")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Message: "Image removed successfully", Data: deleted})
+}
+
+// pruneImagesHandler removes dangling images, or all unused images with ?all=true
+func (s *Server) pruneImagesHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	args := filters.NewArgs()
+	if r.URL.Query().Get("all") == "true" {
+		args.Add("dangling", "false")
+	}
+
+	report, err := docker.ImagesPrune(r.Context(), args)
+	if err != nil {
+		s.logger.Error("Failed to prune images", zap.Error(err))
+		s.errorResponse(w, dockerErrorStatus(err), "Failed to prune images")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{
+		Message: fmt.Sprintf("Reclaimed %d bytes", report.SpaceReclaimed),
+		Data:    report,
+	})
+}
+
+// scanImageHandler runs a Trivy vulnerability scan against an image of the selected
+// Docker endpoint
+func (s *Server) scanImageHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, err := reference.ParseAnyReference(id); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid image reference")
+		return
+	}
+
+	trivy, ok := s.trivy(w, r)
+	if !ok {
+		return
+	}
+
+	// Scans of large images, and the first vulnerability database download, easily
+	// outlast the server WriteTimeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	summary, err := trivy.ScanImage(id)
+	if err != nil {
+		s.logger.Error("Failed to scan image", zap.Error(err), zap.String("image", id))
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to scan image")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Data: summary})
+}
+
+// trivy returns the Trivy service pointed at the Docker endpoint selected for the request
+func (s *Server) trivy(w http.ResponseWriter, r *http.Request) (*services.TrivyService, bool) {
+	name := dockerEndpointName(r)
+	env, err := s.devopsHelper.Docker.Env(name)
+	if err != nil {
+		s.dockerEndpointUnavailable(w, name)
+		return nil, false
+	}
+
+	trivy := *s.devopsHelper.Trivy
+	trivy.Env = append(append([]string(nil), trivy.Env...), env...)
+	return &trivy, true
+}
+
+// streamProgress relays Docker's JSON progress messages to the client as newline
+// delimited JSON, flushing after every message. It returns the error reported
+// inside the stream, if any, since the response status has already been sent.
+func streamProgress(w http.ResponseWriter, progress io.Reader) error {
+	controller := http.NewResponseController(w)
+	// Transfers of large images easily outlast the server WriteTimeout
+	controller.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	decoder := json.NewDecoder(progress)
+	encoder := json.NewEncoder(w)
+
+	var streamErr error
+	for {
+		var message jsonmessage.JSONMessage
+		if err := decoder.Decode(&message); err != nil {
+			if err == io.EOF {
+				return streamErr
+			}
+			return err
+		}
+
+		if message.Error != nil {
+			streamErr = message.Error
+		}
+
+		if err := encoder.Encode(message); err != nil {
+			return err
+		}
+		controller.Flush()
+	}
+}
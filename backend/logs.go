@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// Interval between keep-alive comments on idle server-sent event streams
+const logHeartbeatInterval = 15 * time.Second
+
+// logLine is a single demultiplexed line of container output
+type logLine struct {
+	Stream string
+	Text   string
+}
+
+// logRequest holds the log options shared by container and project log streams
+type logRequest struct {
+	options types.ContainerLogsOptions
+	grep    *regexp.Regexp
+	sse     bool
+}
+
+// parseLogRequest reads the log query parameters: tail (default 100, or "all"), since
+// and until (RFC 3339 or a relative duration such as 10m), follow, stdout, stderr,
+// timestamps, grep (regular expression) and format=sse.
+func parseLogRequest(r *http.Request) (*logRequest, error) {
+	query := r.URL.Query()
+
+	req := &logRequest{
+		options: types.ContainerLogsOptions{
+			ShowStdout: query.Get("stdout") != "false",
+			ShowStderr: query.Get("stderr") != "false",
+			Timestamps: query.Get("timestamps") != "false",
+			Follow:     query.Get("follow") == "true",
+			Since:      query.Get("since"),
+			Until:      query.Get("until"),
+			Tail:       query.Get("tail"),
+		},
+		sse: query.Get("format") == "sse" || strings.Contains(r.Header.Get("Accept"), "text/event-stream"),
+	}
+	if req.options.Tail == "" {
+		req.options.Tail = "100"
+	}
+
+	if !req.options.ShowStdout && !req.options.ShowStderr {
+		return nil, fmt.Errorf("at least one of stdout or stderr must be selected")
+	}
+
+	if pattern := query.Get("grep"); pattern != "" {
+		grep, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grep pattern")
+		}
+		req.grep = grep
+	}
+
+	return req, nil
+}
+
+// getContainerLogsHandler streams container logs as chunked plain text, or as
+// server-sent events when requested with format=sse or Accept: text/event-stream.
+func (s *Server) getContainerLogsHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	req, err := parseLogRequest(r)
+	if err != nil {
+		s.errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	inspect, err := docker.ContainerInspect(ctx, id)
+	if err != nil {
+		s.logger.Error("Failed to inspect container", zap.Error(err), zap.String("container_id", id))
+		s.errorResponse(w, dockerErrorStatus(err), "Container not found")
+		return
+	}
+
+	logs, err := docker.ContainerLogs(ctx, id, req.options)
+	if err != nil {
+		s.logger.Error("Failed to get container logs", zap.Error(err), zap.String("container_id", id))
+		s.errorResponse(w, dockerErrorStatus(err), "Failed to get container logs")
+		return
+	}
+	defer logs.Close()
+
+	lines := make(chan logLine, 64)
+	go demultiplexLogs(ctx, logs, inspect.Config != nil && inspect.Config.Tty, lines)
+
+	s.writeLogStream(w, r, req, lines)
+}
+
+// writeLogStream writes lines until the channel closes or the client goes away
+func (s *Server) writeLogStream(w http.ResponseWriter, r *http.Request, req *logRequest, lines <-chan logLine) {
+	ctx := r.Context()
+	controller := http.NewResponseController(w)
+	if req.options.Follow {
+		// Followed streams must outlive the server WriteTimeout
+		if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+			s.logger.Warn("Failed to clear write deadline for log stream", zap.Error(err))
+		}
+	}
+
+	var heartbeat <-chan time.Time
+	if req.sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+
+		ticker := time.NewTicker(logHeartbeatInterval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+	w.WriteHeader(http.StatusOK)
+	controller.Flush()
+
+	var err error
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				if req.sse {
+					io.WriteString(w, "event: end\ndata: \n\n")
+					controller.Flush()
+				}
+				return
+			}
+
+			if req.grep != nil && !req.grep.MatchString(line.Text) {
+				continue
+			}
+
+			if req.sse {
+				_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", line.Stream, line.Text)
+			} else {
+				_, err = io.WriteString(w, line.Text+"\n")
+			}
+			if err != nil {
+				return
+			}
+
+			// Batch writes while lines are queued, flush once the backlog drains
+			if len(lines) == 0 {
+				if err := controller.Flush(); err != nil {
+					return
+				}
+			}
+		case <-heartbeat:
+			io.WriteString(w, ": keep-alive\n\n")
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// demultiplexLogs splits Docker's multiplexed log stream into lines tagged with their
+// stream and closes lines when the stream ends. Containers started with a TTY produce
+// a raw stream without frame headers, which is reported as stdout.
+func demultiplexLogs(ctx context.Context, logs io.Reader, tty bool, lines chan<- logLine) {
+	defer close(lines)
+
+	if tty {
+		scanLogLines(ctx, logs, "stdout", lines)
+		return
+	}
+
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderrReader, stderrWriter := io.Pipe()
+
+	go func() {
+		_, err := stdcopy.StdCopy(stdoutWriter, stderrWriter, logs)
+		stdoutWriter.CloseWithError(err)
+		stderrWriter.CloseWithError(err)
+	}()
+
+	var wg sync.WaitGroup
+	for stream, reader := range map[string]*io.PipeReader{"stdout": stdoutReader, "stderr": stderrReader} {
+		wg.Add(1)
+		go func(stream string, reader *io.PipeReader) {
+			defer wg.Done()
+			// Closing the reader unblocks StdCopy if the client went away first
+			defer reader.Close()
+			scanLogLines(ctx, reader, stream, lines)
+		}(stream, reader)
+	}
+	wg.Wait()
+}
+
+// scanLogLines reads newline terminated lines without a length limit
+func scanLogLines(ctx context.Context, r io.Reader, stream string, lines chan<- logLine) {
+	reader := bufio.NewReader(r)
+	for {
+		text, err := reader.ReadString('\n')
+		if text != "" {
+			select {
+			case lines <- logLine{Stream: stream, Text: strings.TrimRight(text, "\r\n")}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -1,20 +1,25 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
-	"io"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
 
+	"devops-ide/pkg/authtoken"
 	"devops-ide/services"
 
-	"github.com/docker/docker/client"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -23,9 +28,18 @@ import (
 )
 
 type Response struct {
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Message    string      `json:"message"`
+	Data       interface{} `json:"data,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+// Pagination describes the page of a list returned in Response.Data
+type Pagination struct {
+	Page  int `json:"page"`
+	Limit int `json:"limit"`
+	Total int `json:"total"`
+	Pages int `json:"pages"`
 }
 
 type Container struct {
@@ -33,18 +47,25 @@ type Container struct {
 	Name    string            `json:"name"`
 	Image   string            `json:"image"`
 	Status  string            `json:"status"`
+	State   string            `json:"state"`
+	Created int64             `json:"created"`
 	Command string            `json:"command"`
 	Ports   []string          `json:"ports"`
 	Labels  map[string]string `json:"labels"`
 	Health  string            `json:"health"`
 }
 
+// allowedOrigins lists the browser origins allowed by CORS and websocket upgrades
+var allowedOrigins = []string{"http://localhost:5173"}
+
 type Server struct {
 	router       *mux.Router
-	dockerClient *client.Client
 	logger       *zap.Logger
 	metrics      *Metrics
 	devopsHelper *services.DevOpsHelper
+	verifier     *authtoken.Verifier
+	policy       *services.AccessPolicy
+	workspacePath string
 	wg          sync.WaitGroup
 }
 
@@ -93,7 +114,7 @@ func NewServer() (*Server, error) {
 		return nil, err
 	}
 
-	dockerClient, err := client.NewClientWithOpts(client.FromEnv)
+	dockerEndpoints, err := services.NewDockerEndpoints(logger)
 	if err != nil {
 		logger.Error("Failed to create Docker client", zap.Error(err))
 		return nil, err
@@ -101,6 +122,7 @@ func NewServer() (*Server, error) {
 
 	// Initialize DevOps helper
 	devopsHelper := services.NewDevOpsHelper(logger)
+	devopsHelper.Docker = dockerEndpoints
 	
 	// Initialize services with configuration
 	config := map[string]interface{}{
@@ -114,8 +136,23 @@ func NewServer() (*Server, error) {
 			"username": getEnv("JENKINS_USER", "admin"),
 			"token":    getEnv("JENKINS_TOKEN", ""),
 		},
+		"trivy": map[string]interface{}{
+			"max_critical": getEnv("TRIVY_MAX_CRITICAL", ""),
+			"max_high":     getEnv("TRIVY_MAX_HIGH", ""),
+			"max_medium":   getEnv("TRIVY_MAX_MEDIUM", ""),
+		},
+		"docker": map[string]interface{}{
+			"endpoints": getEnv("DOCKER_ENDPOINTS", ""),
+			"default":   getEnv("DOCKER_DEFAULT_ENDPOINT", ""),
+		},
 		"github": map[string]interface{}{
-			"token": getEnv("GITHUB_TOKEN", ""),
+			"token":                getEnv("GITHUB_TOKEN", ""),
+			"api_url":              getEnv("GITHUB_API_URL", "https://api.github.com"),
+			"app_id":               getEnv("GITHUB_APP_ID", ""),
+			"app_installation_id":  getEnv("GITHUB_APP_INSTALLATION_ID", ""),
+			"app_private_key_path": getEnv("GITHUB_APP_PRIVATE_KEY_PATH", ""),
+			"org_tokens":           getEnv("GITHUB_ORG_TOKENS", ""),
+			"artifacts_dir":        getEnv("GITHUB_ARTIFACTS_DIR", ""),
 		},
 	}
 	
@@ -123,12 +160,20 @@ func NewServer() (*Server, error) {
 		logger.Error("Failed to initialize DevOps services", zap.Error(err))
 	}
 
+	policy, err := loadAccessPolicy()
+	if err != nil {
+		logger.Error("Failed to load access policy", zap.Error(err))
+		return nil, err
+	}
+
 	s := &Server{
 		router:       mux.NewRouter(),
-		dockerClient: dockerClient,
 		logger:      logger,
 		metrics:     NewMetrics(),
 		devopsHelper: devopsHelper,
+		verifier:     newTokenVerifier(logger),
+		policy:       policy,
+		workspacePath: getEnv("WORKSPACE_PATH", "/workspace"),
 	}
 
 	s.setupRoutes()
@@ -190,21 +235,78 @@ func (s *Server) setupRoutes() {
 	s.router.HandleFunc("/health", s.healthCheckHandler).Methods("GET")
 	s.router.Handle("/metrics", promhttp.Handler())
 
-	// API routes
+	// API routes, each requiring a permission granted by the caller's roles
 	api := s.router.PathPrefix("/api").Subrouter()
+	api.Use(s.authenticate)
+	api.HandleFunc("/auth/permissions", s.getPermissionsHandler).Methods("GET")
 	
+	// Docker endpoints, selected per request with ?endpoint= or X-Docker-Endpoint
+	api.HandleFunc("/docker/endpoints", s.authorize("docker:read", s.getDockerEndpointsHandler)).Methods("GET")
+	api.HandleFunc("/docker/endpoints", s.authorize("docker:admin", s.addDockerEndpointHandler)).Methods("POST")
+	api.HandleFunc("/docker/endpoints/{name}", s.authorize("docker:admin", s.removeDockerEndpointHandler)).Methods("DELETE")
+	api.HandleFunc("/docker/endpoints/{name}/default", s.authorize("docker:admin", s.setDefaultDockerEndpointHandler)).Methods("POST")
+
 	// Container management
-	api.HandleFunc("/containers", s.getContainersHandler).Methods("GET")
-	api.HandleFunc("/containers/{id}", s.getContainerHandler).Methods("GET")
-	api.HandleFunc("/containers/{id}/start", s.startContainerHandler).Methods("POST")
-	api.HandleFunc("/containers/{id}/stop", s.stopContainerHandler).Methods("POST")
-	api.HandleFunc("/containers/{id}/logs", s.getContainerLogsHandler).Methods("GET")
+	api.HandleFunc("/containers", s.authorize("containers:read", s.getContainersHandler)).Methods("GET")
+	api.HandleFunc("/containers", s.authorize("containers:write", s.createContainerHandler)).Methods("POST")
+	api.HandleFunc("/containers/events", s.authorize("containers:read", s.containerEventsHandler)).Methods("GET")
+	api.HandleFunc("/containers/{id}", s.authorize("containers:read", s.getContainerHandler)).Methods("GET")
+	api.HandleFunc("/containers/{id}", s.authorize("containers:write", s.removeContainerHandler)).Methods("DELETE")
+	api.HandleFunc("/containers/{id}/start", s.authorize("containers:operate", s.startContainerHandler)).Methods("POST")
+	api.HandleFunc("/containers/{id}/stop", s.authorize("containers:operate", s.stopContainerHandler)).Methods("POST")
+	api.HandleFunc("/containers/{id}/restart", s.authorize("containers:operate", s.restartContainerHandler)).Methods("POST")
+	api.HandleFunc("/containers/{id}/pause", s.authorize("containers:operate", s.pauseContainerHandler)).Methods("POST")
+	api.HandleFunc("/containers/{id}/unpause", s.authorize("containers:operate", s.unpauseContainerHandler)).Methods("POST")
+	api.HandleFunc("/containers/{id}/kill", s.authorize("containers:operate", s.killContainerHandler)).Methods("POST")
+	api.HandleFunc("/containers/{id}/rename", s.authorize("containers:write", s.renameContainerHandler)).Methods("POST")
+	api.HandleFunc("/containers/{id}/logs", s.authorize("containers:read", s.getContainerLogsHandler)).Methods("GET")
+	api.HandleFunc("/containers/{id}/exec", s.authorize("containers:exec", s.execContainerHandler)).Methods("GET")
 	
+	// Image management, references may contain slashes so the catch-all routes come last
+	api.HandleFunc("/images", s.authorize("images:read", s.getImagesHandler)).Methods("GET")
+	api.HandleFunc("/images/pull", s.authorize("images:write", s.pullImageHandler)).Methods("POST")
+	api.HandleFunc("/images/push", s.authorize("images:push", s.pushImageHandler)).Methods("POST")
+	api.HandleFunc("/images/build", s.authorize("images:write", s.buildImageHandler)).Methods("POST")
+	api.HandleFunc("/images/prune", s.authorize("images:delete", s.pruneImagesHandler)).Methods("POST")
+	api.HandleFunc("/images/{id:.+}/history", s.authorize("images:read", s.getImageHistoryHandler)).Methods("GET")
+	api.HandleFunc("/images/{id:.+}/tag", s.authorize("images:write", s.tagImageHandler)).Methods("POST")
+	api.HandleFunc("/images/{id:.+}/scan", s.authorize("images:scan", s.scanImageHandler)).Methods("POST")
+	api.HandleFunc("/images/{id:.+}", s.authorize("images:read", s.getImageHandler)).Methods("GET")
+	api.HandleFunc("/images/{id:.+}", s.authorize("images:delete", s.removeImageHandler)).Methods("DELETE")
+
+	// Volume management
+	api.HandleFunc("/volumes", s.authorize("volumes:read", s.getVolumesHandler)).Methods("GET")
+	api.HandleFunc("/volumes", s.authorize("volumes:write", s.createVolumeHandler)).Methods("POST")
+	api.HandleFunc("/volumes/prune", s.authorize("volumes:write", s.pruneVolumesHandler)).Methods("POST")
+	api.HandleFunc("/volumes/{name}", s.authorize("volumes:read", s.getVolumeHandler)).Methods("GET")
+	api.HandleFunc("/volumes/{name}", s.authorize("volumes:write", s.removeVolumeHandler)).Methods("DELETE")
+
+	// Network management
+	api.HandleFunc("/networks", s.authorize("networks:read", s.getNetworksHandler)).Methods("GET")
+	api.HandleFunc("/networks", s.authorize("networks:write", s.createNetworkHandler)).Methods("POST")
+	api.HandleFunc("/networks/{id}", s.authorize("networks:read", s.getNetworkHandler)).Methods("GET")
+	api.HandleFunc("/networks/{id}", s.authorize("networks:write", s.removeNetworkHandler)).Methods("DELETE")
+	api.HandleFunc("/networks/{id}/connect", s.authorize("networks:write", s.connectNetworkHandler)).Methods("POST")
+	api.HandleFunc("/networks/{id}/disconnect", s.authorize("networks:write", s.disconnectNetworkHandler)).Methods("POST")
+
+	// Docker Compose projects
+	api.HandleFunc("/compose/projects", s.authorize("compose:read", s.getComposeProjectsHandler)).Methods("GET")
+	api.HandleFunc("/compose/config", s.authorize("compose:read", s.composeConfigHandler)).Methods("POST")
+	api.HandleFunc("/compose/projects/{project}/up", s.authorize("compose:write", s.composeUpHandler)).Methods("POST")
+	api.HandleFunc("/compose/projects/{project}/down", s.authorize("compose:write", s.composeDownHandler)).Methods("POST")
+	api.HandleFunc("/compose/projects/{project}/scale", s.authorize("compose:write", s.composeScaleHandler)).Methods("POST")
+	api.HandleFunc("/compose/projects/{project}/logs", s.authorize("compose:read", s.getComposeLogsHandler)).Methods("GET")
+
 	// DevOps tools integration
-	api.HandleFunc("/devops/commands", s.getDevOpsCommandsHandler).Methods("GET")
+	api.HandleFunc("/devops/commands", s.authorize("devops:read", s.getDevOpsCommandsHandler)).Methods("GET")
+	// The permission depends on the command and is checked by the handler
 	api.HandleFunc("/devops/execute", s.executeDevOpsCommandHandler).Methods("POST")
-	api.HandleFunc("/devops/history", s.getCommandHistoryHandler).Methods("GET")
-	api.HandleFunc("/devops/tools/status", s.getToolStatusHandler).Methods("GET")
+	api.HandleFunc("/devops/history", s.authorize("devops:read", s.getCommandHistoryHandler)).Methods("GET")
+	api.HandleFunc("/devops/tools/status", s.authorize("devops:read", s.getToolStatusHandler)).Methods("GET")
+
+	// GitHub pull requests
+	api.HandleFunc("/github/repos/{owner}/{repo}/pulls", s.authorize("github:read", s.getPullRequestsHandler)).Methods("GET")
+	api.HandleFunc("/github/repos/{owner}/{repo}/pulls/{number:[0-9]+}", s.authorize("github:read", s.getPullRequestHandler)).Methods("GET")
 }
 
 func (s *Server) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
@@ -219,55 +321,17 @@ func (s *Server) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	s.jsonResponse(w, http.StatusOK, Response{Data: health})
 }
 
-func (s *Server) getContainersHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
-	if s.dockerClient == nil {
-		s.errorResponse(w, http.StatusServiceUnavailable, "Docker client not available")
-		return
-	}
-
-	containers, err := s.dockerClient.ContainerList(ctx, client.ContainerListOptions{All: true})
-	if err != nil {
-		s.logger.Error("Failed to list containers", zap.Error(err))
-		s.errorResponse(w, http.StatusInternalServerError, "Failed to list containers")
+func (s *Server) getContainerHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
 		return
 	}
 
-	var result []Container
-	for _, c := range containers {
-		container := Container{
-			ID:      c.ID[:12],
-			Name:    c.Names[0],
-			Image:   c.Image,
-			Status:  c.Status,
-			Command: c.Command,
-			Labels:  c.Labels,
-			Ports:   make([]string, 0),
-		}
-
-		for _, p := range c.Ports {
-			container.Ports = append(container.Ports, p.String())
-		}
-
-		// Get container health status
-		inspect, err := s.dockerClient.ContainerInspect(ctx, c.ID)
-		if err == nil && inspect.State != nil && inspect.State.Health != nil {
-			container.Health = inspect.State.Health.Status
-		}
-
-		result = append(result, container)
-	}
-
-	s.jsonResponse(w, http.StatusOK, Response{Data: result})
-}
-
-func (s *Server) getContainerHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
 	ctx := r.Context()
-	container, err := s.dockerClient.ContainerInspect(ctx, id)
+	container, err := docker.ContainerInspect(ctx, id)
 	if err != nil {
 		s.logger.Error("Failed to inspect container", zap.Error(err), zap.String("container_id", id))
 		s.errorResponse(w, http.StatusNotFound, "Container not found")
@@ -278,11 +342,16 @@ func (s *Server) getContainerHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) startContainerHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	id := vars["id"]
 
 	ctx := r.Context()
-	err := s.dockerClient.ContainerStart(ctx, id, client.ContainerStartOptions{})
+	err := docker.ContainerStart(ctx, id, types.ContainerStartOptions{})
 	if err != nil {
 		s.logger.Error("Failed to start container", zap.Error(err), zap.String("container_id", id))
 		s.errorResponse(w, http.StatusInternalServerError, "Failed to start container")
@@ -293,47 +362,24 @@ func (s *Server) startContainerHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) stopContainerHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	ctx := r.Context()
-	timeout := time.Second * 30
-	err := s.dockerClient.ContainerStop(ctx, id, &timeout)
-	if err != nil {
-		s.logger.Error("Failed to stop container", zap.Error(err), zap.String("container_id", id))
-		s.errorResponse(w, http.StatusInternalServerError, "Failed to stop container")
+	docker, ok := s.docker(w, r)
+	if !ok {
 		return
 	}
 
-	s.jsonResponse(w, http.StatusOK, Response{Message: "Container stopped successfully"})
-}
-
-func (s *Server) getContainerLogsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
 	ctx := r.Context()
-	options := client.ContainerLogsOptions{
-		ShowStdout: true,
-		ShowStderr: true,
-		Timestamps: true,
-		Tail:       "100",
-	}
-
-	logs, err := s.dockerClient.ContainerLogs(ctx, id, options)
+	timeout := 30
+	err := docker.ContainerStop(ctx, id, container.StopOptions{Timeout: &timeout})
 	if err != nil {
-		s.logger.Error("Failed to get container logs", zap.Error(err), zap.String("container_id", id))
-		s.errorResponse(w, http.StatusInternalServerError, "Failed to get container logs")
+		s.logger.Error("Failed to stop container", zap.Error(err), zap.String("container_id", id))
+		s.errorResponse(w, http.StatusInternalServerError, "Failed to stop container")
 		return
 	}
-	defer logs.Close()
 
-	w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(http.StatusOK)
-	_, err = io.Copy(w, logs)
-	if err != nil {
-		s.logger.Error("Failed to stream container logs", zap.Error(err))
-	}
+	s.jsonResponse(w, http.StatusOK, Response{Message: "Container stopped successfully"})
 }
 
 // DevOps tools handlers
@@ -352,6 +398,10 @@ func (s *Server) executeDevOpsCommandHandler(w http.ResponseWriter, r *http.Requ
 		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+
+	if !s.permitted(w, r, s.policy.CommandPermission(request.Command)) {
+		return
+	}
 	
 	result, err := s.devopsHelper.ExecuteCommand(request.Command, request.Args)
 	if err != nil {
@@ -390,6 +440,47 @@ func (s *Server) getToolStatusHandler(w http.ResponseWriter, r *http.Request) {
 	s.jsonResponse(w, http.StatusOK, Response{Data: statuses})
 }
 
+func (s *Server) getPullRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.devopsHelper.GitHub == nil {
+		s.errorResponse(w, http.StatusServiceUnavailable, "GitHub service not initialized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 30
+	}
+
+	pulls, err := s.devopsHelper.GitHub.ListPullRequests(vars["owner"], vars["repo"], r.URL.Query().Get("state"), limit)
+	if err != nil {
+		s.logger.Error("Failed to list pull requests", zap.Error(err))
+		s.errorResponse(w, http.StatusBadGateway, "Failed to list pull requests")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Data: pulls})
+}
+
+func (s *Server) getPullRequestHandler(w http.ResponseWriter, r *http.Request) {
+	if s.devopsHelper.GitHub == nil {
+		s.errorResponse(w, http.StatusServiceUnavailable, "GitHub service not initialized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	number, _ := strconv.Atoi(vars["number"])
+
+	report, err := s.devopsHelper.GetPullRequestReport(vars["owner"], vars["repo"], number, r.URL.Query().Get("jenkinsJob"))
+	if err != nil {
+		s.logger.Error("Failed to build pull request report", zap.Error(err), zap.Int("number", number))
+		s.errorResponse(w, http.StatusBadGateway, "Failed to get pull request")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Data: report})
+}
+
 func (s *Server) jsonResponse(w http.ResponseWriter, status int, response Response) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -402,9 +493,9 @@ func (s *Server) errorResponse(w http.ResponseWriter, status int, message string
 
 func (s *Server) Start(port string) error {
 	corsHandler := cors.New(cors.Options{
-		AllowedOrigins: []string{"http://localhost:5173"},
+		AllowedOrigins: allowedOrigins,
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-Docker-Endpoint"},
 		MaxAge:         300,
 	})
 
@@ -442,6 +533,7 @@ func (s *Server) Start(port string) error {
 	}
 
 	s.wg.Wait()
+	s.devopsHelper.Docker.Close()
 	return nil
 }
 
@@ -455,6 +547,20 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Hijack lets websocket upgrades pass through the middleware wrappers
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
 func main() {
 	server, err := NewServer()
 	if err != nil {
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// CreateNetworkRequest describes a network to create, with an optional IPAM subnet
+type CreateNetworkRequest struct {
+	Name       string            `json:"name"`
+	Driver     string            `json:"driver"`
+	Internal   bool              `json:"internal"`
+	Attachable bool              `json:"attachable"`
+	EnableIPv6 bool              `json:"enableIPv6"`
+	Subnet     string            `json:"subnet"`
+	Gateway    string            `json:"gateway"`
+	IPRange    string            `json:"ipRange"`
+	Options    map[string]string `json:"options"`
+	Labels     map[string]string `json:"labels"`
+}
+
+// NetworkConnectRequest attaches or detaches a container from a network
+type NetworkConnectRequest struct {
+	Container   string   `json:"container"`
+	Aliases     []string `json:"aliases"`
+	IPv4Address string   `json:"ipv4Address"`
+	Force       bool     `json:"force"`
+}
+
+// getNetworksHandler lists networks filtered by name, driver, label or scope
+func (s *Server) getNetworksHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	networks, err := docker.NetworkList(r.Context(), types.NetworkListOptions{
+		Filters: queryFilters(r, "name", "driver", "label", "scope"),
+	})
+	if err != nil {
+		s.logger.Error("Failed to list networks", zap.Error(err))
+		s.errorResponse(w, dockerErrorStatus(err), "Failed to list networks")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Data: networks})
+}
+
+func (s *Server) createNetworkHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateNetworkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		s.errorResponse(w, http.StatusBadRequest, "A network name is required")
+		return
+	}
+
+	options := types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         req.Driver,
+		Internal:       req.Internal,
+		Attachable:     req.Attachable,
+		EnableIPv6:     req.EnableIPv6,
+		Options:        req.Options,
+		Labels:         req.Labels,
+	}
+
+	if req.Subnet != "" {
+		options.IPAM = &network.IPAM{
+			Config: []network.IPAMConfig{{
+				Subnet:  req.Subnet,
+				Gateway: req.Gateway,
+				IPRange: req.IPRange,
+			}},
+		}
+	}
+
+	created, err := docker.NetworkCreate(r.Context(), req.Name, options)
+	if err != nil {
+		s.logger.Error("Failed to create network", zap.Error(err), zap.String("network", req.Name))
+		s.errorResponse(w, dockerErrorStatus(err), fmt.Sprintf("Failed to create network: %v", err))
+		return
+	}
+
+	s.jsonResponse(w, http.StatusCreated, Response{Message: "Network created successfully", Data: created})
+}
+
+func (s *Server) getNetworkHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	resource, err := docker.NetworkInspect(r.Context(), id, types.NetworkInspectOptions{
+		Verbose: r.URL.Query().Get("verbose") == "true",
+	})
+	if err != nil {
+		s.logger.Error("Failed to inspect network", zap.Error(err), zap.String("network", id))
+		s.errorResponse(w, dockerErrorStatus(err), "Network not found")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Data: resource})
+}
+
+func (s *Server) connectNetworkHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	var req NetworkConnectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Container == "" {
+		s.errorResponse(w, http.StatusBadRequest, "A container is required")
+		return
+	}
+
+	endpoint := &network.EndpointSettings{Aliases: req.Aliases}
+	if req.IPv4Address != "" {
+		endpoint.IPAMConfig = &network.EndpointIPAMConfig{IPv4Address: req.IPv4Address}
+	}
+
+	if err := docker.NetworkConnect(r.Context(), id, req.Container, endpoint); err != nil {
+		s.logger.Error("Failed to connect container to network", zap.Error(err),
+			zap.String("network", id), zap.String("container_id", req.Container))
+		s.errorResponse(w, dockerErrorStatus(err), fmt.Sprintf("Failed to connect container: %v", err))
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Message: "Container connected to network"})
+}
+
+func (s *Server) disconnectNetworkHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	var req NetworkConnectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Container == "" {
+		s.errorResponse(w, http.StatusBadRequest, "A container is required")
+		return
+	}
+
+	if err := docker.NetworkDisconnect(r.Context(), id, req.Container, req.Force); err != nil {
+		s.logger.Error("Failed to disconnect container from network", zap.Error(err),
+			zap.String("network", id), zap.String("container_id", req.Container))
+		s.errorResponse(w, dockerErrorStatus(err), fmt.Sprintf("Failed to disconnect container: %v", err))
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Message: "Container disconnected from network"})
+}
+
+func (s *Server) removeNetworkHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	if err := docker.NetworkRemove(r.Context(), id); err != nil {
+		s.logger.Error("Failed to remove network", zap.Error(err), zap.String("network", id))
+		s.errorResponse(w, dockerErrorStatus(err), fmt.Sprintf("Failed to remove network: %v", err))
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Message: "Network removed successfully"})
+}
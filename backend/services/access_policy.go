@@ -0,0 +1,127 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AllPermissions grants every permission, e.g. to administrators
+const AllPermissions = "*"
+
+// AccessRole grants permissions directly and through the roles it inherits
+type AccessRole struct {
+	Inherits    []string `json:"inherits,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// AccessPolicy maps token roles to permissions and DevOps commands to the permission
+// needed to run them. Permissions are "resource:action" strings; "resource:*" grants
+// every action on a resource and "*" grants everything.
+type AccessPolicy struct {
+	Roles    map[string]AccessRole `json:"roles"`
+	Commands map[string]string     `json:"commands"`
+
+	// resolved holds the permissions of each role including inherited ones
+	resolved map[string][]string
+}
+
+// ParseAccessPolicy reads a JSON policy and resolves role inheritance
+func ParseAccessPolicy(data []byte) (*AccessPolicy, error) {
+	var policy AccessPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("invalid access policy: %v", err)
+	}
+
+	policy.resolved = make(map[string][]string, len(policy.Roles))
+	for name := range policy.Roles {
+		if _, err := policy.resolve(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return &policy, nil
+}
+
+func (p *AccessPolicy) resolve(name string, path []string) ([]string, error) {
+	if permissions, ok := p.resolved[name]; ok {
+		return permissions, nil
+	}
+	for _, parent := range path {
+		if parent == name {
+			return nil, fmt.Errorf("access policy role %s inherits itself through %s", name, strings.Join(path, " -> "))
+		}
+	}
+
+	role, ok := p.Roles[name]
+	if !ok {
+		return nil, fmt.Errorf("access policy role %s inherits unknown role %s", path[len(path)-1], name)
+	}
+
+	permissions := append([]string{}, role.Permissions...)
+	for _, parent := range role.Inherits {
+		inherited, err := p.resolve(parent, append(path, name))
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, inherited...)
+	}
+
+	p.resolved[name] = permissions
+	return permissions, nil
+}
+
+// Allows reports whether any of the roles grants the permission. Unknown roles grant nothing.
+func (p *AccessPolicy) Allows(roles []string, permission string) bool {
+	resource, _, _ := strings.Cut(permission, ":")
+	for _, role := range roles {
+		for _, granted := range p.resolved[role] {
+			if granted == AllPermissions || granted == permission || granted == resource+":*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ScopesAllow reports whether access token scopes cover the permission, matched like role
+// permissions. No scopes means the token is not narrowed, as for session tokens.
+func ScopesAllow(scopes []string, permission string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+
+	resource, _, _ := strings.Cut(permission, ":")
+	for _, scope := range scopes {
+		if scope == AllPermissions || scope == permission || scope == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions lists the distinct permissions granted by the roles, sorted
+func (p *AccessPolicy) Permissions(roles []string) []string {
+	seen := make(map[string]bool)
+	permissions := []string{}
+	for _, role := range roles {
+		for _, permission := range p.resolved[role] {
+			if !seen[permission] {
+				seen[permission] = true
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	sort.Strings(permissions)
+	return permissions
+}
+
+// CommandPermission returns the permission needed to run a DevOps command. Commands
+// missing from the policy need "commands:<name>", which only "*" grants by default.
+func (p *AccessPolicy) CommandPermission(command string) string {
+	if permission, ok := p.Commands[command]; ok {
+		return permission
+	}
+	return "commands:" + command
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/idtools"
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+)
+
+// ReadDockerignore returns the patterns of the .dockerignore file at the root of the
+// build context, or none when the context has no such file
+func ReadDockerignore(contextDir string) ([]string, error) {
+	file, err := os.Open(filepath.Join(contextDir, ".dockerignore"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	excludes, err := ignorefile.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .dockerignore: %v", err)
+	}
+	if _, err := patternmatcher.New(excludes); err != nil {
+		return nil, fmt.Errorf("invalid .dockerignore: %v", err)
+	}
+	return excludes, nil
+}
+
+// BuildContext archives contextDir the way the docker CLI does, leaving out paths
+// matched by the exclude patterns. The paths in keep, such as the Dockerfile, are
+// always sent. The archive is produced while it is read.
+func BuildContext(contextDir string, excludes []string, keep ...string) (io.ReadCloser, error) {
+	excludes = append([]string(nil), excludes...)
+	for _, file := range keep {
+		if excluded, _ := patternmatcher.MatchesOrParentMatches(file, excludes); excluded {
+			excludes = append(excludes, "!"+file)
+		}
+	}
+
+	return archive.TarWithOptions(contextDir, &archive.TarOptions{
+		ExcludePatterns: excludes,
+		ChownOpts:       &idtools.Identity{UID: 0, GID: 0},
+	})
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// contextFiles lists the regular files of the test build context
+var contextFiles = []string{
+	"Dockerfile",
+	"main.go",
+	"README.md",
+	"docs/guide.md",
+	"docs/api/index.md",
+	"node_modules/left-pad/index.js",
+	"src/app.log",
+	"src/app.go",
+	"src/vendor/lib.log",
+	"tmp/keep.txt",
+	"tmp/scratch.txt",
+}
+
+func TestBuildContextIgnorePatterns(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		ignore     string
+		excluded   []string
+	}{
+		{
+			name:     "no dockerignore",
+			excluded: nil,
+		},
+		{
+			name:     "directory exclude",
+			ignore:   "node_modules\ndocs/",
+			excluded: []string{"docs/api/index.md", "docs/guide.md", "node_modules/left-pad/index.js"},
+		},
+		{
+			name:     "single segment wildcard",
+			ignore:   "*.md\nsrc/*.log",
+			excluded: []string{"README.md", "src/app.log"},
+		},
+		{
+			name:     "double star",
+			ignore:   "**/*.log\ndocs/**/index.md",
+			excluded: []string{"docs/api/index.md", "src/app.log", "src/vendor/lib.log"},
+		},
+		{
+			name:     "negation",
+			ignore:   "tmp\n!tmp/keep.txt",
+			excluded: []string{"tmp/scratch.txt"},
+		},
+		{
+			name:     "later pattern wins",
+			ignore:   "!README.md\n*.md",
+			excluded: []string{"README.md"},
+		},
+		{
+			name:     "comments and leading slash",
+			ignore:   "# build output\n/src/app.log\n\n",
+			excluded: []string{"src/app.log"},
+		},
+		{
+			name:       "dockerfile is kept",
+			dockerfile: "docs/Dockerfile",
+			ignore:     "Dockerfile\ndocs\n.dockerignore",
+			excluded:   []string{"Dockerfile", "docs/api/index.md", "docs/guide.md"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := append([]string(nil), contextFiles...)
+			if test.dockerfile != "" {
+				files = append(files, test.dockerfile)
+			} else {
+				test.dockerfile = "Dockerfile"
+			}
+			for _, file := range files {
+				writeContextFile(t, dir, file, "content of "+file)
+			}
+			if test.ignore != "" {
+				writeContextFile(t, dir, ".dockerignore", test.ignore)
+				files = append(files, ".dockerignore")
+			}
+
+			excludes, err := ReadDockerignore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			archive, err := BuildContext(dir, excludes, test.dockerfile, ".dockerignore")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer archive.Close()
+
+			var expected []string
+			for _, file := range files {
+				if !contains(test.excluded, file) {
+					expected = append(expected, file)
+				}
+			}
+			sort.Strings(expected)
+
+			if sent := archivedFiles(t, archive); !reflect.DeepEqual(sent, expected) {
+				t.Fatalf("expected the context to hold\n%v\ngot\n%v", expected, sent)
+			}
+		})
+	}
+}
+
+func TestReadDockerignoreRejectsInvalidPatterns(t *testing.T) {
+	dir := t.TempDir()
+	writeContextFile(t, dir, ".dockerignore", "[a-")
+
+	if _, err := ReadDockerignore(dir); err == nil || !strings.Contains(err.Error(), ".dockerignore") {
+		t.Fatalf("expected an invalid .dockerignore error, got %v", err)
+	}
+}
+
+func TestBuildContextOwnership(t *testing.T) {
+	dir := t.TempDir()
+	writeContextFile(t, dir, "Dockerfile", "FROM scratch")
+
+	archive, err := BuildContext(dir, nil, "Dockerfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	reader := tar.NewReader(archive)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Uid != 0 || header.Gid != 0 {
+			t.Fatalf("expected %s to be owned by root, got %d:%d", header.Name, header.Uid, header.Gid)
+		}
+	}
+}
+
+func writeContextFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// archivedFiles returns the sorted names of the regular files in a tar stream
+func archivedFiles(t *testing.T, r io.Reader) []string {
+	t.Helper()
+	var files []string
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			files = append(files, header.Name)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// BuildEvent is one line of the newline delimited JSON stream returned by image builds
+type BuildEvent struct {
+	Type   string `json:"type"`
+	Vertex string `json:"vertex,omitempty"`
+	// ID tells apart the progress events of concurrent operations of one step, such as
+	// the layers of a download
+	ID        string      `json:"id,omitempty"`
+	Name      string      `json:"name,omitempty"`
+	Message   string      `json:"message,omitempty"`
+	Stream    int64       `json:"stream,omitempty"`
+	Cached    bool        `json:"cached,omitempty"`
+	Started   *time.Time  `json:"started,omitempty"`
+	Completed *time.Time  `json:"completed,omitempty"`
+	Current   int64       `json:"current,omitempty"`
+	Total     int64       `json:"total,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// Build event types
+const (
+	BuildEventStep     = "step"
+	BuildEventProgress = "progress"
+	BuildEventLog      = "log"
+	BuildEventWarning  = "warning"
+	BuildEventError    = "error"
+	BuildEventResult   = "result"
+	BuildEventScan     = "scan"
+	BuildEventPolicy   = "policy"
+)
+
+// DecodeBuildTrace converts a BuildKit StatusResponse, which the daemon forwards as the
+// protobuf encoded aux payload of "moby.buildkit.trace" messages, into build events.
+// Only the fields shown to users are decoded, so the BuildKit API module is not needed.
+func DecodeBuildTrace(data []byte) ([]BuildEvent, error) {
+	var events []BuildEvent
+
+	err := forEachField(data, func(num protowire.Number, value []byte, _ uint64) error {
+		var event BuildEvent
+		var err error
+
+		switch num {
+		case 1:
+			event, err = decodeVertex(value)
+		case 2:
+			event, err = decodeVertexStatus(value)
+		case 3:
+			event, err = decodeVertexLog(value)
+		case 4:
+			event, err = decodeVertexWarning(value)
+		default:
+			return nil
+		}
+
+		if err == nil {
+			events = append(events, event)
+		}
+		return err
+	})
+
+	return events, err
+}
+
+// decodeVertex reads a build step: digest, name, cached, started, completed and error
+func decodeVertex(data []byte) (BuildEvent, error) {
+	event := BuildEvent{Type: BuildEventStep}
+
+	err := forEachField(data, func(num protowire.Number, value []byte, varint uint64) error {
+		var err error
+		switch num {
+		case 1:
+			event.Vertex = string(value)
+		case 3:
+			event.Name = string(value)
+		case 4:
+			event.Cached = varint != 0
+		case 5:
+			event.Started, err = decodeTimestamp(value)
+		case 6:
+			event.Completed, err = decodeTimestamp(value)
+		case 7:
+			event.Error = string(value)
+		}
+		return err
+	})
+
+	return event, err
+}
+
+// decodeVertexStatus reads the progress of a long running operation such as a layer download
+func decodeVertexStatus(data []byte) (BuildEvent, error) {
+	event := BuildEvent{Type: BuildEventProgress}
+
+	err := forEachField(data, func(num protowire.Number, value []byte, varint uint64) error {
+		var err error
+		switch num {
+		case 1:
+			event.ID = string(value)
+		case 2:
+			event.Vertex = string(value)
+		case 3:
+			event.Name = string(value)
+		case 4:
+			event.Current = int64(varint)
+		case 5:
+			event.Total = int64(varint)
+		case 7:
+			event.Started, err = decodeTimestamp(value)
+		case 8:
+			event.Completed, err = decodeTimestamp(value)
+		}
+		return err
+	})
+
+	return event, err
+}
+
+// decodeVertexLog reads output written by a build step, stream 1 is stdout and 2 stderr
+func decodeVertexLog(data []byte) (BuildEvent, error) {
+	event := BuildEvent{Type: BuildEventLog}
+
+	err := forEachField(data, func(num protowire.Number, value []byte, varint uint64) error {
+		switch num {
+		case 1:
+			event.Vertex = string(value)
+		case 3:
+			event.Stream = int64(varint)
+		case 4:
+			event.Message = string(value)
+		}
+		return nil
+	})
+
+	return event, err
+}
+
+// decodeVertexWarning reads a Dockerfile lint or deprecation warning
+func decodeVertexWarning(data []byte) (BuildEvent, error) {
+	event := BuildEvent{Type: BuildEventWarning}
+	var detail []string
+
+	err := forEachField(data, func(num protowire.Number, value []byte, _ uint64) error {
+		switch num {
+		case 1:
+			event.Vertex = string(value)
+		case 3:
+			event.Message = string(value)
+		case 4:
+			detail = append(detail, string(value))
+		}
+		return nil
+	})
+
+	if len(detail) > 0 {
+		event.Message += "\n" + strings.Join(detail, "\n")
+	}
+	return event, err
+}
+
+// decodeTimestamp reads a google.protobuf.Timestamp
+func decodeTimestamp(data []byte) (*time.Time, error) {
+	var seconds, nanos uint64
+
+	err := forEachField(data, func(num protowire.Number, _ []byte, varint uint64) error {
+		switch num {
+		case 1:
+			seconds = varint
+		case 2:
+			nanos = varint
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	t := time.Unix(int64(seconds), int64(nanos)).UTC()
+	return &t, nil
+}
+
+// forEachField walks the fields of an encoded protobuf message, passing length
+// delimited values as bytes and varints as integers. Other wire types are skipped.
+func forEachField(data []byte, fn func(num protowire.Number, value []byte, varint uint64) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch typ {
+		case protowire.BytesType:
+			value, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if err := fn(num, value, 0); err != nil {
+				return err
+			}
+			data = data[n:]
+		case protowire.VarintType:
+			value, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if err := fn(num, nil, value); err != nil {
+				return err
+			}
+			data = data[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+
+	return nil
+}
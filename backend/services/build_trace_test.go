@@ -0,0 +1,47 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testdata/buildkit-trace.pb is an encoded BuildKit StatusResponse holding a cached and a
+// failed step, a layer extraction, a stderr log line and a Dockerfile warning, with fields
+// the decoder skips such as vertex inputs, timestamps and warning URLs
+func TestDecodeBuildTraceGolden(t *testing.T) {
+	trace, err := os.ReadFile(filepath.Join("testdata", "buildkit-trace.pb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := os.ReadFile(filepath.Join("testdata", "buildkit-trace.golden.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := DecodeBuildTrace(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := json.MarshalIndent(events, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, bytes.TrimSpace(golden)) {
+		t.Fatalf("decoded events differ from the golden file, got\n%s", decoded)
+	}
+}
+
+func TestDecodeBuildTraceTruncated(t *testing.T) {
+	trace, err := os.ReadFile(filepath.Join("testdata", "buildkit-trace.pb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DecodeBuildTrace(trace[:len(trace)-3]); err == nil {
+		t.Fatal("expected an error for a truncated trace")
+	}
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Labels set by Docker Compose on the containers it creates
+const (
+	ComposeProjectLabel     = "com.docker.compose.project"
+	ComposeServiceLabel     = "com.docker.compose.service"
+	ComposeWorkingDirLabel  = "com.docker.compose.project.working_dir"
+	ComposeConfigFilesLabel = "com.docker.compose.project.config_files"
+	ComposeNumberLabel      = "com.docker.compose.container-number"
+)
+
+// ErrUnknownComposeService is returned for service names the project does not define
+var ErrUnknownComposeService = errors.New("unknown compose service")
+
+// ComposeService manages Docker Compose projects through the docker compose CLI
+type ComposeService struct {
+	Logger *zap.Logger
+	// Env is added to the environment of every compose invocation, e.g. DOCKER_HOST
+	Env []string
+}
+
+// ComposeProject is the normalized project model printed by docker compose config
+type ComposeProject struct {
+	Name     string                          `json:"name"`
+	Services map[string]ComposeServiceConfig `json:"services"`
+	Networks map[string]json.RawMessage      `json:"networks,omitempty"`
+	Volumes  map[string]json.RawMessage      `json:"volumes,omitempty"`
+}
+
+// ComposeServiceConfig holds the parts of a service definition shown in the IDE
+type ComposeServiceConfig struct {
+	Image string `json:"image,omitempty"`
+	Build *struct {
+		Context    string `json:"context"`
+		Dockerfile string `json:"dockerfile,omitempty"`
+		Target     string `json:"target,omitempty"`
+	} `json:"build,omitempty"`
+	Ports []struct {
+		Target    uint32 `json:"target"`
+		Published string `json:"published,omitempty"`
+		Protocol  string `json:"protocol,omitempty"`
+		HostIP    string `json:"host_ip,omitempty"`
+	} `json:"ports,omitempty"`
+	Environment map[string]*string         `json:"environment,omitempty"`
+	DependsOn   map[string]json.RawMessage `json:"depends_on,omitempty"`
+	Networks    map[string]json.RawMessage `json:"networks,omitempty"`
+	Volumes     []json.RawMessage          `json:"volumes,omitempty"`
+	Labels      map[string]string          `json:"labels,omitempty"`
+	Restart     string                     `json:"restart,omitempty"`
+	Deploy      *struct {
+		Replicas *int `json:"replicas,omitempty"`
+	} `json:"deploy,omitempty"`
+}
+
+// NewComposeService creates a new Compose service instance
+func NewComposeService(logger *zap.Logger) *ComposeService {
+	return &ComposeService{
+		Logger: logger,
+	}
+}
+
+// Config parses and validates a compose file, resolving variables, extends and defaults
+func (c *ComposeService) Config(ctx context.Context, file, project string) (*ComposeProject, error) {
+	output, err := c.run(ctx, file, project, "config", "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+
+	var model ComposeProject
+	if err := json.Unmarshal([]byte(output), &model); err != nil {
+		return nil, fmt.Errorf("failed to parse compose config: %v", err)
+	}
+
+	return &model, nil
+}
+
+// Up creates and starts the project in the background, optionally limited to some services
+func (c *ComposeService) Up(ctx context.Context, file, project string, services []string, build bool) (string, error) {
+	args := []string{"up", "--detach", "--remove-orphans"}
+	if build {
+		args = append(args, "--build")
+	}
+	if len(services) > 0 {
+		if err := c.checkServices(ctx, file, project, services...); err != nil {
+			return "", err
+		}
+		args = append(args, "--")
+		args = append(args, services...)
+	}
+
+	return c.run(ctx, file, project, args...)
+}
+
+// Down stops and removes the project containers and networks, and its volumes if requested.
+// The compose file is optional since Compose finds the project by its labels.
+func (c *ComposeService) Down(ctx context.Context, file, project string, removeVolumes bool) (string, error) {
+	args := []string{"down", "--remove-orphans"}
+	if removeVolumes {
+		args = append(args, "--volumes")
+	}
+
+	return c.run(ctx, file, project, args...)
+}
+
+// Scale sets the number of containers of a service without recreating the others
+func (c *ComposeService) Scale(ctx context.Context, file, project, service string, replicas int) (string, error) {
+	if replicas < 0 {
+		return "", fmt.Errorf("invalid replica count: %d", replicas)
+	}
+	if err := c.checkServices(ctx, file, project, service); err != nil {
+		return "", err
+	}
+
+	return c.run(ctx, file, project, "up", "--detach", "--no-deps", "--no-recreate",
+		"--scale", fmt.Sprintf("%s=%d", service, replicas), "--", service)
+}
+
+// checkServices rejects service names the project does not define, so they cannot be
+// mistaken for options either
+func (c *ComposeService) checkServices(ctx context.Context, file, project string, services ...string) error {
+	model, err := c.Config(ctx, file, project)
+	if err != nil {
+		return err
+	}
+
+	for _, service := range services {
+		if _, ok := model.Services[service]; !ok {
+			return fmt.Errorf("%w: %q", ErrUnknownComposeService, service)
+		}
+	}
+	return nil
+}
+
+// run executes docker compose with the project flags and returns its combined output
+func (c *ComposeService) run(ctx context.Context, file, project string, args ...string) (string, error) {
+	composeArgs := []string{"compose"}
+	if file != "" {
+		composeArgs = append(composeArgs, "--file", file)
+	}
+	if project != "" {
+		composeArgs = append(composeArgs, "--project-name", project)
+	}
+	composeArgs = append(composeArgs, args...)
+
+	c.Logger.Info("Running docker compose",
+		zap.String("file", file),
+		zap.String("project", project),
+		zap.Strings("args", args))
+
+	cmd := exec.CommandContext(ctx, "docker", composeArgs...)
+	cmd.Env = append(os.Environ(), c.Env...)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		c.Logger.Error("docker compose failed", zap.Error(err), zap.String("output", string(output)))
+		return string(output), fmt.Errorf("docker compose %s failed: %v: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+
+	return string(output), nil
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -18,16 +19,23 @@ type DevOpsHelper struct {
 	Trivy     *TrivyService
 	Jenkins   *JenkinsService
 	GitHub    *GitHubService
+	Compose   *ComposeService
+	Docker    *DockerEndpoints
 	Logger    *zap.Logger
+
+	// ArtifactsDir is the only directory artifacts are downloaded to, the system temp
+	// directory is used when it is empty
+	ArtifactsDir string
 }
 
 // ToolStatus represents the status of a DevOps tool
 type ToolStatus struct {
-	Name      string    `json:"name"`
-	Available bool      `json:"available"`
-	Version   string    `json:"version,omitempty"`
-	Error     string    `json:"error,omitempty"`
-	Timestamp time.Time `json:"timestamp"`
+	Name      string     `json:"name"`
+	Available bool       `json:"available"`
+	Version   string     `json:"version,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+	Timestamp time.Time  `json:"timestamp"`
 }
 
 // DevOpsCommand represents a command that can be executed
@@ -74,6 +82,21 @@ func (d *DevOpsHelper) InitializeServices(config map[string]interface{}) error {
 
 	// Initialize Trivy
 	d.Trivy = NewTrivyService(d.Logger)
+	if trivyConfig, ok := config["trivy"].(map[string]interface{}); ok {
+		if err := d.configureScanPolicy(trivyConfig); err != nil {
+			return err
+		}
+	}
+
+	// Initialize Docker Compose
+	d.Compose = NewComposeService(d.Logger)
+
+	// Register additional Docker endpoints
+	if dockerConfig, ok := config["docker"].(map[string]interface{}); ok && d.Docker != nil {
+		if err := d.configureDockerEndpoints(dockerConfig); err != nil {
+			return err
+		}
+	}
 
 	// Initialize Jenkins
 	if jenkinsConfig, ok := config["jenkins"].(map[string]interface{}); ok {
@@ -90,6 +113,101 @@ func (d *DevOpsHelper) InitializeServices(config map[string]interface{}) error {
 	if githubConfig, ok := config["github"].(map[string]interface{}); ok {
 		if token, tokenOk := githubConfig["token"].(string); tokenOk {
 			d.GitHub = NewGitHubService(token, d.Logger)
+			if err := d.configureGitHub(githubConfig); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// configureScanPolicy applies the vulnerability limits enforced after image builds
+func (d *DevOpsHelper) configureScanPolicy(trivyConfig map[string]interface{}) error {
+	limits := map[string]*int{
+		"max_critical": &d.Trivy.Policy.MaxCritical,
+		"max_high":     &d.Trivy.Policy.MaxHigh,
+		"max_medium":   &d.Trivy.Policy.MaxMedium,
+	}
+
+	for key, limit := range limits {
+		if value, ok := trivyConfig[key].(string); ok && value != "" {
+			if _, err := fmt.Sscanf(value, "%d", limit); err != nil {
+				return fmt.Errorf("invalid Trivy policy %s: %s", key, value)
+			}
+		}
+	}
+
+	return nil
+}
+
+// configureDockerEndpoints registers the endpoints given as a JSON array of
+// DockerEndpointConfig and selects the default endpoint
+func (d *DevOpsHelper) configureDockerEndpoints(dockerConfig map[string]interface{}) error {
+	if endpoints, ok := dockerConfig["endpoints"].(string); ok && endpoints != "" {
+		var configs []DockerEndpointConfig
+		if err := json.Unmarshal([]byte(endpoints), &configs); err != nil {
+			return fmt.Errorf("invalid Docker endpoints: %v", err)
+		}
+		for _, config := range configs {
+			if err := d.Docker.Add(config); err != nil {
+				return err
+			}
+		}
+	}
+
+	if name, ok := dockerConfig["default"].(string); ok && name != "" {
+		if err := d.Docker.SetDefault(name); err != nil {
+			return fmt.Errorf("invalid default Docker endpoint %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// configureGitHub applies the optional Enterprise Server, GitHub App and per-org settings
+func (d *DevOpsHelper) configureGitHub(githubConfig map[string]interface{}) error {
+	if apiURL, ok := githubConfig["api_url"].(string); ok && apiURL != "" {
+		d.GitHub.BaseURL = strings.TrimSuffix(apiURL, "/")
+	}
+
+	if appID, ok := githubConfig["app_id"].(string); ok && appID != "" {
+		keyPath, _ := githubConfig["app_private_key_path"].(string)
+		privateKey, err := os.ReadFile(keyPath)
+		if err != nil {
+			return fmt.Errorf("failed to read GitHub App private key: %v", err)
+		}
+
+		var id, installationID int64
+		if _, err := fmt.Sscanf(appID, "%d", &id); err != nil {
+			return fmt.Errorf("invalid GitHub App ID: %s", appID)
+		}
+		if installation, ok := githubConfig["app_installation_id"].(string); ok && installation != "" {
+			if _, err := fmt.Sscanf(installation, "%d", &installationID); err != nil {
+				return fmt.Errorf("invalid GitHub App installation ID: %s", installation)
+			}
+		}
+
+		credentials, err := NewGitHubAppCredentials(id, installationID, privateKey)
+		if err != nil {
+			return err
+		}
+		d.GitHub.Credentials = credentials
+		d.Logger.Info("Using GitHub App authentication", zap.Int64("app_id", id))
+	}
+
+	if dir, ok := githubConfig["artifacts_dir"].(string); ok && dir != "" {
+		d.ArtifactsDir = dir
+	}
+
+	// Per-org tokens are given as "org=token" pairs separated by commas
+	if orgTokens, ok := githubConfig["org_tokens"].(string); ok && orgTokens != "" {
+		for _, pair := range strings.Split(orgTokens, ",") {
+			org, token, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if !found || org == "" || token == "" {
+				return fmt.Errorf("invalid GitHub org token entry: %q", pair)
+			}
+			d.GitHub.SetOrgCredentials(org, &TokenCredentials{Token: token})
 		}
 	}
 
@@ -106,6 +224,7 @@ func (d *DevOpsHelper) CheckToolAvailability() ([]ToolStatus, error) {
 		{"sonar-scanner", "sonar-scanner", []string{"--version"}},
 		{"trivy", "trivy", []string{"--version"}},
 		{"docker", "docker", []string{"--version"}},
+		{"docker-compose", "docker", []string{"compose", "version"}},
 		{"kubectl", "kubectl", []string{"version", "--client"}},
 		{"terraform", "terraform", []string{"--version"}},
 		{"ansible", "ansible", []string{"--version"}},
@@ -135,6 +254,38 @@ func (d *DevOpsHelper) CheckToolAvailability() ([]ToolStatus, error) {
 		statuses = append(statuses, status)
 	}
 
+	// Report the health of every Docker endpoint
+	if d.Docker != nil {
+		for _, endpoint := range d.Docker.Check(context.Background()) {
+			statuses = append(statuses, ToolStatus{
+				Name:      "docker:" + endpoint.Name,
+				Available: endpoint.Available,
+				Version:   endpoint.Version,
+				Error:     endpoint.Error,
+				Timestamp: endpoint.Timestamp,
+			})
+		}
+	}
+
+	// Report remaining GitHub API quota alongside the CLI tools
+	if d.GitHub != nil {
+		status := ToolStatus{
+			Name:      "github-api",
+			Timestamp: time.Now(),
+		}
+
+		rateLimit, err := d.GitHub.GetRateLimit()
+		if err != nil {
+			status.Available = false
+			status.Error = err.Error()
+		} else {
+			status.Available = rateLimit.Remaining > 0
+			status.RateLimit = rateLimit
+		}
+
+		statuses = append(statuses, status)
+	}
+
 	return statuses, nil
 }
 
@@ -231,6 +382,84 @@ func (d *DevOpsHelper) GetAvailableCommands() []DevOpsCommand {
 			Example:     "github-trigger owner repo 123456 main",
 		},
 
+		{
+			Name:        "github-prs",
+			Description: "List pull requests, or show checks and the combined verdict of one",
+			Category:    "CI/CD",
+			Parameters:  map[string]string{"owner": "Repository owner", "repo": "Repository name", "number": "Pull request number (optional)", "jenkins-job": "Jenkins multibranch job (optional)"},
+			Example:     "github-prs owner repo 42",
+		},
+		{
+			Name:        "github-artifacts",
+			Description: "List artifacts of a workflow run",
+			Category:    "CI/CD",
+			Parameters:  map[string]string{"owner": "Repository owner", "repo": "Repository name", "run": "Workflow run ID"},
+			Example:     "github-artifacts owner repo 987654",
+		},
+		{
+			Name:        "github-artifact-download",
+			Description: "Download a workflow run artifact as a zip archive",
+			Category:    "CI/CD",
+			Parameters:  map[string]string{"owner": "Repository owner", "repo": "Repository name", "artifact": "Artifact ID", "dir": "Destination directory below the artifacts directory (optional)"},
+			Example:     "github-artifact-download owner repo 123456 nightly",
+		},
+		{
+			Name:        "github-caches",
+			Description: "List GitHub Actions caches",
+			Category:    "CI/CD",
+			Parameters:  map[string]string{"owner": "Repository owner", "repo": "Repository name", "branch": "Branch name (optional)"},
+			Example:     "github-caches owner repo main",
+		},
+		{
+			Name:        "github-cache-delete",
+			Description: "Delete GitHub Actions caches of a branch",
+			Category:    "CI/CD",
+			Parameters:  map[string]string{"owner": "Repository owner", "repo": "Repository name", "branch": "Branch name", "key": "Cache key (optional)"},
+			Example:     "github-cache-delete owner repo feature/login",
+		},
+		{
+			Name:        "github-secrets",
+			Description: "List repository or environment secrets",
+			Category:    "CI/CD",
+			Parameters:  map[string]string{"owner": "Repository owner", "repo": "Repository name", "environment": "Environment name (optional)"},
+			Example:     "github-secrets owner repo production",
+		},
+		{
+			Name:        "github-secret-set",
+			Description: "Create or update an encrypted secret",
+			Category:    "CI/CD",
+			Parameters:  map[string]string{"owner": "Repository owner", "repo": "Repository name", "name": "Secret name", "value": "Secret value", "environment": "Environment name (optional)"},
+			Example:     "github-secret-set owner repo API_KEY s3cr3t production",
+		},
+		{
+			Name:        "github-secret-delete",
+			Description: "Delete a repository or environment secret",
+			Category:    "CI/CD",
+			Parameters:  map[string]string{"owner": "Repository owner", "repo": "Repository name", "name": "Secret name", "environment": "Environment name (optional)"},
+			Example:     "github-secret-delete owner repo API_KEY",
+		},
+		{
+			Name:        "github-variables",
+			Description: "List repository or environment variables",
+			Category:    "CI/CD",
+			Parameters:  map[string]string{"owner": "Repository owner", "repo": "Repository name", "environment": "Environment name (optional)"},
+			Example:     "github-variables owner repo",
+		},
+		{
+			Name:        "github-variable-set",
+			Description: "Create or update a variable",
+			Category:    "CI/CD",
+			Parameters:  map[string]string{"owner": "Repository owner", "repo": "Repository name", "name": "Variable name", "value": "Variable value", "environment": "Environment name (optional)"},
+			Example:     "github-variable-set owner repo REGION eu-west-1",
+		},
+		{
+			Name:        "github-variable-delete",
+			Description: "Delete a repository or environment variable",
+			Category:    "CI/CD",
+			Parameters:  map[string]string{"owner": "Repository owner", "repo": "Repository name", "name": "Variable name", "environment": "Environment name (optional)"},
+			Example:     "github-variable-delete owner repo REGION",
+		},
+
 		// Utility Commands
 		{
 			Name:        "tool-status",
@@ -251,7 +480,7 @@ func (d *DevOpsHelper) GetAvailableCommands() []DevOpsCommand {
 func (d *DevOpsHelper) ExecuteCommand(command string, args []string) (*CommandResult, error) {
 	start := time.Now()
 	result := &CommandResult{
-		Command:   fmt.Sprintf("%s %s", command, strings.Join(args, " ")),
+		Command:   fmt.Sprintf("%s %s", command, strings.Join(redactArgs(command, args), " ")),
 		Timestamp: start,
 	}
 
@@ -282,6 +511,28 @@ func (d *DevOpsHelper) ExecuteCommand(command string, args []string) (*CommandRe
 		result = d.executeGitHubRuns(args, result)
 	case "github-trigger":
 		result = d.executeGitHubTrigger(args, result)
+	case "github-prs":
+		result = d.executeGitHubPullRequests(args, result)
+	case "github-artifacts":
+		result = d.executeGitHubArtifacts(args, result)
+	case "github-artifact-download":
+		result = d.executeGitHubArtifactDownload(args, result)
+	case "github-caches":
+		result = d.executeGitHubCaches(args, result)
+	case "github-cache-delete":
+		result = d.executeGitHubCacheDelete(args, result)
+	case "github-secrets":
+		result = d.executeGitHubSecrets(args, result)
+	case "github-secret-set":
+		result = d.executeGitHubSecretSet(args, result)
+	case "github-secret-delete":
+		result = d.executeGitHubSecretDelete(args, result)
+	case "github-variables":
+		result = d.executeGitHubVariables(args, result)
+	case "github-variable-set":
+		result = d.executeGitHubVariableSet(args, result)
+	case "github-variable-delete":
+		result = d.executeGitHubVariableDelete(args, result)
 	case "tool-status":
 		result = d.executeToolStatus(result)
 	case "help":
@@ -609,6 +860,415 @@ func (d *DevOpsHelper) executeGitHubTrigger(args []string, result *CommandResult
 	return result
 }
 
+func (d *DevOpsHelper) executeGitHubPullRequests(args []string, result *CommandResult) *CommandResult {
+	if d.GitHub == nil {
+		result.Success = false
+		result.Error = "GitHub service not initialized"
+		return result
+	}
+
+	if len(args) < 2 {
+		result.Success = false
+		result.Error = "Missing owner and repository arguments"
+		return result
+	}
+
+	if len(args) < 3 {
+		pulls, err := d.GitHub.ListPullRequests(args[0], args[1], "open", 30)
+		if err != nil {
+			result.Success = false
+			result.Error = err.Error()
+			return result
+		}
+
+		result.Success = true
+		result.Data = pulls
+		result.Output = fmt.Sprintf("Found %d open pull requests", len(pulls))
+		return result
+	}
+
+	number := 0
+	if _, err := fmt.Sscanf(args[2], "%d", &number); err != nil {
+		result.Success = false
+		result.Error = "Invalid pull request number"
+		return result
+	}
+
+	report, err := d.GetPullRequestReport(args[0], args[1], number, optionalArg(args, 3))
+	if err != nil {
+		result.Success = false
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Success = true
+	result.Data = report
+	result.Output = fmt.Sprintf("PR #%d is %s (%d checks, review: %s, mergeable: %s)",
+		number, report.State, len(report.Checks), report.ReviewDecision, report.Mergeable)
+	return result
+}
+
+func (d *DevOpsHelper) executeGitHubArtifacts(args []string, result *CommandResult) *CommandResult {
+	if d.GitHub == nil {
+		result.Success = false
+		result.Error = "GitHub service not initialized"
+		return result
+	}
+
+	if len(args) < 3 {
+		result.Success = false
+		result.Error = "Missing owner, repository, and run ID arguments"
+		return result
+	}
+
+	var runID int64
+	if _, err := fmt.Sscanf(args[2], "%d", &runID); err != nil {
+		result.Success = false
+		result.Error = "Invalid run ID"
+		return result
+	}
+
+	artifacts, err := d.GitHub.ListArtifacts(args[0], args[1], runID)
+	if err != nil {
+		result.Success = false
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Success = true
+	result.Data = artifacts
+	result.Output = fmt.Sprintf("Found %d artifacts", len(artifacts))
+	return result
+}
+
+func (d *DevOpsHelper) executeGitHubArtifactDownload(args []string, result *CommandResult) *CommandResult {
+	if d.GitHub == nil {
+		result.Success = false
+		result.Error = "GitHub service not initialized"
+		return result
+	}
+
+	if len(args) < 3 {
+		result.Success = false
+		result.Error = "Missing owner, repository, and artifact ID arguments"
+		return result
+	}
+
+	var artifactID int64
+	if _, err := fmt.Sscanf(args[2], "%d", &artifactID); err != nil {
+		result.Success = false
+		result.Error = "Invalid artifact ID"
+		return result
+	}
+
+	var subdir string
+	if len(args) > 3 {
+		subdir = args[3]
+	}
+	dir, err := d.artifactDir(subdir)
+	if err != nil {
+		result.Success = false
+		result.Error = err.Error()
+		return result
+	}
+
+	filename := filepath.Join(dir, fmt.Sprintf("artifact-%d.zip", artifactID))
+	file, err := os.Create(filename)
+	if err != nil {
+		result.Success = false
+		result.Error = err.Error()
+		return result
+	}
+	defer file.Close()
+
+	written, err := d.GitHub.DownloadArtifact(args[0], args[1], artifactID, file)
+	if err != nil {
+		os.Remove(filename)
+		result.Success = false
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Success = true
+	result.Data = map[string]interface{}{"path": filename, "bytes": written}
+	result.Output = fmt.Sprintf("Downloaded %d bytes to %s", written, filename)
+	return result
+}
+
+// artifactDir creates the destination of an artifact download below the artifacts
+// directory. Absolute paths, paths leaving it and symlinks below it are rejected.
+func (d *DevOpsHelper) artifactDir(subdir string) (string, error) {
+	root := d.ArtifactsDir
+	if root == "" {
+		root = filepath.Join(os.TempDir(), "devops-artifacts")
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return "", err
+	}
+	if subdir == "" {
+		return root, nil
+	}
+
+	if filepath.IsAbs(subdir) {
+		return "", fmt.Errorf("artifact directory must be relative to %s", root)
+	}
+	dir := filepath.Join(root, filepath.Clean(subdir))
+	if !withinDir(root, dir) {
+		return "", fmt.Errorf("artifact directory must stay inside %s", root)
+	}
+
+	// Create one level at a time and refuse symlinks, so a link below the root cannot
+	// redirect the download elsewhere
+	rel, _ := filepath.Rel(root, dir)
+	current := root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+		current = filepath.Join(current, part)
+		if err := os.Mkdir(current, 0755); err != nil && !os.IsExist(err) {
+			return "", err
+		}
+		info, err := os.Lstat(current)
+		if err != nil {
+			return "", err
+		}
+		if !info.IsDir() {
+			return "", fmt.Errorf("artifact directory %s is not a directory", current)
+		}
+	}
+	return dir, nil
+}
+
+// withinDir reports whether path is dir or below it, both cleaned
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (d *DevOpsHelper) executeGitHubCaches(args []string, result *CommandResult) *CommandResult {
+	if d.GitHub == nil {
+		result.Success = false
+		result.Error = "GitHub service not initialized"
+		return result
+	}
+
+	if len(args) < 2 {
+		result.Success = false
+		result.Error = "Missing owner and repository arguments"
+		return result
+	}
+
+	caches, err := d.GitHub.ListCaches(args[0], args[1], optionalArg(args, 2))
+	if err != nil {
+		result.Success = false
+		result.Error = err.Error()
+		return result
+	}
+
+	var size int64
+	for _, cache := range caches {
+		size += cache.SizeInBytes
+	}
+
+	result.Success = true
+	result.Data = caches
+	result.Output = fmt.Sprintf("Found %d caches (%d bytes)", len(caches), size)
+	return result
+}
+
+func (d *DevOpsHelper) executeGitHubCacheDelete(args []string, result *CommandResult) *CommandResult {
+	if d.GitHub == nil {
+		result.Success = false
+		result.Error = "GitHub service not initialized"
+		return result
+	}
+
+	if len(args) < 3 {
+		result.Success = false
+		result.Error = "Missing owner, repository, and branch arguments"
+		return result
+	}
+
+	deleted, err := d.GitHub.DeleteBranchCaches(args[0], args[1], args[2], optionalArg(args, 3))
+	if err != nil {
+		result.Success = false
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Success = true
+	result.Output = fmt.Sprintf("Deleted %d caches", deleted)
+	return result
+}
+
+func (d *DevOpsHelper) executeGitHubSecrets(args []string, result *CommandResult) *CommandResult {
+	if d.GitHub == nil {
+		result.Success = false
+		result.Error = "GitHub service not initialized"
+		return result
+	}
+
+	if len(args) < 2 {
+		result.Success = false
+		result.Error = "Missing owner and repository arguments"
+		return result
+	}
+
+	secrets, err := d.GitHub.ListSecrets(args[0], args[1], optionalArg(args, 2))
+	if err != nil {
+		result.Success = false
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Success = true
+	result.Data = secrets
+	result.Output = fmt.Sprintf("Found %d secrets", len(secrets))
+	return result
+}
+
+func (d *DevOpsHelper) executeGitHubSecretSet(args []string, result *CommandResult) *CommandResult {
+	if d.GitHub == nil {
+		result.Success = false
+		result.Error = "GitHub service not initialized"
+		return result
+	}
+
+	if len(args) < 4 {
+		result.Success = false
+		result.Error = "Missing owner, repository, secret name, and value arguments"
+		return result
+	}
+
+	if err := d.GitHub.SetSecret(args[0], args[1], optionalArg(args, 4), args[2], args[3]); err != nil {
+		result.Success = false
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Success = true
+	result.Output = fmt.Sprintf("Secret %s updated successfully", args[2])
+	return result
+}
+
+func (d *DevOpsHelper) executeGitHubSecretDelete(args []string, result *CommandResult) *CommandResult {
+	if d.GitHub == nil {
+		result.Success = false
+		result.Error = "GitHub service not initialized"
+		return result
+	}
+
+	if len(args) < 3 {
+		result.Success = false
+		result.Error = "Missing owner, repository, and secret name arguments"
+		return result
+	}
+
+	if err := d.GitHub.DeleteSecret(args[0], args[1], optionalArg(args, 3), args[2]); err != nil {
+		result.Success = false
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Success = true
+	result.Output = fmt.Sprintf("Secret %s deleted successfully", args[2])
+	return result
+}
+
+func (d *DevOpsHelper) executeGitHubVariables(args []string, result *CommandResult) *CommandResult {
+	if d.GitHub == nil {
+		result.Success = false
+		result.Error = "GitHub service not initialized"
+		return result
+	}
+
+	if len(args) < 2 {
+		result.Success = false
+		result.Error = "Missing owner and repository arguments"
+		return result
+	}
+
+	variables, err := d.GitHub.ListVariables(args[0], args[1], optionalArg(args, 2))
+	if err != nil {
+		result.Success = false
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Success = true
+	result.Data = variables
+	result.Output = fmt.Sprintf("Found %d variables", len(variables))
+	return result
+}
+
+func (d *DevOpsHelper) executeGitHubVariableSet(args []string, result *CommandResult) *CommandResult {
+	if d.GitHub == nil {
+		result.Success = false
+		result.Error = "GitHub service not initialized"
+		return result
+	}
+
+	if len(args) < 4 {
+		result.Success = false
+		result.Error = "Missing owner, repository, variable name, and value arguments"
+		return result
+	}
+
+	if err := d.GitHub.SetVariable(args[0], args[1], optionalArg(args, 4), args[2], args[3]); err != nil {
+		result.Success = false
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Success = true
+	result.Output = fmt.Sprintf("Variable %s updated successfully", args[2])
+	return result
+}
+
+func (d *DevOpsHelper) executeGitHubVariableDelete(args []string, result *CommandResult) *CommandResult {
+	if d.GitHub == nil {
+		result.Success = false
+		result.Error = "GitHub service not initialized"
+		return result
+	}
+
+	if len(args) < 3 {
+		result.Success = false
+		result.Error = "Missing owner, repository, and variable name arguments"
+		return result
+	}
+
+	if err := d.GitHub.DeleteVariable(args[0], args[1], optionalArg(args, 3), args[2]); err != nil {
+		result.Success = false
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Success = true
+	result.Output = fmt.Sprintf("Variable %s deleted successfully", args[2])
+	return result
+}
+
+// optionalArg returns the argument at index i, or an empty string when it was not given
+func optionalArg(args []string, i int) string {
+	if len(args) > i {
+		return args[i]
+	}
+	return ""
+}
+
+// redactArgs masks secret values so they never reach logs or the command history
+func redactArgs(command string, args []string) []string {
+	if command != "github-secret-set" || len(args) < 4 {
+		return args
+	}
+
+	redacted := append([]string(nil), args...)
+	redacted[3] = "********"
+	return redacted
+}
+
 func (d *DevOpsHelper) executeToolStatus(result *CommandResult) *CommandResult {
 	statuses, err := d.CheckToolAvailability()
 	if err != nil {
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArtifactDirStaysInsideRoot(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	helper := &DevOpsHelper{ArtifactsDir: root}
+
+	for subdir, expected := range map[string]string{
+		"":         root,
+		"nightly":  filepath.Join(root, "nightly"),
+		"a/b":      filepath.Join(root, "a", "b"),
+		"a/../ok":  filepath.Join(root, "ok"),
+		"nightly/": filepath.Join(root, "nightly"),
+	} {
+		dir, err := helper.artifactDir(subdir)
+		if err != nil || dir != expected {
+			t.Errorf("%q: expected %s, got %s (%v)", subdir, expected, dir, err)
+		}
+	}
+
+	for _, subdir := range []string{"/etc", "../x", "a/../../x", "link", "link/sub"} {
+		if dir, err := helper.artifactDir(subdir); err == nil {
+			t.Errorf("%q: expected to be rejected, got %s", subdir, dir)
+		}
+	}
+
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("expected nothing to be created through the symlink, found %d entries", len(entries))
+	}
+}
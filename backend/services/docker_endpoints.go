@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+	"go.uber.org/zap"
+)
+
+// LocalDockerEndpoint is the name of the endpoint configured from the DOCKER_* environment
+const LocalDockerEndpoint = "local"
+
+// Timeout of the ping used to report endpoint health
+const dockerEndpointCheckTimeout = 5 * time.Second
+
+// ErrUnknownDockerEndpoint is returned when no endpoint is registered under a name
+var ErrUnknownDockerEndpoint = errors.New("unknown Docker endpoint")
+
+// DockerEndpointConfig describes a Docker engine reachable over a unix socket
+// (unix:///var/run/docker.sock), TCP (tcp://host:2376) or SSH (ssh://user@host:22)
+type DockerEndpointConfig struct {
+	Name string `json:"name"`
+	Host string `json:"host"`
+	// CertPath is a directory holding ca.pem, cert.pem and key.pem, like DOCKER_CERT_PATH
+	CertPath  string `json:"certPath,omitempty"`
+	TLSVerify bool   `json:"tlsVerify,omitempty"`
+}
+
+// DockerEndpointStatus reports whether an endpoint answers and which engine it runs
+type DockerEndpointStatus struct {
+	DockerEndpointConfig
+	Default    bool      `json:"default"`
+	Available  bool      `json:"available"`
+	Version    string    `json:"version,omitempty"`
+	APIVersion string    `json:"apiVersion,omitempty"`
+	OS         string    `json:"os,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+type dockerEndpoint struct {
+	config DockerEndpointConfig
+	client *client.Client
+}
+
+// DockerEndpoints keeps a client per named Docker engine so one IDE can manage
+// build agents and staging hosts next to the local daemon
+type DockerEndpoints struct {
+	Logger *zap.Logger
+
+	mu          sync.RWMutex
+	endpoints   map[string]*dockerEndpoint
+	defaultName string
+}
+
+// NewDockerEndpoints creates the endpoint registry with the local endpoint configured
+// from DOCKER_HOST, DOCKER_TLS_VERIFY and DOCKER_CERT_PATH as the default
+func NewDockerEndpoints(logger *zap.Logger) (*DockerEndpoints, error) {
+	local, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DockerEndpoints{
+		Logger: logger,
+		endpoints: map[string]*dockerEndpoint{
+			LocalDockerEndpoint: {
+				config: DockerEndpointConfig{Name: LocalDockerEndpoint, Host: local.DaemonHost()},
+				client: local,
+			},
+		},
+		defaultName: LocalDockerEndpoint,
+	}, nil
+}
+
+// Add registers an endpoint, replacing and closing an existing one with the same name
+func (d *DockerEndpoints) Add(config DockerEndpointConfig) error {
+	if config.Name == "" || config.Host == "" {
+		return fmt.Errorf("a Docker endpoint name and host are required")
+	}
+
+	dockerClient, err := newDockerEndpointClient(config)
+	if err != nil {
+		return fmt.Errorf("invalid Docker endpoint %s: %v", config.Name, err)
+	}
+
+	d.mu.Lock()
+	previous := d.endpoints[config.Name]
+	d.endpoints[config.Name] = &dockerEndpoint{config: config, client: dockerClient}
+	d.mu.Unlock()
+
+	if previous != nil {
+		previous.client.Close()
+	}
+
+	d.Logger.Info("Docker endpoint registered", zap.String("endpoint", config.Name), zap.String("host", config.Host))
+	return nil
+}
+
+// Remove closes and unregisters an endpoint, the default endpoint cannot be removed
+func (d *DockerEndpoints) Remove(name string) error {
+	d.mu.Lock()
+	endpoint, ok := d.endpoints[name]
+	if !ok {
+		d.mu.Unlock()
+		return ErrUnknownDockerEndpoint
+	}
+	if name == d.defaultName {
+		d.mu.Unlock()
+		return fmt.Errorf("the default Docker endpoint cannot be removed")
+	}
+	delete(d.endpoints, name)
+	d.mu.Unlock()
+
+	return endpoint.client.Close()
+}
+
+// SetDefault selects the endpoint used by requests that do not name one
+func (d *DockerEndpoints) SetDefault(name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.endpoints[name]; !ok {
+		return ErrUnknownDockerEndpoint
+	}
+	d.defaultName = name
+	return nil
+}
+
+// Client returns the client of an endpoint, or of the default endpoint for an empty name
+func (d *DockerEndpoints) Client(name string) (*client.Client, error) {
+	endpoint, err := d.get(name)
+	if err != nil {
+		return nil, err
+	}
+	return endpoint.client, nil
+}
+
+// Env returns the environment pointing the docker CLI at an endpoint
+func (d *DockerEndpoints) Env(name string) ([]string, error) {
+	endpoint, err := d.get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	env := []string{"DOCKER_HOST=" + endpoint.config.Host}
+	if endpoint.config.CertPath != "" {
+		env = append(env, "DOCKER_CERT_PATH="+endpoint.config.CertPath)
+	}
+	if endpoint.config.TLSVerify {
+		env = append(env, "DOCKER_TLS_VERIFY=1")
+	}
+	return env, nil
+}
+
+func (d *DockerEndpoints) get(name string) (*dockerEndpoint, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if name == "" {
+		name = d.defaultName
+	}
+
+	endpoint, ok := d.endpoints[name]
+	if !ok {
+		return nil, ErrUnknownDockerEndpoint
+	}
+	return endpoint, nil
+}
+
+// Check pings every endpoint concurrently and returns their status sorted by name
+func (d *DockerEndpoints) Check(ctx context.Context) []DockerEndpointStatus {
+	d.mu.RLock()
+	endpoints := make([]*dockerEndpoint, 0, len(d.endpoints))
+	for _, endpoint := range d.endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	defaultName := d.defaultName
+	d.mu.RUnlock()
+
+	statuses := make([]DockerEndpointStatus, len(endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func(i int, endpoint *dockerEndpoint) {
+			defer wg.Done()
+			statuses[i] = checkDockerEndpoint(ctx, endpoint)
+			statuses[i].Default = endpoint.config.Name == defaultName
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+func checkDockerEndpoint(ctx context.Context, endpoint *dockerEndpoint) DockerEndpointStatus {
+	status := DockerEndpointStatus{
+		DockerEndpointConfig: endpoint.config,
+		Timestamp:            time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dockerEndpointCheckTimeout)
+	defer cancel()
+
+	version, err := endpoint.client.ServerVersion(ctx)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	status.Available = true
+	status.Version = version.Version
+	status.APIVersion = version.APIVersion
+	status.OS = version.Os + "/" + version.Arch
+	return status
+}
+
+// Close closes the clients of all endpoints
+func (d *DockerEndpoints) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, endpoint := range d.endpoints {
+		endpoint.client.Close()
+	}
+}
+
+// newDockerEndpointClient builds a client for the transport given by the host scheme
+func newDockerEndpointClient(config DockerEndpointConfig) (*client.Client, error) {
+	hostURL, err := url.Parse(config.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []client.Opt{client.WithAPIVersionNegotiation()}
+
+	switch hostURL.Scheme {
+	case "unix", "npipe":
+		opts = append(opts, client.WithHost(config.Host))
+	case "tcp":
+		// TLS options go first, WithHost configures the transport they install
+		if config.CertPath != "" {
+			if config.TLSVerify {
+				opts = append(opts, client.WithTLSClientConfig(
+					filepath.Join(config.CertPath, "ca.pem"),
+					filepath.Join(config.CertPath, "cert.pem"),
+					filepath.Join(config.CertPath, "key.pem"),
+				))
+			} else {
+				opts = append(opts, withInsecureTLSClientConfig(config.CertPath))
+			}
+		}
+		opts = append(opts, client.WithHost(config.Host))
+	case "ssh":
+		dial, err := sshDialer(hostURL)
+		if err != nil {
+			return nil, err
+		}
+		// The host only names the daemon in requests, connections go through ssh
+		opts = append(opts, client.WithHost("http://docker.example.com"), client.WithDialContext(dial))
+	default:
+		return nil, fmt.Errorf("unsupported Docker host scheme %q", hostURL.Scheme)
+	}
+
+	return client.NewClientWithOpts(opts...)
+}
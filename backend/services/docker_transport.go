@@ -0,0 +1,169 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/tlsconfig"
+)
+
+// withInsecureTLSClientConfig presents the client certificate from certPath without
+// verifying the daemon certificate, matching DOCKER_CERT_PATH without DOCKER_TLS_VERIFY.
+// It must come before WithHost, which configures the transport it installs.
+func withInsecureTLSClientConfig(certPath string) client.Opt {
+	return func(c *client.Client) error {
+		config, err := tlsconfig.Client(tlsconfig.Options{
+			CertFile:           filepath.Join(certPath, "cert.pem"),
+			KeyFile:            filepath.Join(certPath, "key.pem"),
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create tls config: %v", err)
+		}
+
+		return client.WithHTTPClient(&http.Client{
+			Transport: &http.Transport{TLSClientConfig: config},
+			// Matches the redirect handling of the default Docker client
+			CheckRedirect: client.CheckRedirect,
+		})(c)
+	}
+}
+
+// sshDialer connects to the Docker daemon on a remote host through ssh, relaying the
+// API over stdin and stdout of docker system dial-stdio like the docker CLI does.
+// Authentication uses the ssh agent and ssh config of the user running the backend.
+func sshDialer(hostURL *url.URL) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	if hostURL.Hostname() == "" {
+		return nil, fmt.Errorf("no host specified in %s", hostURL)
+	}
+	if hostURL.Path != "" && hostURL.Path != "/" {
+		return nil, fmt.Errorf("extra path after the host in %s", hostURL)
+	}
+
+	args := []string{"-o", "BatchMode=yes"}
+	if user := hostURL.User.Username(); user != "" {
+		args = append(args, "-l", user)
+	}
+	if port := hostURL.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	args = append(args, "--", hostURL.Hostname(), "docker", "system", "dial-stdio")
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialCommand(exec.Command("ssh", args...))
+	}, nil
+}
+
+// commandConn is a net.Conn over the standard streams of a command
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+
+	waitOnce  sync.Once
+	closeOnce sync.Once
+}
+
+func dialCommand(cmd *exec.Cmd) (net.Conn, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &commandConn{cmd: cmd, stdin: stdin, stdout: stdout}
+	cmd.Stderr = &conn.stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %v", cmd.Path, err)
+	}
+
+	return conn, nil
+}
+
+// Read reports what the command printed on stderr when it exits early, e.g. an ssh
+// authentication failure, instead of a bare EOF
+func (c *commandConn) Read(p []byte) (int, error) {
+	n, err := c.stdout.Read(p)
+	if err == io.EOF {
+		c.wait()
+		if message := strings.TrimSpace(c.stderr.String()); message != "" {
+			return n, fmt.Errorf("%s exited: %s", filepath.Base(c.cmd.Path), message)
+		}
+	}
+	return n, err
+}
+
+func (c *commandConn) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+// CloseWrite half-closes the connection, used by hijacked attach and exec streams
+func (c *commandConn) CloseWrite() error {
+	return c.stdin.Close()
+}
+
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		c.stdout.Close()
+		if c.cmd.Process != nil {
+			c.cmd.Process.Kill()
+		}
+		c.wait()
+	})
+	return nil
+}
+
+// wait reaps the command once, which also finishes copying its stderr
+func (c *commandConn) wait() {
+	c.waitOnce.Do(func() {
+		c.cmd.Wait()
+	})
+}
+
+func (c *commandConn) LocalAddr() net.Addr {
+	return commandAddr{}
+}
+
+func (c *commandConn) RemoteAddr() net.Addr {
+	return commandAddr{}
+}
+
+// Deadlines are not supported on pipes, requests are bounded by their contexts instead
+func (c *commandConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *commandConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *commandConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+type commandAddr struct{}
+
+func (commandAddr) Network() string {
+	return "command"
+}
+
+func (commandAddr) String() string {
+	return "command"
+}
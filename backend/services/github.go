@@ -1,11 +1,10 @@
 package services
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -13,8 +12,26 @@ import (
 
 // GitHubService handles GitHub API integration
 type GitHubService struct {
-	Token  string
-	Logger *zap.Logger
+	// BaseURL is the REST API root, e.g. https://ghe.example.com/api/v3 for GitHub Enterprise Server
+	BaseURL string
+	Token   string
+	Logger  *zap.Logger
+
+	// Credentials overrides Token as the default authentication when set
+	Credentials GitHubCredentials
+
+	// MaxRetries bounds how often a rate limited request is retried
+	MaxRetries int
+	// MaxRateLimitWait is the longest a request will sleep waiting for quota
+	MaxRateLimitWait time.Duration
+
+	httpClient     *http.Client
+	mu             sync.Mutex
+	cache          map[string]*githubCacheEntry
+	orgCredentials map[string]GitHubCredentials
+	// rateLimits holds the quota last reported for each credential, keyed by quotaKey,
+	// since tokens, App installations and the App itself have separate quotas
+	rateLimits map[string]*RateLimit
 }
 
 // WorkflowRun represents a GitHub Actions workflow run
@@ -111,99 +128,80 @@ type WorkflowSummary struct {
 // NewGitHubService creates a new GitHub service instance
 func NewGitHubService(token string, logger *zap.Logger) *GitHubService {
 	return &GitHubService{
-		Token:  token,
-		Logger: logger,
+		BaseURL:          githubAPIURL,
+		Token:            token,
+		Logger:           logger,
+		MaxRetries:       3,
+		MaxRateLimitWait: 10 * time.Second,
+		httpClient:       &http.Client{Timeout: 30 * time.Second},
+		cache:            make(map[string]*githubCacheEntry),
+		orgCredentials:   make(map[string]GitHubCredentials),
+		rateLimits:       make(map[string]*RateLimit),
 	}
 }
 
 // GetWorkflowRuns retrieves workflow runs for a repository
 func (g *GitHubService) GetWorkflowRuns(owner, repo string, limit int) ([]WorkflowRun, error) {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/actions/runs?per_page=%d", owner, repo, limit)
+	url := fmt.Sprintf("%s/repos/%s/%s/actions/runs?per_page=%d", g.BaseURL, owner, repo, perPage(limit))
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
+	var runs []WorkflowRun
+	err := g.getPaginated(url, limit, func(body []byte) (int, error) {
+		var response struct {
+			WorkflowRuns []WorkflowRun `json:"workflow_runs"`
+			TotalCount   int           `json:"total_count"`
+		}
 
-	req.Header.Set("Authorization", fmt.Sprintf("token %s", g.Token))
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
+		if err := json.Unmarshal(body, &response); err != nil {
+			return 0, err
+		}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+		runs = append(runs, response.WorkflowRuns...)
+		return len(response.WorkflowRuns), nil
+	})
 	if err != nil {
 		g.Logger.Error("Failed to fetch workflow runs", zap.Error(err))
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("GitHub API request failed with status: %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var response struct {
-		WorkflowRuns []WorkflowRun `json:"workflow_runs"`
-		TotalCount   int           `json:"total_count"`
-	}
 
-	if err := json.Unmarshal(body, &response); err != nil {
-		return nil, err
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
 	}
 
 	g.Logger.Info("Successfully fetched workflow runs",
 		zap.String("repo", fmt.Sprintf("%s/%s", owner, repo)),
-		zap.Int("count", len(response.WorkflowRuns)))
+		zap.Int("count", len(runs)))
 
-	return response.WorkflowRuns, nil
+	return runs, nil
 }
 
 // GetWorkflows retrieves all workflows for a repository
 func (g *GitHubService) GetWorkflows(owner, repo string) ([]Workflow, error) {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/actions/workflows", owner, repo)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
+	url := fmt.Sprintf("%s/repos/%s/%s/actions/workflows?per_page=%d", g.BaseURL, owner, repo, githubMaxPerPage)
 
-	req.Header.Set("Authorization", fmt.Sprintf("token %s", g.Token))
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+	var workflows []Workflow
+	err := g.getPaginated(url, 0, func(body []byte) (int, error) {
+		var response struct {
+			Workflows  []Workflow `json:"workflows"`
+			TotalCount int        `json:"total_count"`
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("GitHub API request failed with status: %d", resp.StatusCode)
-	}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return 0, err
+		}
 
-	body, err := io.ReadAll(resp.Body)
+		workflows = append(workflows, response.Workflows...)
+		return len(response.Workflows), nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var response struct {
-		Workflows  []Workflow `json:"workflows"`
-		TotalCount int        `json:"total_count"`
-	}
-
-	if err := json.Unmarshal(body, &response); err != nil {
-		return nil, err
-	}
-
-	return response.Workflows, nil
+	return workflows, nil
 }
 
 // TriggerWorkflow triggers a workflow dispatch event
 func (g *GitHubService) TriggerWorkflow(owner, repo string, workflowID int64, ref string, inputs map[string]interface{}) error {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/actions/workflows/%d/dispatches", owner, repo, workflowID)
+	url := fmt.Sprintf("%s/repos/%s/%s/actions/workflows/%d/dispatches", g.BaseURL, owner, repo, workflowID)
 
 	payload := map[string]interface{}{
 		"ref": ref,
@@ -218,22 +216,11 @@ func (g *GitHubService) TriggerWorkflow(owner, repo string, workflowID int64, re
 		return err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	resp, err := g.do("POST", url, jsonData)
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("token %s", g.Token))
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
 	if resp.StatusCode != http.StatusNoContent {
 		return fmt.Errorf("workflow trigger failed with status: %d", resp.StatusCode)
 	}
@@ -247,75 +234,54 @@ func (g *GitHubService) TriggerWorkflow(owner, repo string, workflowID int64, re
 
 // GetWorkflowJobs retrieves jobs for a specific workflow run
 func (g *GitHubService) GetWorkflowJobs(owner, repo string, runID int64) ([]WorkflowJob, error) {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/actions/runs/%d/jobs", owner, repo, runID)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", fmt.Sprintf("token %s", g.Token))
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	url := fmt.Sprintf("%s/repos/%s/%s/actions/runs/%d/jobs?per_page=%d", g.BaseURL, owner, repo, runID, githubMaxPerPage)
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+	var jobs []WorkflowJob
+	err := g.getPaginated(url, 0, func(body []byte) (int, error) {
+		var response struct {
+			Jobs       []WorkflowJob `json:"jobs"`
+			TotalCount int           `json:"total_count"`
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("GitHub API request failed with status: %d", resp.StatusCode)
-	}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return 0, err
+		}
 
-	body, err := io.ReadAll(resp.Body)
+		jobs = append(jobs, response.Jobs...)
+		return len(response.Jobs), nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var response struct {
-		Jobs       []WorkflowJob `json:"jobs"`
-		TotalCount int           `json:"total_count"`
-	}
-
-	if err := json.Unmarshal(body, &response); err != nil {
-		return nil, err
-	}
-
-	return response.Jobs, nil
+	return jobs, nil
 }
 
-// GetRepositories retrieves repositories for the authenticated user
+// GetRepositories retrieves repositories for the authenticated user, or those of the
+// app installations when authenticated as a GitHub App
 func (g *GitHubService) GetRepositories(limit int) ([]Repository, error) {
-	url := fmt.Sprintf("https://api.github.com/user/repos?per_page=%d&sort=updated", limit)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
+	if app, ok := g.credentialsFor("").(*GitHubAppCredentials); ok {
+		return g.installationRepositories(app, limit)
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("token %s", g.Token))
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	url := fmt.Sprintf("%s/user/repos?per_page=%d&sort=updated", g.BaseURL, perPage(limit))
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("GitHub API request failed with status: %d", resp.StatusCode)
-	}
+	var repositories []Repository
+	err := g.getPaginated(url, limit, func(body []byte) (int, error) {
+		var page []Repository
+		if err := json.Unmarshal(body, &page); err != nil {
+			return 0, err
+		}
 
-	body, err := io.ReadAll(resp.Body)
+		repositories = append(repositories, page...)
+		return len(page), nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var repositories []Repository
-	if err := json.Unmarshal(body, &repositories); err != nil {
-		return nil, err
+	if limit > 0 && len(repositories) > limit {
+		repositories = repositories[:limit]
 	}
 
 	return repositories, nil
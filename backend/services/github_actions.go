@@ -0,0 +1,417 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// Artifact represents a file or collection of files uploaded by a workflow run
+type Artifact struct {
+	ID                 int64     `json:"id"`
+	Name               string    `json:"name"`
+	SizeInBytes        int64     `json:"size_in_bytes"`
+	URL                string    `json:"url"`
+	ArchiveDownloadURL string    `json:"archive_download_url"`
+	Expired            bool      `json:"expired"`
+	CreatedAt          time.Time `json:"created_at"`
+	ExpiresAt          time.Time `json:"expires_at"`
+	WorkflowRun        struct {
+		ID         int64  `json:"id"`
+		HeadBranch string `json:"head_branch"`
+		HeadSHA    string `json:"head_sha"`
+	} `json:"workflow_run"`
+}
+
+// ActionsCache represents an entry in a repository's GitHub Actions cache
+type ActionsCache struct {
+	ID             int64     `json:"id"`
+	Ref            string    `json:"ref"`
+	Key            string    `json:"key"`
+	Version        string    `json:"version"`
+	SizeInBytes    int64     `json:"size_in_bytes"`
+	LastAccessedAt time.Time `json:"last_accessed_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ActionsSecret represents secret metadata; GitHub never returns secret values
+type ActionsSecret struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ActionsVariable represents a configuration variable available to workflows
+type ActionsVariable struct {
+	Name      string    `json:"name"`
+	Value     string    `json:"value"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SecretsPublicKey is the libsodium key used to encrypt secrets before upload
+type SecretsPublicKey struct {
+	KeyID string `json:"key_id"`
+	Key   string `json:"key"`
+}
+
+// ListArtifacts retrieves the artifacts uploaded by a workflow run
+func (g *GitHubService) ListArtifacts(owner, repo string, runID int64) ([]Artifact, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/actions/runs/%d/artifacts?per_page=%d", g.BaseURL, owner, repo, runID, githubMaxPerPage)
+
+	var artifacts []Artifact
+	err := g.getPaginated(url, 0, func(body []byte) (int, error) {
+		var response struct {
+			Artifacts  []Artifact `json:"artifacts"`
+			TotalCount int        `json:"total_count"`
+		}
+
+		if err := json.Unmarshal(body, &response); err != nil {
+			return 0, err
+		}
+
+		artifacts = append(artifacts, response.Artifacts...)
+		return len(response.Artifacts), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return artifacts, nil
+}
+
+// DownloadArtifact streams the zip archive of an artifact to w and returns the number of bytes written
+func (g *GitHubService) DownloadArtifact(owner, repo string, artifactID int64, w io.Writer) (int64, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/actions/artifacts/%d/zip", g.BaseURL, owner, repo, artifactID)
+
+	authorization, err := g.credentialsFor(owner).AuthorizationHeader(g, owner)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	// The API redirects to blob storage; the Authorization header is not forwarded
+	client := &http.Client{Timeout: 10 * time.Minute, Transport: g.httpClient.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		g.Logger.Error("Failed to download artifact", zap.Error(err))
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	g.updateRateLimit(quotaKey(authorization), resp.Header)
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("artifact download failed with status: %d", resp.StatusCode)
+	}
+
+	written, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return written, err
+	}
+
+	g.Logger.Info("Successfully downloaded artifact",
+		zap.String("repo", fmt.Sprintf("%s/%s", owner, repo)),
+		zap.Int64("artifact_id", artifactID),
+		zap.Int64("bytes", written))
+
+	return written, nil
+}
+
+// ListCaches retrieves Actions caches for a repository, optionally restricted to a branch
+func (g *GitHubService) ListCaches(owner, repo, branch string) ([]ActionsCache, error) {
+	query := ""
+	if branch != "" {
+		query = "&ref=" + url.QueryEscape(branchRef(branch))
+	}
+	url := fmt.Sprintf("%s/repos/%s/%s/actions/caches?per_page=%d%s", g.BaseURL, owner, repo, githubMaxPerPage, query)
+
+	var caches []ActionsCache
+	err := g.getPaginated(url, 0, func(body []byte) (int, error) {
+		var response struct {
+			ActionsCaches []ActionsCache `json:"actions_caches"`
+			TotalCount    int            `json:"total_count"`
+		}
+
+		if err := json.Unmarshal(body, &response); err != nil {
+			return 0, err
+		}
+
+		caches = append(caches, response.ActionsCaches...)
+		return len(response.ActionsCaches), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return caches, nil
+}
+
+// DeleteCache deletes a single Actions cache by ID
+func (g *GitHubService) DeleteCache(owner, repo string, cacheID int64) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/actions/caches/%d", g.BaseURL, owner, repo, cacheID)
+
+	resp, err := g.do("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("cache deletion failed with status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// DeleteBranchCaches deletes the Actions caches of a branch, optionally only those
+// matching key, and returns the number of caches removed
+func (g *GitHubService) DeleteBranchCaches(owner, repo, branch, key string) (int, error) {
+	caches, err := g.ListCaches(owner, repo, branch)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, cache := range caches {
+		if key != "" && cache.Key != key {
+			continue
+		}
+		if err := g.DeleteCache(owner, repo, cache.ID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	g.Logger.Info("Deleted Actions caches",
+		zap.String("repo", fmt.Sprintf("%s/%s", owner, repo)),
+		zap.String("branch", branch),
+		zap.Int("count", deleted))
+
+	return deleted, nil
+}
+
+// GetSecretsPublicKey retrieves the key used to encrypt repository or environment secrets
+func (g *GitHubService) GetSecretsPublicKey(owner, repo, environment string) (*SecretsPublicKey, error) {
+	resp, err := g.get(fmt.Sprintf("%s/secrets/public-key", g.secretsScope(owner, repo, environment)))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub API request failed with status: %d", resp.StatusCode)
+	}
+
+	var key SecretsPublicKey
+	if err := json.Unmarshal(resp.Body, &key); err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// ListSecrets retrieves repository secrets, or environment secrets when environment is set
+func (g *GitHubService) ListSecrets(owner, repo, environment string) ([]ActionsSecret, error) {
+	url := fmt.Sprintf("%s/secrets?per_page=%d", g.secretsScope(owner, repo, environment), githubMaxPerPage)
+
+	var secrets []ActionsSecret
+	err := g.getPaginated(url, 0, func(body []byte) (int, error) {
+		var response struct {
+			Secrets    []ActionsSecret `json:"secrets"`
+			TotalCount int             `json:"total_count"`
+		}
+
+		if err := json.Unmarshal(body, &response); err != nil {
+			return 0, err
+		}
+
+		secrets = append(secrets, response.Secrets...)
+		return len(response.Secrets), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return secrets, nil
+}
+
+// SetSecret creates or updates a secret; the value is sealed with the
+// repository's public key so it never leaves the IDE in plain text
+func (g *GitHubService) SetSecret(owner, repo, environment, name, value string) error {
+	publicKey, err := g.GetSecretsPublicKey(owner, repo, environment)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := EncryptSecret(publicKey.Key, value)
+	if err != nil {
+		return err
+	}
+
+	jsonData, err := json.Marshal(map[string]string{
+		"encrypted_value": encrypted,
+		"key_id":          publicKey.KeyID,
+	})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/secrets/%s", g.secretsScope(owner, repo, environment), url.PathEscape(name))
+	resp, err := g.do("PUT", url, jsonData)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("secret update failed with status: %d", resp.StatusCode)
+	}
+
+	g.Logger.Info("Successfully updated secret",
+		zap.String("repo", fmt.Sprintf("%s/%s", owner, repo)),
+		zap.String("environment", environment),
+		zap.String("name", name))
+
+	return nil
+}
+
+// DeleteSecret deletes a repository or environment secret
+func (g *GitHubService) DeleteSecret(owner, repo, environment, name string) error {
+	url := fmt.Sprintf("%s/secrets/%s", g.secretsScope(owner, repo, environment), url.PathEscape(name))
+
+	resp, err := g.do("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("secret deletion failed with status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// ListVariables retrieves repository variables, or environment variables when environment is set
+func (g *GitHubService) ListVariables(owner, repo, environment string) ([]ActionsVariable, error) {
+	// The variables API caps page size at 30
+	url := fmt.Sprintf("%s/variables?per_page=30", g.secretsScope(owner, repo, environment))
+
+	var variables []ActionsVariable
+	err := g.getPaginated(url, 0, func(body []byte) (int, error) {
+		var response struct {
+			Variables  []ActionsVariable `json:"variables"`
+			TotalCount int               `json:"total_count"`
+		}
+
+		if err := json.Unmarshal(body, &response); err != nil {
+			return 0, err
+		}
+
+		variables = append(variables, response.Variables...)
+		return len(response.Variables), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return variables, nil
+}
+
+// SetVariable creates a variable, or updates it when it already exists
+func (g *GitHubService) SetVariable(owner, repo, environment, name, value string) error {
+	jsonData, err := json.Marshal(map[string]string{
+		"name":  name,
+		"value": value,
+	})
+	if err != nil {
+		return err
+	}
+
+	scope := g.secretsScope(owner, repo, environment)
+	resp, err := g.do("POST", fmt.Sprintf("%s/variables", scope), jsonData)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusConflict {
+		resp, err = g.do("PATCH", fmt.Sprintf("%s/variables/%s", scope, url.PathEscape(name)), jsonData)
+		if err != nil {
+			return err
+		}
+	}
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("variable update failed with status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// DeleteVariable deletes a repository or environment variable
+func (g *GitHubService) DeleteVariable(owner, repo, environment, name string) error {
+	url := fmt.Sprintf("%s/variables/%s", g.secretsScope(owner, repo, environment), url.PathEscape(name))
+
+	resp, err := g.do("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("variable deletion failed with status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// EncryptSecret seals value with a base64 encoded Curve25519 public key,
+// matching libsodium's crypto_box_seal as required by the GitHub secrets API
+func EncryptSecret(publicKey, value string) (string, error) {
+	keyBytes, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid secrets public key: %v", err)
+	}
+	if len(keyBytes) != 32 {
+		return "", errors.New("invalid secrets public key: expected 32 bytes")
+	}
+
+	var recipient [32]byte
+	copy(recipient[:], keyBytes)
+
+	sealed, err := box.SealAnonymous(nil, []byte(value), &recipient, rand.Reader)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// secretsScope returns the API path holding secrets and variables for a repository or one of its environments
+func (g *GitHubService) secretsScope(owner, repo, environment string) string {
+	if environment == "" {
+		return fmt.Sprintf("%s/repos/%s/%s/actions", g.BaseURL, owner, repo)
+	}
+	return fmt.Sprintf("%s/repos/%s/%s/environments/%s", g.BaseURL, owner, repo, url.PathEscape(environment))
+}
+
+// branchRef expands a branch name to a fully qualified ref
+func branchRef(branch string) string {
+	if strings.HasPrefix(branch, "refs/") {
+		return branch
+	}
+	return "refs/heads/" + branch
+}
@@ -0,0 +1,380 @@
+package services
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// githubTokenRenewWindow is how long before expiry an installation token is renewed
+const githubTokenRenewWindow = 5 * time.Minute
+
+// GitHubCredentials produces the Authorization header for requests made against an owner
+type GitHubCredentials interface {
+	AuthorizationHeader(g *GitHubService, owner string) (string, error)
+}
+
+// TokenCredentials authenticates with a personal access token
+type TokenCredentials struct {
+	Token string
+}
+
+// AuthorizationHeader implements GitHubCredentials
+func (t *TokenCredentials) AuthorizationHeader(g *GitHubService, owner string) (string, error) {
+	return fmt.Sprintf("token %s", t.Token), nil
+}
+
+// GitHubAppCredentials authenticates as a GitHub App installation. Installation
+// tokens are exchanged using a JWT signed with the app's private key and renewed
+// automatically before they expire. When InstallationID is zero the installation
+// is looked up per owner, so a single app can serve several organizations.
+type GitHubAppCredentials struct {
+	AppID          int64
+	InstallationID int64
+
+	privateKey    *rsa.PrivateKey
+	mu            sync.Mutex
+	installations map[string]int64
+	tokens        map[int64]*installationToken
+}
+
+// installationToken is a cached installation access token
+type installationToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewGitHubAppCredentials creates GitHub App credentials from a PEM encoded private key
+func NewGitHubAppCredentials(appID, installationID int64, privateKeyPEM []byte) (*GitHubAppCredentials, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, errors.New("invalid GitHub App private key: no PEM block found")
+	}
+
+	var privateKey *rsa.PrivateKey
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		privateKey = key
+	} else {
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GitHub App private key: %v", err)
+		}
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("invalid GitHub App private key: not an RSA key")
+		}
+		privateKey = rsaKey
+	}
+
+	return &GitHubAppCredentials{
+		AppID:          appID,
+		InstallationID: installationID,
+		privateKey:     privateKey,
+		installations:  make(map[string]int64),
+		tokens:         make(map[int64]*installationToken),
+	}, nil
+}
+
+// AuthorizationHeader implements GitHubCredentials. Requests without an owner, such as
+// /rate_limit, are sent as the app itself unless a fixed installation is configured.
+func (a *GitHubAppCredentials) AuthorizationHeader(g *GitHubService, owner string) (string, error) {
+	if owner == "" && a.InstallationID == 0 {
+		jwt, err := a.signJWT()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Bearer %s", jwt), nil
+	}
+
+	installationID, err := a.installationFor(g, owner)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := a.installationToken(g, installationID)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("token %s", token), nil
+}
+
+// Invalidate drops cached installation tokens so the next request renews them
+func (a *GitHubAppCredentials) Invalidate() {
+	a.mu.Lock()
+	a.tokens = make(map[int64]*installationToken)
+	a.mu.Unlock()
+}
+
+// installationFor resolves the installation of the app on the given owner
+func (a *GitHubAppCredentials) installationFor(g *GitHubService, owner string) (int64, error) {
+	if a.InstallationID != 0 {
+		return a.InstallationID, nil
+	}
+
+	a.mu.Lock()
+	id, ok := a.installations[owner]
+	a.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	// Organizations and user accounts expose their installation on different endpoints
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+	var lastErr error
+	for _, path := range []string{"orgs", "users"} {
+		body, status, err := a.appRequest(g, "GET", fmt.Sprintf("%s/%s/%s/installation", g.BaseURL, path, owner))
+		if err != nil {
+			return 0, err
+		}
+		if status != http.StatusOK {
+			lastErr = fmt.Errorf("GitHub App is not installed for %s (status: %d)", owner, status)
+			continue
+		}
+		if err := json.Unmarshal(body, &installation); err != nil {
+			return 0, err
+		}
+
+		a.mu.Lock()
+		a.installations[owner] = installation.ID
+		a.mu.Unlock()
+		return installation.ID, nil
+	}
+
+	return 0, lastErr
+}
+
+// installationIDs returns the configured installation, or every installation of the app
+func (a *GitHubAppCredentials) installationIDs(g *GitHubService) ([]int64, error) {
+	if a.InstallationID != 0 {
+		return []int64{a.InstallationID}, nil
+	}
+
+	body, status, err := a.appRequest(g, "GET", fmt.Sprintf("%s/app/installations?per_page=%d", g.BaseURL, githubMaxPerPage))
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("GitHub App installations request failed with status: %d", status)
+	}
+
+	var installations []struct {
+		ID      int64 `json:"id"`
+		Account struct {
+			Login string `json:"login"`
+		} `json:"account"`
+	}
+	if err := json.Unmarshal(body, &installations); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(installations))
+	a.mu.Lock()
+	for _, installation := range installations {
+		a.installations[installation.Account.Login] = installation.ID
+		ids = append(ids, installation.ID)
+	}
+	a.mu.Unlock()
+	return ids, nil
+}
+
+// installationToken returns a valid access token for the installation, exchanging a new one when needed
+func (a *GitHubAppCredentials) installationToken(g *GitHubService, installationID int64) (string, error) {
+	a.mu.Lock()
+	cached := a.tokens[installationID]
+	a.mu.Unlock()
+
+	if cached != nil && time.Until(cached.ExpiresAt) > githubTokenRenewWindow {
+		return cached.Token, nil
+	}
+
+	url := fmt.Sprintf("%s/app/installations/%d/access_tokens", g.BaseURL, installationID)
+	body, status, err := a.appRequest(g, "POST", url)
+	if err != nil {
+		return "", err
+	}
+
+	if status != http.StatusCreated {
+		return "", fmt.Errorf("installation token request failed with status: %d", status)
+	}
+
+	var token installationToken
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", err
+	}
+
+	a.mu.Lock()
+	a.tokens[installationID] = &token
+	a.mu.Unlock()
+
+	return token.Token, nil
+}
+
+// appRequest sends a request authenticated as the app itself using a signed JWT
+func (a *GitHubAppCredentials) appRequest(g *GitHubService, method, url string) ([]byte, int, error) {
+	jwt, err := a.signJWT()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", jwt))
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return body, resp.StatusCode, nil
+}
+
+// signJWT creates the short lived RS256 token GitHub expects from an app
+func (a *GitHubAppCredentials) signJWT() (string, error) {
+	now := time.Now()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	// Backdate issued-at to tolerate clock drift; GitHub caps expiry at ten minutes
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-60 * time.Second).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": fmt.Sprintf("%d", a.AppID),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// installationCredentials authenticates as one installation of an app, for endpoints
+// such as /installation/repositories whose URL does not name the owner
+type installationCredentials struct {
+	app *GitHubAppCredentials
+	id  int64
+}
+
+// AuthorizationHeader implements GitHubCredentials
+func (c *installationCredentials) AuthorizationHeader(g *GitHubService, owner string) (string, error) {
+	token, err := c.app.installationToken(g, c.id)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("token %s", token), nil
+}
+
+// Invalidate drops the cached installation tokens of the app
+func (c *installationCredentials) Invalidate() {
+	c.app.Invalidate()
+}
+
+// installationRepositories lists the repositories the app can access. Installation
+// tokens cannot use /user/repos, so each installation is asked for its repositories.
+func (g *GitHubService) installationRepositories(app *GitHubAppCredentials, limit int) ([]Repository, error) {
+	ids, err := app.installationIDs(g)
+	if err != nil {
+		return nil, err
+	}
+
+	var repositories []Repository
+	for _, id := range ids {
+		remaining := 0
+		if limit > 0 {
+			if remaining = limit - len(repositories); remaining <= 0 {
+				break
+			}
+		}
+
+		url := fmt.Sprintf("%s/installation/repositories?per_page=%d", g.BaseURL, perPage(remaining))
+		err := g.getPaginatedWith(&installationCredentials{app: app, id: id}, url, remaining, func(body []byte) (int, error) {
+			var page struct {
+				Repositories []Repository `json:"repositories"`
+			}
+			if err := json.Unmarshal(body, &page); err != nil {
+				return 0, err
+			}
+
+			repositories = append(repositories, page.Repositories...)
+			return len(page.Repositories), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if limit > 0 && len(repositories) > limit {
+		repositories = repositories[:limit]
+	}
+	return repositories, nil
+}
+
+// SetOrgCredentials registers credentials used for requests against a specific owner
+func (g *GitHubService) SetOrgCredentials(owner string, credentials GitHubCredentials) {
+	g.mu.Lock()
+	g.orgCredentials[strings.ToLower(owner)] = credentials
+	g.mu.Unlock()
+}
+
+// credentialsFor picks the credentials for an owner, falling back to the defaults
+func (g *GitHubService) credentialsFor(owner string) GitHubCredentials {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if credentials, ok := g.orgCredentials[strings.ToLower(owner)]; ok && owner != "" {
+		return credentials
+	}
+	if g.Credentials != nil {
+		return g.Credentials
+	}
+	return &TokenCredentials{Token: g.Token}
+}
+
+// ownerFromURL extracts the repository or organization owner from an API URL
+func (g *GitHubService) ownerFromURL(url string) string {
+	path := strings.TrimPrefix(url, g.BaseURL)
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) >= 2 && (parts[0] == "repos" || parts[0] == "orgs" || parts[0] == "users") {
+		return parts[1]
+	}
+	return ""
+}
@@ -0,0 +1,330 @@
+package services
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeGitHub stands in for the GitHub API, recording the Authorization header of
+// every request by path
+type fakeGitHub struct {
+	// URL is the API root, served under /api/v3 like GitHub Enterprise Server
+	URL string
+
+	t   *testing.T
+	key *rsa.PublicKey
+
+	mu             sync.Mutex
+	authorizations map[string][]string
+	exchanges      int
+	tokenLifetime  time.Duration
+	// remaining is the core quota left per Authorization header, 5000 when unset
+	remaining map[string]int
+	// notModified counts conditional requests answered with 304
+	notModified int
+}
+
+func newFakeGitHub(t *testing.T, key *rsa.PublicKey) *fakeGitHub {
+	fake := &fakeGitHub{t: t, key: key, authorizations: make(map[string][]string), tokenLifetime: time.Hour, remaining: make(map[string]int)}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/v3/", http.StripPrefix("/api/v3", http.HandlerFunc(fake.serve)))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	fake.URL = server.URL + "/api/v3"
+	return fake
+}
+
+func (f *fakeGitHub) serve(w http.ResponseWriter, r *http.Request) {
+	authorization := r.Header.Get("Authorization")
+	f.mu.Lock()
+	f.authorizations[r.URL.Path] = append(f.authorizations[r.URL.Path], authorization)
+	f.mu.Unlock()
+
+	path := r.URL.Path
+	switch {
+	case path == "/app/installations/42/access_tokens" && r.Method == "POST":
+		f.verifyAppJWT(authorization)
+		f.mu.Lock()
+		f.exchanges++
+		token := fmt.Sprintf("installation-token-%d", f.exchanges)
+		lifetime := f.tokenLifetime
+		f.mu.Unlock()
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"token": token, "expires_at": time.Now().Add(lifetime)})
+	case path == "/app/installations":
+		f.verifyAppJWT(authorization)
+		json.NewEncoder(w).Encode([]map[string]interface{}{{"id": 42, "account": map[string]string{"login": "acme"}}})
+	case path == "/orgs/acme/installation":
+		f.verifyAppJWT(authorization)
+		json.NewEncoder(w).Encode(map[string]int64{"id": 42})
+	case path == "/installation/repositories":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"total_count":  1,
+			"repositories": []map[string]interface{}{{"id": 1, "name": "api", "full_name": "acme/api"}},
+		})
+	case path == "/rate_limit":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"resources": map[string]interface{}{"core": map[string]int64{"limit": 5000, "remaining": 4999}},
+		})
+	case strings.HasPrefix(path, "/repos/"):
+		f.serveRepository(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveRepository answers repository endpoints with the quota headers of the caller's
+// token. Reviews of pull request 1 come in three pages of two with an ETag per page.
+func (f *fakeGitHub) serveRepository(w http.ResponseWriter, r *http.Request) {
+	authorization := r.Header.Get("Authorization")
+
+	var page int
+	var etag string
+	reviews := r.URL.Path == "/repos/acme/api/pulls/1/reviews"
+	if reviews {
+		page, _ = strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		etag = fmt.Sprintf(`"reviews-%d"`, page)
+	}
+
+	f.mu.Lock()
+	remaining, ok := f.remaining[authorization]
+	if !ok {
+		remaining = 5000
+	}
+	// Conditional requests answered with 304 do not count against the quota
+	notModified := etag != "" && r.Header.Get("If-None-Match") == etag
+	exhausted := remaining == 0
+	switch {
+	case notModified:
+		f.notModified++
+	case !exhausted:
+		remaining--
+	}
+	f.remaining[authorization] = remaining
+	f.mu.Unlock()
+
+	w.Header().Set("X-RateLimit-Limit", "5000")
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+	w.Header().Set("X-RateLimit-Resource", "core")
+
+	switch {
+	case notModified:
+		w.WriteHeader(http.StatusNotModified)
+	case exhausted:
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"message": "API rate limit exceeded"})
+	case reviews:
+		if page < 3 {
+			next := fmt.Sprintf("%s%s?per_page=2&page=%d", f.URL, r.URL.Path, page+1)
+			last := fmt.Sprintf("%s%s?per_page=2&page=3", f.URL, r.URL.Path)
+			w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next", <%s>; rel="last"`, next, last))
+		}
+		w.Header().Set("ETag", etag)
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"id": page*2 - 1, "state": "COMMENTED", "user": map[string]string{"login": "alice"}},
+			{"id": page * 2, "state": "APPROVED", "user": map[string]string{"login": "bob"}},
+		})
+	default:
+		json.NewEncoder(w).Encode(map[string]interface{}{"total_count": 0, "workflows": []interface{}{}})
+	}
+}
+
+// verifyAppJWT checks that a request is authenticated as the app with a valid RS256 JWT
+func (f *fakeGitHub) verifyAppJWT(authorization string) {
+	f.t.Helper()
+
+	token := strings.TrimPrefix(authorization, "Bearer ")
+	parts := strings.Split(token, ".")
+	if token == authorization || len(parts) != 3 {
+		f.t.Errorf("expected an app JWT, got %q", authorization)
+		return
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		f.t.Errorf("invalid JWT signature encoding: %v", err)
+		return
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(f.key, crypto.SHA256, digest[:], signature); err != nil {
+		f.t.Errorf("app JWT signature does not verify: %v", err)
+	}
+
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims struct {
+		Iss string `json:"iss"`
+		Exp int64  `json:"exp"`
+	}
+	json.Unmarshal(payload, &claims)
+	if claims.Iss != "7" {
+		f.t.Errorf("expected issuer 7, got %q", claims.Iss)
+	}
+	if exp := time.Unix(claims.Exp, 0); time.Until(exp) > 10*time.Minute {
+		f.t.Errorf("app JWT expires too late: %s", exp)
+	}
+}
+
+func (f *fakeGitHub) seen(path string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.authorizations[path]...)
+}
+
+func newTestAppKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+// newTestHelper configures GitHub like the backend does at startup
+func newTestHelper(t *testing.T, config map[string]interface{}) *DevOpsHelper {
+	t.Helper()
+
+	helper := &DevOpsHelper{Logger: zap.NewNop(), GitHub: NewGitHubService("default-token", zap.NewNop())}
+	if err := helper.configureGitHub(config); err != nil {
+		t.Fatal(err)
+	}
+	return helper
+}
+
+func TestGitHubEnterpriseBaseURL(t *testing.T) {
+	key, _ := newTestAppKey(t)
+	fake := newFakeGitHub(t, &key.PublicKey)
+
+	helper := newTestHelper(t, map[string]interface{}{"api_url": fake.URL + "/"})
+	if helper.GitHub.BaseURL != fake.URL {
+		t.Fatalf("expected the trailing slash to be trimmed, got %s", helper.GitHub.BaseURL)
+	}
+
+	if _, err := helper.GitHub.GetWorkflows("acme", "api"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.seen("/repos/acme/api/actions/workflows"); len(got) != 1 || got[0] != "token default-token" {
+		t.Fatalf("expected one request with the default token under /api/v3, got %v", got)
+	}
+}
+
+func TestGitHubAppInstallationTokenExchange(t *testing.T) {
+	key, keyPEM := newTestAppKey(t)
+	fake := newFakeGitHub(t, &key.PublicKey)
+
+	keyPath := filepath.Join(t.TempDir(), "app.pem")
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	helper := newTestHelper(t, map[string]interface{}{
+		"api_url":              fake.URL,
+		"app_id":               "7",
+		"app_private_key_path": keyPath,
+	})
+	github := helper.GitHub
+
+	// The installation is resolved from the owner and its token reused while valid
+	for i := 0; i < 2; i++ {
+		if _, err := github.GetWorkflows("acme", "api"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fake.seen("/repos/acme/api/actions/workflows"); len(got) != 2 || got[0] != "token installation-token-1" || got[1] != got[0] {
+		t.Fatalf("expected the first installation token on both requests, got %v", got)
+	}
+	if got := fake.seen("/orgs/acme/installation"); len(got) != 1 {
+		t.Fatalf("expected the installation to be looked up once, got %d lookups", len(got))
+	}
+
+	// Tokens within the renewal window are exchanged again before use
+	fake.mu.Lock()
+	fake.tokenLifetime = time.Minute
+	fake.mu.Unlock()
+	github.Credentials.(*GitHubAppCredentials).Invalidate()
+	for i := 0; i < 2; i++ {
+		if _, err := github.GetWorkflows("acme", "api"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fake.seen("/repos/acme/api/actions/workflows"); got[2] != "token installation-token-2" || got[3] != "token installation-token-3" {
+		t.Fatalf("expected tokens close to expiry to be renewed, got %v", got[2:])
+	}
+
+	// Requests without an owner are made as the app rather than failing
+	if _, err := github.GetRateLimit(); err != nil {
+		t.Fatal(err)
+	}
+	fake.verifyAppJWT(fake.seen("/rate_limit")[0])
+
+	repositories, err := github.GetRepositories(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repositories) != 1 || repositories[0].FullName != "acme/api" {
+		t.Fatalf("expected the installation repositories, got %+v", repositories)
+	}
+	if got := fake.seen("/installation/repositories"); len(got) != 1 || !strings.HasPrefix(got[0], "token installation-token-") {
+		t.Fatalf("expected the repositories to be listed with an installation token, got %v", got)
+	}
+}
+
+func TestGitHubPerOrgCredentials(t *testing.T) {
+	key, _ := newTestAppKey(t)
+	fake := newFakeGitHub(t, &key.PublicKey)
+
+	helper := newTestHelper(t, map[string]interface{}{
+		"api_url":    fake.URL,
+		"org_tokens": "Acme=acme-token, globex=globex-token",
+	})
+
+	for _, owner := range []string{"acme", "globex", "initech"} {
+		if _, err := helper.GitHub.GetWorkflows(owner, "api"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[string]string{
+		"acme":    "token acme-token",
+		"globex":  "token globex-token",
+		"initech": "token default-token",
+	}
+	for owner, authorization := range expected {
+		if got := fake.seen("/repos/" + owner + "/api/actions/workflows"); len(got) != 1 || got[0] != authorization {
+			t.Errorf("%s: expected %q, got %v", owner, authorization, got)
+		}
+	}
+
+	if err := newTestHelperError(map[string]interface{}{"org_tokens": "acme"}); err == nil {
+		t.Error("expected an org token entry without a token to be rejected")
+	}
+}
+
+func newTestHelperError(config map[string]interface{}) error {
+	helper := &DevOpsHelper{Logger: zap.NewNop(), GitHub: NewGitHubService("", zap.NewNop())}
+	return helper.configureGitHub(config)
+}
@@ -0,0 +1,437 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// githubAPIURL is the default base URL, pointing at the public GitHub REST API
+	githubAPIURL = "https://api.github.com"
+
+	// githubMaxPerPage is the largest page size accepted by the GitHub API
+	githubMaxPerPage = 100
+
+	// githubCacheSize bounds the number of conditional request entries kept in memory
+	githubCacheSize = 500
+)
+
+// githubLinkPattern matches a single entry of a GitHub Link header
+var githubLinkPattern = regexp.MustCompile(`<([^>]+)>;\s*rel="([^"]+)"`)
+
+// RateLimit represents the GitHub API quota reported by the X-RateLimit-* headers
+type RateLimit struct {
+	Resource  string    `json:"resource,omitempty"`
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Used      int       `json:"used"`
+	Reset     time.Time `json:"reset"`
+}
+
+// RateLimitError is returned when a request cannot be served before the quota resets
+type RateLimitError struct {
+	Reset     time.Time
+	Secondary bool
+}
+
+func (e *RateLimitError) Error() string {
+	kind := "primary"
+	if e.Secondary {
+		kind = "secondary"
+	}
+	return fmt.Sprintf("GitHub API %s rate limit exceeded, retry after %s", kind, e.Reset.Format(time.RFC3339))
+}
+
+// githubCacheEntry holds a response body together with its validators
+type githubCacheEntry struct {
+	etag         string
+	lastModified string
+	link         string
+	body         []byte
+	storedAt     time.Time
+}
+
+// githubResponse is the decoded outcome of a GitHub API call
+type githubResponse struct {
+	StatusCode int
+	Body       []byte
+	Link       string
+	FromCache  bool
+}
+
+// get performs a conditional GET request against the GitHub API
+func (g *GitHubService) get(url string) (*githubResponse, error) {
+	return g.do("GET", url, nil)
+}
+
+// renewableCredentials hold tokens that can be renewed when GitHub rejects them
+type renewableCredentials interface {
+	Invalidate()
+}
+
+// do sends a request to the GitHub API, serving unchanged GET responses from
+// the ETag cache and backing off when the primary or secondary rate limit is hit
+func (g *GitHubService) do(method, url string, payload []byte) (*githubResponse, error) {
+	owner := g.ownerFromURL(url)
+	return g.doWith(g.credentialsFor(owner), owner, method, url, payload)
+}
+
+// doWith sends a request like do, authenticated with the given credentials
+func (g *GitHubService) doWith(credentials GitHubCredentials, owner, method, url string, payload []byte) (*githubResponse, error) {
+	var cached *githubCacheEntry
+	if method == "GET" {
+		g.mu.Lock()
+		cached = g.cache[url]
+		g.mu.Unlock()
+	}
+
+	// Rate limit lookups are free and must keep working while the quota is exhausted
+	checkQuota := !strings.HasSuffix(url, "/rate_limit")
+	renewed := false
+
+	for attempt := 0; ; attempt++ {
+		authorization, err := credentials.AuthorizationHeader(g, owner)
+		if err != nil {
+			return nil, err
+		}
+		quota := quotaKey(authorization)
+
+		if checkQuota {
+			if err := g.waitForQuota(quota); err != nil {
+				return nil, err
+			}
+		}
+
+		var body io.Reader
+		if payload != nil {
+			body = bytes.NewReader(payload)
+		}
+
+		req, err := http.NewRequest(method, url, body)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", authorization)
+		req.Header.Set("Accept", "application/vnd.github.v3+json")
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if cached != nil {
+			if cached.etag != "" {
+				req.Header.Set("If-None-Match", cached.etag)
+			}
+			if cached.lastModified != "" {
+				req.Header.Set("If-Modified-Since", cached.lastModified)
+			}
+		}
+
+		resp, err := g.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		g.updateRateLimit(quota, resp.Header)
+
+		if resp.StatusCode == http.StatusNotModified && cached != nil {
+			return &githubResponse{
+				StatusCode: http.StatusOK,
+				Body:       cached.body,
+				Link:       cached.link,
+				FromCache:  true,
+			}, nil
+		}
+
+		// An installation token may be revoked before its expiry; renew it once
+		if renewable, ok := credentials.(renewableCredentials); ok && resp.StatusCode == http.StatusUnauthorized && !renewed {
+			renewable.Invalidate()
+			renewed = true
+			continue
+		}
+
+		if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests {
+			wait, rateErr := g.rateLimitBackoff(resp, respBody, attempt)
+			if rateErr != nil {
+				return nil, rateErr
+			}
+			if wait >= 0 {
+				g.Logger.Warn("GitHub API rate limit hit, backing off",
+					zap.String("url", url),
+					zap.Duration("wait", wait),
+					zap.Int("attempt", attempt+1))
+				time.Sleep(wait)
+				continue
+			}
+		}
+
+		if method == "GET" && resp.StatusCode == http.StatusOK {
+			g.storeCache(url, resp.Header, respBody)
+		}
+
+		return &githubResponse{
+			StatusCode: resp.StatusCode,
+			Body:       respBody,
+			Link:       resp.Header.Get("Link"),
+		}, nil
+	}
+}
+
+// getPaginated follows Link rel="next" headers starting at url until limit
+// items have been collected; page decodes one response body and returns the
+// number of items it contained. A limit of zero or less fetches every page.
+func (g *GitHubService) getPaginated(url string, limit int, page func(body []byte) (int, error)) error {
+	return g.getPaginatedWith(nil, url, limit, page)
+}
+
+// getPaginatedWith pages like getPaginated, authenticated with the given credentials
+// rather than those of the owner in the URL when they are not nil
+func (g *GitHubService) getPaginatedWith(credentials GitHubCredentials, url string, limit int, page func(body []byte) (int, error)) error {
+	total := 0
+	for url != "" {
+		var resp *githubResponse
+		var err error
+		if credentials == nil {
+			resp, err = g.get(url)
+		} else {
+			resp, err = g.doWith(credentials, "", "GET", url, nil)
+		}
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("GitHub API request failed with status: %d", resp.StatusCode)
+		}
+
+		count, err := page(resp.Body)
+		if err != nil {
+			return err
+		}
+
+		total += count
+		if count == 0 || (limit > 0 && total >= limit) {
+			break
+		}
+
+		url = parseLinkHeader(resp.Link)["next"]
+	}
+
+	return nil
+}
+
+// GetRateLimit retrieves the current core API quota; this call does not count against it
+func (g *GitHubService) GetRateLimit() (*RateLimit, error) {
+	resp, err := g.do("GET", fmt.Sprintf("%s/rate_limit", g.BaseURL), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub API request failed with status: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Resources struct {
+			Core struct {
+				Limit     int   `json:"limit"`
+				Remaining int   `json:"remaining"`
+				Used      int   `json:"used"`
+				Reset     int64 `json:"reset"`
+			} `json:"core"`
+		} `json:"resources"`
+	}
+
+	if err := json.Unmarshal(resp.Body, &response); err != nil {
+		return nil, err
+	}
+
+	core := response.Resources.Core
+	return &RateLimit{
+		Resource:  "core",
+		Limit:     core.Limit,
+		Remaining: core.Remaining,
+		Used:      core.Used,
+		Reset:     time.Unix(core.Reset, 0),
+	}, nil
+}
+
+// quotaKey identifies the quota a request is counted against by its Authorization
+// header, hashed so tokens are not kept around as map keys
+func quotaKey(authorization string) string {
+	sum := sha256.Sum256([]byte(authorization))
+	return hex.EncodeToString(sum[:16])
+}
+
+// rateLimitFor returns the quota last reported for a credential, if any
+func (g *GitHubService) rateLimitFor(quota string) *RateLimit {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	rateLimit, ok := g.rateLimits[quota]
+	if !ok {
+		return nil
+	}
+	copied := *rateLimit
+	return &copied
+}
+
+// waitForQuota blocks until the core quota of a credential resets when its last
+// response reported it exhausted, or fails fast if the reset is too far away
+func (g *GitHubService) waitForQuota(quota string) error {
+	rateLimit := g.rateLimitFor(quota)
+	if rateLimit == nil || rateLimit.Remaining > 0 || rateLimit.Resource == "search" {
+		return nil
+	}
+
+	wait := time.Until(rateLimit.Reset)
+	if wait <= 0 {
+		return nil
+	}
+	if wait > g.MaxRateLimitWait {
+		return &RateLimitError{Reset: rateLimit.Reset}
+	}
+
+	g.Logger.Warn("GitHub API quota exhausted, waiting for reset", zap.Duration("wait", wait))
+	time.Sleep(wait)
+	return nil
+}
+
+// rateLimitBackoff inspects a 403/429 response and returns how long to wait
+// before retrying. A negative duration means the response is not rate limit
+// related and should be returned to the caller as is.
+func (g *GitHubService) rateLimitBackoff(resp *http.Response, body []byte, attempt int) (time.Duration, error) {
+	// Secondary rate limits advertise Retry-After or mention it in the message
+	secondary := resp.Header.Get("Retry-After") != "" ||
+		strings.Contains(strings.ToLower(string(body)), "secondary rate limit")
+	primary := resp.Header.Get("X-RateLimit-Remaining") == "0"
+
+	if !primary && !secondary {
+		return -1, nil
+	}
+
+	var wait time.Duration
+	switch {
+	case resp.Header.Get("Retry-After") != "":
+		seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+		if err != nil {
+			seconds = 60
+		}
+		wait = time.Duration(seconds) * time.Second
+	case primary:
+		reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+		if err != nil {
+			wait = time.Minute
+		} else {
+			wait = time.Until(time.Unix(reset, 0))
+		}
+	default:
+		// Exponential backoff when no hint is given for a secondary limit
+		wait = time.Duration(1<<attempt) * time.Second
+	}
+
+	if wait < 0 {
+		wait = 0
+	}
+
+	if attempt >= g.MaxRetries || wait > g.MaxRateLimitWait {
+		return 0, &RateLimitError{Reset: time.Now().Add(wait), Secondary: !primary}
+	}
+
+	return wait, nil
+}
+
+// updateRateLimit records the quota advertised in the response headers for a credential.
+// Quotas past their reset are dropped, so renewed installation tokens do not pile up.
+func (g *GitHubService) updateRateLimit(quota string, header http.Header) {
+	if header.Get("X-RateLimit-Limit") == "" {
+		return
+	}
+
+	limit, _ := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	remaining, _ := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	used, _ := strconv.Atoi(header.Get("X-RateLimit-Used"))
+	reset, _ := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+
+	now := time.Now()
+	g.mu.Lock()
+	for key, rateLimit := range g.rateLimits {
+		if rateLimit.Reset.Before(now) {
+			delete(g.rateLimits, key)
+		}
+	}
+	g.rateLimits[quota] = &RateLimit{
+		Resource:  header.Get("X-RateLimit-Resource"),
+		Limit:     limit,
+		Remaining: remaining,
+		Used:      used,
+		Reset:     time.Unix(reset, 0),
+	}
+	g.mu.Unlock()
+}
+
+// storeCache remembers a response so the next request for url can be made conditional
+func (g *GitHubService) storeCache(url string, header http.Header, body []byte) {
+	etag := header.Get("ETag")
+	lastModified := header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, exists := g.cache[url]; !exists && len(g.cache) >= githubCacheSize {
+		// Evict the oldest entry to keep the cache bounded
+		var oldestURL string
+		var oldest time.Time
+		for key, entry := range g.cache {
+			if oldestURL == "" || entry.storedAt.Before(oldest) {
+				oldestURL = key
+				oldest = entry.storedAt
+			}
+		}
+		delete(g.cache, oldestURL)
+	}
+
+	g.cache[url] = &githubCacheEntry{
+		etag:         etag,
+		lastModified: lastModified,
+		link:         header.Get("Link"),
+		body:         body,
+		storedAt:     time.Now(),
+	}
+}
+
+// parseLinkHeader maps each rel of a GitHub Link header to its URL
+func parseLinkHeader(header string) map[string]string {
+	links := make(map[string]string)
+	for _, match := range githubLinkPattern.FindAllStringSubmatch(header, -1) {
+		links[match[2]] = match[1]
+	}
+	return links
+}
+
+// perPage clamps a requested item limit to a valid GitHub page size
+func perPage(limit int) int {
+	if limit <= 0 || limit > githubMaxPerPage {
+		return githubMaxPerPage
+	}
+	return limit
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseLinkHeader(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected map[string]string
+	}{
+		{"", map[string]string{}},
+		{
+			`<https://api.github.com/repositories/1/pulls?page=2>; rel="next", <https://api.github.com/repositories/1/pulls?page=5>; rel="last"`,
+			map[string]string{
+				"next": "https://api.github.com/repositories/1/pulls?page=2",
+				"last": "https://api.github.com/repositories/1/pulls?page=5",
+			},
+		},
+		{
+			`<https://ghe.example.com/api/v3/repos/a/b/issues?per_page=100&page=1>; rel="prev",<https://ghe.example.com/api/v3/repos/a/b/issues?per_page=100&page=1>;rel="first"`,
+			map[string]string{
+				"prev":  "https://ghe.example.com/api/v3/repos/a/b/issues?per_page=100&page=1",
+				"first": "https://ghe.example.com/api/v3/repos/a/b/issues?per_page=100&page=1",
+			},
+		},
+		{`<https://api.github.com/search/code?q=a,b&page=3>; rel="next"`, map[string]string{"next": "https://api.github.com/search/code?q=a,b&page=3"}},
+	}
+
+	for _, test := range tests {
+		if links := parseLinkHeader(test.header); !reflect.DeepEqual(links, test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.header, test.expected, links)
+		}
+	}
+}
+
+func TestGitHubPagination(t *testing.T) {
+	key, _ := newTestAppKey(t)
+	fake := newFakeGitHub(t, &key.PublicKey)
+	github := newTestHelper(t, map[string]interface{}{"api_url": fake.URL}).GitHub
+
+	reviews, err := github.ListReviews("acme", "api", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, review := range reviews {
+		ids = append(ids, review.ID)
+	}
+	if !reflect.DeepEqual(ids, []int64{1, 2, 3, 4, 5, 6}) {
+		t.Fatalf("expected the reviews of all three pages in order, got %v", ids)
+	}
+	if got := fake.seen("/repos/acme/api/pulls/1/reviews"); len(got) != 3 {
+		t.Fatalf("expected three page requests, got %d", len(got))
+	}
+
+	// A limit stops following Link headers once enough items were collected
+	url := fmt.Sprintf("%s/repos/acme/api/pulls/1/reviews?per_page=2", fake.URL)
+	pages := 0
+	err = github.getPaginated(url, 3, func(body []byte) (int, error) {
+		pages++
+		return 2, nil
+	})
+	if err != nil || pages != 2 {
+		t.Fatalf("expected two pages for a limit of three, got %d, %v", pages, err)
+	}
+}
+
+func TestGitHubETagCache(t *testing.T) {
+	key, _ := newTestAppKey(t)
+	fake := newFakeGitHub(t, &key.PublicKey)
+	github := newTestHelper(t, map[string]interface{}{"api_url": fake.URL}).GitHub
+
+	first, err := github.ListReviews("acme", "api", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remaining := fake.remaining["token default-token"]
+
+	// Every page is revalidated, and the cached Link headers keep pagination going
+	second, err := github.ListReviews("acme", "api", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("expected the cached reviews, got %+v", second)
+	}
+	if fake.notModified != 3 {
+		t.Fatalf("expected three 304 responses, got %d", fake.notModified)
+	}
+	if fake.remaining["token default-token"] != remaining {
+		t.Fatal("expected revalidated pages not to count against the quota")
+	}
+}
+
+func TestGitHubRateLimitPerCredential(t *testing.T) {
+	key, _ := newTestAppKey(t)
+	fake := newFakeGitHub(t, &key.PublicKey)
+	github := newTestHelper(t, map[string]interface{}{
+		"api_url":    fake.URL,
+		"org_tokens": "acme=acme-token",
+	}).GitHub
+
+	// The response to this request reports the acme token exhausted until the reset
+	fake.remaining["token acme-token"] = 1
+	if _, err := github.GetWorkflows("acme", "api"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The reset is an hour away, so requests with the acme token fail without being sent
+	var rateErr *RateLimitError
+	if _, err := github.GetWorkflows("acme", "api"); !errors.As(err, &rateErr) || rateErr.Secondary {
+		t.Fatalf("expected a primary RateLimitError, got %v", err)
+	}
+	if got := fake.seen("/repos/acme/api/actions/workflows"); len(got) != 1 {
+		t.Fatalf("expected the exhausted quota to stop the request locally, got %d requests", len(got))
+	}
+
+	// Other credentials have their own quota
+	if _, err := github.GetWorkflows("initech", "api"); err != nil {
+		t.Fatalf("expected the default token to be unaffected: %v", err)
+	}
+}
+
+func TestRateLimitBackoff(t *testing.T) {
+	github := &GitHubService{MaxRetries: 3, MaxRateLimitWait: 10 * time.Second}
+	resetIn := func(d time.Duration) string { return strconv.FormatInt(time.Now().Add(d).Unix(), 10) }
+
+	tests := []struct {
+		name      string
+		header    map[string]string
+		body      string
+		attempt   int
+		wait      time.Duration
+		rateErr   bool
+		secondary bool
+	}{
+		{name: "not rate limited", body: `{"message":"Resource not accessible by integration"}`, wait: -1},
+		{name: "retry after", header: map[string]string{"Retry-After": "2"}, wait: 2 * time.Second},
+		{name: "primary reset", header: map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": resetIn(5 * time.Second)}, wait: 5 * time.Second},
+		{name: "primary reset passed", header: map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": resetIn(-time.Minute)}, wait: 0},
+		{name: "secondary without hint", body: `{"message":"You have exceeded a secondary rate limit"}`, attempt: 2, wait: 4 * time.Second},
+		{name: "secondary too long", header: map[string]string{"Retry-After": "60"}, rateErr: true, secondary: true},
+		{name: "unparsable retry after", header: map[string]string{"Retry-After": "soon"}, rateErr: true, secondary: true},
+		{name: "primary too long", header: map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": resetIn(time.Hour)}, rateErr: true},
+		{name: "retries exhausted", header: map[string]string{"Retry-After": "1"}, attempt: 3, rateErr: true, secondary: true},
+	}
+
+	for _, test := range tests {
+		resp := &http.Response{StatusCode: http.StatusForbidden, Header: http.Header{}}
+		for name, value := range test.header {
+			resp.Header.Set(name, value)
+		}
+
+		wait, err := github.rateLimitBackoff(resp, []byte(test.body), test.attempt)
+		if test.rateErr {
+			var rateErr *RateLimitError
+			if !errors.As(err, &rateErr) || rateErr.Secondary != test.secondary {
+				t.Errorf("%s: expected a RateLimitError with secondary %v, got %v", test.name, test.secondary, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		// Waits derived from the reset time lose up to a second to rounding
+		if wait > test.wait || wait < test.wait-time.Second {
+			t.Errorf("%s: expected a wait of %s, got %s", test.name, test.wait, wait)
+		}
+	}
+}
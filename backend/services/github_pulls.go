@@ -0,0 +1,226 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// PullRequest represents a GitHub pull request
+type PullRequest struct {
+	ID             int64      `json:"id"`
+	Number         int        `json:"number"`
+	Title          string     `json:"title"`
+	State          string     `json:"state"`
+	Draft          bool       `json:"draft"`
+	HTMLURL        string     `json:"html_url"`
+	Body           string     `json:"body"`
+	Mergeable      *bool      `json:"mergeable"`
+	MergeableState string     `json:"mergeable_state"`
+	Merged         bool       `json:"merged"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	MergedAt       *time.Time `json:"merged_at"`
+	User           struct {
+		Login     string `json:"login"`
+		AvatarURL string `json:"avatar_url"`
+	} `json:"user"`
+	Head struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	} `json:"base"`
+	RequestedReviewers []struct {
+		Login string `json:"login"`
+	} `json:"requested_reviewers"`
+}
+
+// CheckRun represents a check run reported against a commit
+type CheckRun struct {
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	Conclusion  string     `json:"conclusion"`
+	HTMLURL     string     `json:"html_url"`
+	DetailsURL  string     `json:"details_url"`
+	StartedAt   *time.Time `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	App         struct {
+		Slug string `json:"slug"`
+		Name string `json:"name"`
+	} `json:"app"`
+}
+
+// CommitStatus represents a single commit status reported by an external system
+type CommitStatus struct {
+	Context     string    `json:"context"`
+	State       string    `json:"state"`
+	Description string    `json:"description"`
+	TargetURL   string    `json:"target_url"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// CombinedStatus is the aggregated commit status of a ref
+type CombinedStatus struct {
+	State      string         `json:"state"`
+	SHA        string         `json:"sha"`
+	TotalCount int            `json:"total_count"`
+	Statuses   []CommitStatus `json:"statuses"`
+}
+
+// PullRequestReview represents a review submitted on a pull request
+type PullRequestReview struct {
+	ID          int64     `json:"id"`
+	State       string    `json:"state"`
+	Body        string    `json:"body"`
+	HTMLURL     string    `json:"html_url"`
+	SubmittedAt time.Time `json:"submitted_at"`
+	User        struct {
+		Login string `json:"login"`
+	} `json:"user"`
+}
+
+// ListPullRequests retrieves pull requests for a repository filtered by state (open, closed or all)
+func (g *GitHubService) ListPullRequests(owner, repo, state string, limit int) ([]PullRequest, error) {
+	if state == "" {
+		state = "open"
+	}
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls?state=%s&per_page=%d", g.BaseURL, owner, repo, url.QueryEscape(state), perPage(limit))
+
+	var pulls []PullRequest
+	err := g.getPaginated(url, limit, func(body []byte) (int, error) {
+		var page []PullRequest
+		if err := json.Unmarshal(body, &page); err != nil {
+			return 0, err
+		}
+
+		pulls = append(pulls, page...)
+		return len(page), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if limit > 0 && len(pulls) > limit {
+		pulls = pulls[:limit]
+	}
+
+	return pulls, nil
+}
+
+// GetPullRequest retrieves a single pull request including its mergeability
+func (g *GitHubService) GetPullRequest(owner, repo string, number int) (*PullRequest, error) {
+	resp, err := g.get(fmt.Sprintf("%s/repos/%s/%s/pulls/%d", g.BaseURL, owner, repo, number))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub API request failed with status: %d", resp.StatusCode)
+	}
+
+	var pull PullRequest
+	if err := json.Unmarshal(resp.Body, &pull); err != nil {
+		return nil, err
+	}
+
+	return &pull, nil
+}
+
+// ListCheckRuns retrieves the check runs reported against a commit SHA, branch or tag
+func (g *GitHubService) ListCheckRuns(owner, repo, ref string) ([]CheckRun, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/commits/%s/check-runs?per_page=%d", g.BaseURL, owner, repo, url.PathEscape(ref), githubMaxPerPage)
+
+	var checkRuns []CheckRun
+	err := g.getPaginated(url, 0, func(body []byte) (int, error) {
+		var response struct {
+			CheckRuns  []CheckRun `json:"check_runs"`
+			TotalCount int        `json:"total_count"`
+		}
+
+		if err := json.Unmarshal(body, &response); err != nil {
+			return 0, err
+		}
+
+		checkRuns = append(checkRuns, response.CheckRuns...)
+		return len(response.CheckRuns), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return checkRuns, nil
+}
+
+// GetCombinedStatus retrieves the combined commit status of a ref
+func (g *GitHubService) GetCombinedStatus(owner, repo, ref string) (*CombinedStatus, error) {
+	resp, err := g.get(fmt.Sprintf("%s/repos/%s/%s/commits/%s/status?per_page=%d", g.BaseURL, owner, repo, url.PathEscape(ref), githubMaxPerPage))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub API request failed with status: %d", resp.StatusCode)
+	}
+
+	var status CombinedStatus
+	if err := json.Unmarshal(resp.Body, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// ListReviews retrieves the reviews submitted on a pull request in chronological order
+func (g *GitHubService) ListReviews(owner, repo string, number int) ([]PullRequestReview, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d/reviews?per_page=%d", g.BaseURL, owner, repo, number, githubMaxPerPage)
+
+	var reviews []PullRequestReview
+	err := g.getPaginated(url, 0, func(body []byte) (int, error) {
+		var page []PullRequestReview
+		if err := json.Unmarshal(body, &page); err != nil {
+			return 0, err
+		}
+
+		reviews = append(reviews, page...)
+		return len(page), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reviews, nil
+}
+
+// ReviewDecision reduces reviews to approved, changes_requested or review_required
+// using the latest approving or blocking review of each reviewer
+func ReviewDecision(reviews []PullRequestReview) string {
+	latest := make(map[string]string)
+	for _, review := range reviews {
+		switch review.State {
+		case "APPROVED", "CHANGES_REQUESTED", "DISMISSED":
+			latest[review.User.Login] = review.State
+		}
+	}
+
+	approved := false
+	for _, state := range latest {
+		if state == "CHANGES_REQUESTED" {
+			return "changes_requested"
+		}
+		if state == "APPROVED" {
+			approved = true
+		}
+	}
+
+	if approved {
+		return "approved"
+	}
+	return "review_required"
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
@@ -242,6 +244,60 @@ func (j *JenkinsService) GetBuildStatus(jobName string, buildNumber int) (*Build
 	return &buildDetails, nil
 }
 
+// GetLastBuild retrieves the most recent build of a job; jobName may address a
+// multibranch pipeline branch, e.g. "my-repo/job/PR-42"
+func (j *JenkinsService) GetLastBuild(jobName string) (*BuildInfo, error) {
+	jobPath, err := jenkinsJobPath(jobName)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/job/%s/lastBuild/api/json?tree=number,url,result,building,duration,timestamp,fullDisplayName", j.BaseURL, jobPath)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.SetBasicAuth(j.Username, j.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("last build request failed with status: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var build BuildInfo
+	if err := json.Unmarshal(body, &build); err != nil {
+		return nil, err
+	}
+
+	return &build, nil
+}
+
+// jenkinsJobPath escapes each "/" separated segment of a job path, so a job name cannot
+// add query parameters or climb out of the job tree with dot segments
+func jenkinsJobPath(jobName string) (string, error) {
+	segments := strings.Split(jobName, "/")
+	for i, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("invalid Jenkins job name %q", jobName)
+		}
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/"), nil
+}
+
 // GetBuildLog retrieves the console log for a specific build
 func (j *JenkinsService) GetBuildLog(jobName string, buildNumber int) (string, error) {
 	url := fmt.Sprintf("%s/job/%s/%d/consoleText", j.BaseURL, jobName, buildNumber)
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestGetLastBuildEscapesJobName(t *testing.T) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.EscapedPath()+"?"+r.URL.RawQuery)
+		json.NewEncoder(w).Encode(BuildInfo{Number: 7, Result: "SUCCESS"})
+	}))
+	defer server.Close()
+
+	jenkins := NewJenkinsService(server.URL, "ci", "token", zap.NewNop())
+	const tree = "tree=number,url,result,building,duration,timestamp,fullDisplayName"
+
+	tests := []struct {
+		job      string
+		expected string
+	}{
+		{"api/job/PR-42", "/job/api/job/PR-42/lastBuild/api/json?" + tree},
+		{"team folder/job/api", "/job/team%20folder/job/api/lastBuild/api/json?" + tree},
+		{"api?delay=0#x/job/PR-1", "/job/api%3Fdelay=0%23x/job/PR-1/lastBuild/api/json?" + tree},
+		{"../../script", ""},
+		{"api/./job/PR-1", ""},
+		{"api//PR-1", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		requested = nil
+		build, err := jenkins.GetLastBuild(test.job)
+
+		if test.expected == "" {
+			if err == nil || len(requested) != 0 {
+				t.Errorf("%q: expected the job name to be refused, requested %v", test.job, requested)
+			}
+			continue
+		}
+		if err != nil || build.Number != 7 {
+			t.Errorf("%q: expected build 7, got %+v, %v", test.job, build, err)
+			continue
+		}
+		if len(requested) != 1 || requested[0] != test.expected {
+			t.Errorf("%q: expected a request for %s, got %v", test.job, test.expected, requested)
+		}
+	}
+}
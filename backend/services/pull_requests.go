@@ -0,0 +1,248 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Check states used by the combined pull request verdict
+const (
+	CheckStateSuccess = "success"
+	CheckStateFailure = "failure"
+	CheckStatePending = "pending"
+	CheckStateSkipped = "skipped"
+)
+
+// CheckVerdict is the normalized outcome of one CI signal for a pull request
+type CheckVerdict struct {
+	Source  string `json:"source"`
+	Name    string `json:"name"`
+	State   string `json:"state"`
+	Details string `json:"details,omitempty"`
+	URL     string `json:"url,omitempty"`
+}
+
+// PullRequestReport combines a pull request with its checks, reviews and the
+// verdict aggregated from GitHub Actions, commit statuses, Jenkins and SonarQube
+type PullRequestReport struct {
+	PullRequest    *PullRequest        `json:"pullRequest"`
+	CheckRuns      []CheckRun          `json:"checkRuns"`
+	Statuses       *CombinedStatus     `json:"statuses,omitempty"`
+	Reviews        []PullRequestReview `json:"reviews"`
+	ReviewDecision string              `json:"reviewDecision"`
+	Mergeable      string              `json:"mergeable"`
+	JenkinsBuild   *BuildInfo          `json:"jenkinsBuild,omitempty"`
+	QualityGate    *SonarQubeMetrics   `json:"qualityGate,omitempty"`
+	Checks         []CheckVerdict      `json:"checks"`
+	State          string              `json:"state"`
+	Green          bool                `json:"green"`
+	Timestamp      time.Time           `json:"timestamp"`
+}
+
+// GetPullRequestReport builds the checks view of a pull request. jenkinsJob names the
+// multibranch pipeline building the repository; it defaults to the repository name.
+func (d *DevOpsHelper) GetPullRequestReport(owner, repo string, number int, jenkinsJob string) (*PullRequestReport, error) {
+	if d.GitHub == nil {
+		return nil, fmt.Errorf("GitHub service not initialized")
+	}
+
+	pull, err := d.GitHub.GetPullRequest(owner, repo, number)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PullRequestReport{
+		PullRequest: pull,
+		Mergeable:   mergeableState(pull),
+		Timestamp:   time.Now(),
+	}
+
+	checkRuns, err := d.GitHub.ListCheckRuns(owner, repo, pull.Head.SHA)
+	if err != nil {
+		return nil, err
+	}
+	report.CheckRuns = checkRuns
+	for _, run := range checkRuns {
+		report.Checks = append(report.Checks, CheckVerdict{
+			Source:  "github-actions",
+			Name:    run.Name,
+			State:   checkRunState(run),
+			Details: run.Conclusion,
+			URL:     run.HTMLURL,
+		})
+	}
+
+	statuses, err := d.GitHub.GetCombinedStatus(owner, repo, pull.Head.SHA)
+	if err != nil {
+		return nil, err
+	}
+	report.Statuses = statuses
+	for _, status := range statuses.Statuses {
+		report.Checks = append(report.Checks, CheckVerdict{
+			Source:  "commit-status",
+			Name:    status.Context,
+			State:   commitStatusState(status.State),
+			Details: status.Description,
+			URL:     status.TargetURL,
+		})
+	}
+
+	reviews, err := d.GitHub.ListReviews(owner, repo, number)
+	if err != nil {
+		return nil, err
+	}
+	report.Reviews = reviews
+	report.ReviewDecision = ReviewDecision(reviews)
+
+	if d.Jenkins != nil {
+		if jenkinsJob == "" {
+			jenkinsJob = repo
+		}
+		report.Checks = append(report.Checks, d.jenkinsPullRequestVerdict(report, jenkinsJob, number))
+	}
+
+	if d.SonarQube != nil {
+		report.Checks = append(report.Checks, d.sonarPullRequestVerdict(report, number))
+	}
+
+	report.State = combineCheckStates(report.Checks)
+	report.Green = report.State == CheckStateSuccess
+
+	d.Logger.Info("Built pull request report",
+		zap.String("repo", fmt.Sprintf("%s/%s", owner, repo)),
+		zap.Int("number", number),
+		zap.String("state", report.State))
+
+	return report, nil
+}
+
+// jenkinsPullRequestVerdict reads the last build of the PR-<number> branch job
+func (d *DevOpsHelper) jenkinsPullRequestVerdict(report *PullRequestReport, jenkinsJob string, number int) CheckVerdict {
+	verdict := CheckVerdict{
+		Source: "jenkins",
+		Name:   fmt.Sprintf("%s/PR-%d", jenkinsJob, number),
+	}
+
+	build, err := d.Jenkins.GetLastBuild(fmt.Sprintf("%s/job/PR-%d", jenkinsJob, number))
+	if err != nil {
+		verdict.State = CheckStateSkipped
+		verdict.Details = err.Error()
+		return verdict
+	}
+
+	report.JenkinsBuild = build
+	verdict.URL = build.URL
+	verdict.Details = build.Result
+
+	switch {
+	case build.Building:
+		verdict.State = CheckStatePending
+	case build.Result == "SUCCESS":
+		verdict.State = CheckStateSuccess
+	default:
+		verdict.State = CheckStateFailure
+	}
+
+	return verdict
+}
+
+// sonarPullRequestVerdict reads the quality gate SonarQube decorated the pull request with
+func (d *DevOpsHelper) sonarPullRequestVerdict(report *PullRequestReport, number int) CheckVerdict {
+	verdict := CheckVerdict{
+		Source: "sonarqube",
+		Name:   "Quality Gate",
+	}
+
+	qualityGate, err := d.SonarQube.GetPullRequestQualityGate(number)
+	if err != nil {
+		verdict.State = CheckStateSkipped
+		verdict.Details = err.Error()
+		return verdict
+	}
+
+	report.QualityGate = qualityGate
+	verdict.Details = qualityGate.ProjectStatus.Status
+
+	switch qualityGate.ProjectStatus.Status {
+	case "OK":
+		verdict.State = CheckStateSuccess
+	case "ERROR":
+		verdict.State = CheckStateFailure
+	default:
+		verdict.State = CheckStateSkipped
+	}
+
+	return verdict
+}
+
+// checkRunState maps a GitHub check run to a verdict state
+func checkRunState(run CheckRun) string {
+	if run.Status != "completed" {
+		return CheckStatePending
+	}
+
+	switch run.Conclusion {
+	case "success", "neutral":
+		return CheckStateSuccess
+	case "skipped":
+		return CheckStateSkipped
+	default:
+		return CheckStateFailure
+	}
+}
+
+// commitStatusState maps a GitHub commit status state to a verdict state
+func commitStatusState(state string) string {
+	switch state {
+	case "success":
+		return CheckStateSuccess
+	case "pending":
+		return CheckStatePending
+	default:
+		return CheckStateFailure
+	}
+}
+
+// combineCheckStates fails on any failure, waits on any pending check and
+// only reports success when at least one check actually passed
+func combineCheckStates(checks []CheckVerdict) string {
+	state := CheckStateSkipped
+	for _, check := range checks {
+		switch check.State {
+		case CheckStateFailure:
+			return CheckStateFailure
+		case CheckStatePending:
+			state = CheckStatePending
+		case CheckStateSuccess:
+			if state == CheckStateSkipped {
+				state = CheckStateSuccess
+			}
+		}
+	}
+
+	if state == CheckStateSkipped {
+		return CheckStatePending
+	}
+	return state
+}
+
+// mergeableState summarizes GitHub's mergeability fields
+func mergeableState(pull *PullRequest) string {
+	switch {
+	case pull.Merged:
+		return "merged"
+	case pull.Draft:
+		return "draft"
+	case pull.Mergeable == nil:
+		// GitHub computes mergeability in the background
+		return "unknown"
+	case !*pull.Mergeable:
+		return "conflicting"
+	case pull.MergeableState != "":
+		return pull.MergeableState
+	default:
+		return "mergeable"
+	}
+}
@@ -0,0 +1,68 @@
+package services
+
+import "testing"
+
+func TestCombineCheckStates(t *testing.T) {
+	tests := []struct {
+		name     string
+		states   []string
+		expected string
+	}{
+		{"no checks", nil, CheckStatePending},
+		{"only skipped", []string{CheckStateSkipped, CheckStateSkipped}, CheckStatePending},
+		{"success", []string{CheckStateSuccess, CheckStateSuccess}, CheckStateSuccess},
+		{"skipped with success", []string{CheckStateSkipped, CheckStateSuccess, CheckStateSkipped}, CheckStateSuccess},
+		{"pending before success", []string{CheckStatePending, CheckStateSuccess}, CheckStatePending},
+		{"pending after success", []string{CheckStateSuccess, CheckStatePending}, CheckStatePending},
+		{"failure wins over pending", []string{CheckStatePending, CheckStateFailure}, CheckStateFailure},
+		{"failure wins over success", []string{CheckStateSuccess, CheckStateFailure, CheckStateSuccess}, CheckStateFailure},
+	}
+
+	for _, test := range tests {
+		var checks []CheckVerdict
+		for _, state := range test.states {
+			checks = append(checks, CheckVerdict{State: state})
+		}
+
+		if state := combineCheckStates(checks); state != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, state)
+		}
+	}
+}
+
+func TestReviewDecision(t *testing.T) {
+	type review struct {
+		user  string
+		state string
+	}
+
+	tests := []struct {
+		name     string
+		reviews  []review
+		expected string
+	}{
+		{"no reviews", nil, "review_required"},
+		{"comments only", []review{{"alice", "COMMENTED"}}, "review_required"},
+		{"approved", []review{{"alice", "APPROVED"}}, "approved"},
+		{"changes requested", []review{{"alice", "APPROVED"}, {"bob", "CHANGES_REQUESTED"}}, "changes_requested"},
+		{"approval after changes", []review{{"alice", "CHANGES_REQUESTED"}, {"alice", "APPROVED"}}, "approved"},
+		{"changes after approval", []review{{"alice", "APPROVED"}, {"alice", "CHANGES_REQUESTED"}}, "changes_requested"},
+		{"comment keeps approval", []review{{"alice", "APPROVED"}, {"alice", "COMMENTED"}}, "approved"},
+		{"comment keeps changes", []review{{"alice", "CHANGES_REQUESTED"}, {"alice", "COMMENTED"}}, "changes_requested"},
+		{"dismissed changes", []review{{"alice", "CHANGES_REQUESTED"}, {"alice", "DISMISSED"}}, "review_required"},
+		{"dismissed with other approval", []review{{"alice", "CHANGES_REQUESTED"}, {"alice", "DISMISSED"}, {"bob", "APPROVED"}}, "approved"},
+	}
+
+	for _, test := range tests {
+		var reviews []PullRequestReview
+		for _, r := range test.reviews {
+			review := PullRequestReview{State: r.state}
+			review.User.Login = r.user
+			reviews = append(reviews, review)
+		}
+
+		if decision := ReviewDecision(reviews); decision != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, decision)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"fmt"
+)
+
+// ScanPolicy caps the number of vulnerabilities per severity an image may have.
+// A negative limit disables the check for that severity.
+type ScanPolicy struct {
+	MaxCritical int `json:"maxCritical"`
+	MaxHigh     int `json:"maxHigh"`
+	MaxMedium   int `json:"maxMedium"`
+}
+
+// PolicyResult is the outcome of checking a scan against a policy
+type PolicyResult struct {
+	Passed     bool       `json:"passed"`
+	Policy     ScanPolicy `json:"policy"`
+	Violations []string   `json:"violations,omitempty"`
+}
+
+// DefaultScanPolicy rejects critical vulnerabilities and only reports the others
+func DefaultScanPolicy() ScanPolicy {
+	return ScanPolicy{
+		MaxCritical: 0,
+		MaxHigh:     -1,
+		MaxMedium:   -1,
+	}
+}
+
+// Evaluate checks a scan summary against the policy. Scans that did not complete fail the policy.
+func (p ScanPolicy) Evaluate(summary *ScanSummary) *PolicyResult {
+	result := &PolicyResult{Policy: p}
+
+	if summary == nil || !summary.Success {
+		message := "scan did not complete"
+		if summary != nil && summary.Message != "" {
+			message = fmt.Sprintf("scan did not complete: %s", summary.Message)
+		}
+		result.Violations = append(result.Violations, message)
+		return result
+	}
+
+	limits := []struct {
+		severity string
+		found    int
+		max      int
+	}{
+		{"critical", summary.Critical, p.MaxCritical},
+		{"high", summary.High, p.MaxHigh},
+		{"medium", summary.Medium, p.MaxMedium},
+	}
+
+	for _, limit := range limits {
+		if limit.max >= 0 && limit.found > limit.max {
+			result.Violations = append(result.Violations,
+				fmt.Sprintf("%d %s vulnerabilities exceed the limit of %d", limit.found, limit.severity, limit.max))
+		}
+	}
+
+	result.Passed = len(result.Violations) == 0
+	return result
+}
@@ -1,7 +1,6 @@
 package services
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -161,6 +160,42 @@ func (s *SonarQubeService) GetQualityGateStatus() (*SonarQubeMetrics, error) {
 	return &metrics, nil
 }
 
+// GetPullRequestQualityGate fetches the quality gate status SonarQube decorated a pull request with
+func (s *SonarQubeService) GetPullRequestQualityGate(pullRequest int) (*SonarQubeMetrics, error) {
+	url := fmt.Sprintf("%s/api/qualitygates/project_status?projectKey=%s&pullRequest=%d", s.BaseURL, s.ProjectKey, pullRequest)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.SetBasicAuth(s.Token, "")
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API request failed with status: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics SonarQubeMetrics
+	if err := json.Unmarshal(body, &metrics); err != nil {
+		return nil, err
+	}
+
+	return &metrics, nil
+}
+
 // GetProjectMeasures fetches project measures from SonarQube API
 func (s *SonarQubeService) GetProjectMeasures() (*SonarQubeMeasures, error) {
 	metrics := "ncloc,bugs,vulnerabilities,code_smells,coverage,duplicated_lines_density"
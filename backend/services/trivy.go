@@ -3,6 +3,7 @@ package services
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 	"os/exec"
 	"time"
 
@@ -12,6 +13,9 @@ import (
 // TrivyService handles Trivy security scanning
 type TrivyService struct {
 	Logger *zap.Logger
+	Policy ScanPolicy
+	// Env is added to the environment of image scans, e.g. DOCKER_HOST
+	Env []string
 }
 
 // TrivyVulnerability represents a single vulnerability
@@ -77,6 +81,7 @@ type ScanSummary struct {
 func NewTrivyService(logger *zap.Logger) *TrivyService {
 	return &TrivyService{
 		Logger: logger,
+		Policy: DefaultScanPolicy(),
 	}
 }
 
@@ -126,7 +131,8 @@ func (t *TrivyService) ScanImage(imageName string) (*ScanSummary, error) {
 		}, nil
 	}
 
-	cmd := exec.Command("trivy", "image", "--format", "json", "--quiet", imageName)
+	cmd := exec.Command("trivy", "image", "--format", "json", "--quiet", "--", imageName)
+	cmd.Env = append(os.Environ(), t.Env...)
 	output, err := cmd.Output()
 	if err != nil {
 		t.Logger.Error("Trivy image scan failed", zap.Error(err))
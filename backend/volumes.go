@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// CreateVolumeRequest describes a named volume to create
+type CreateVolumeRequest struct {
+	Name       string            `json:"name"`
+	Driver     string            `json:"driver"`
+	DriverOpts map[string]string `json:"driverOpts"`
+	Labels     map[string]string `json:"labels"`
+}
+
+// getVolumesHandler lists volumes filtered by name, label, driver or dangling
+func (s *Server) getVolumesHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	volumes, err := docker.VolumeList(r.Context(), volume.ListOptions{
+		Filters: queryFilters(r, "name", "label", "driver", "dangling"),
+	})
+	if err != nil {
+		s.logger.Error("Failed to list volumes", zap.Error(err))
+		s.errorResponse(w, dockerErrorStatus(err), "Failed to list volumes")
+		return
+	}
+
+	result := volumes.Volumes
+	if result == nil {
+		result = make([]*volume.Volume, 0)
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Data: result})
+}
+
+func (s *Server) createVolumeHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateVolumeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.errorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	created, err := docker.VolumeCreate(r.Context(), volume.CreateOptions{
+		Name:       req.Name,
+		Driver:     req.Driver,
+		DriverOpts: req.DriverOpts,
+		Labels:     req.Labels,
+	})
+	if err != nil {
+		s.logger.Error("Failed to create volume", zap.Error(err), zap.String("volume", req.Name))
+		s.errorResponse(w, dockerErrorStatus(err), fmt.Sprintf("Failed to create volume: %v", err))
+		return
+	}
+
+	s.jsonResponse(w, http.StatusCreated, Response{Message: "Volume created successfully", Data: created})
+}
+
+func (s *Server) getVolumeHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+
+	vol, err := docker.VolumeInspect(r.Context(), name)
+	if err != nil {
+		s.logger.Error("Failed to inspect volume", zap.Error(err), zap.String("volume", name))
+		s.errorResponse(w, dockerErrorStatus(err), "Volume not found")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Data: vol})
+}
+
+func (s *Server) removeVolumeHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+
+	if err := docker.VolumeRemove(r.Context(), name, r.URL.Query().Get("force") == "true"); err != nil {
+		s.logger.Error("Failed to remove volume", zap.Error(err), zap.String("volume", name))
+		s.errorResponse(w, dockerErrorStatus(err), "Failed to remove volume")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{Message: "Volume removed successfully"})
+}
+
+// pruneVolumesHandler removes unused anonymous volumes, or all unused volumes with ?all=true
+func (s *Server) pruneVolumesHandler(w http.ResponseWriter, r *http.Request) {
+	docker, ok := s.docker(w, r)
+	if !ok {
+		return
+	}
+
+	args := filters.NewArgs()
+	if r.URL.Query().Get("all") == "true" {
+		args.Add("all", "true")
+	}
+
+	report, err := docker.VolumesPrune(r.Context(), args)
+	if err != nil {
+		s.logger.Error("Failed to prune volumes", zap.Error(err))
+		s.errorResponse(w, dockerErrorStatus(err), "Failed to prune volumes")
+		return
+	}
+
+	s.jsonResponse(w, http.StatusOK, Response{
+		Message: fmt.Sprintf("Reclaimed %d bytes", report.SpaceReclaimed),
+		Data:    report,
+	})
+}
@@ -0,0 +1,5 @@
+module devops-ide/pkg/authtoken
+
+go 1.21
+
+require github.com/golang-jwt/jwt v3.2.2+incompatible
@@ -0,0 +1,116 @@
+package authtoken
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// Introspection results are reused this long, so revoking a token takes effect
+	// within this window
+	defaultIntrospectionTTL = 30 * time.Second
+	// Expired entries are swept once the cache grows beyond this many tokens
+	introspectionSweepSize = 1024
+)
+
+// Introspector checks opaque access tokens against the auth service verify
+// endpoint and caches accepted tokens briefly
+type Introspector struct {
+	URL    string
+	Client *http.Client
+	TTL    time.Duration
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]introspection
+}
+
+type introspection struct {
+	identity  *Identity
+	expiresAt time.Time
+}
+
+// NewIntrospector creates an introspector calling the verify endpoint at url
+func NewIntrospector(url string) *Introspector {
+	return &Introspector{
+		URL:    url,
+		Client: &http.Client{Timeout: 5 * time.Second},
+		TTL:    defaultIntrospectionTTL,
+		cache:  make(map[[sha256.Size]byte]introspection),
+	}
+}
+
+// Introspect returns the identity an access token stands for. Rejected tokens are not
+// cached, a token is only looked up again once it expired from the cache.
+func (i *Introspector) Introspect(ctx context.Context, raw string) (*Identity, error) {
+	// Keyed by hash so the cache never holds usable token values
+	key := sha256.Sum256([]byte(raw))
+	now := time.Now()
+
+	i.mu.Lock()
+	cached, ok := i.cache[key]
+	i.mu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.identity, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, i.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+raw)
+
+	resp, err := i.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to introspect token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, errors.New("token is invalid, expired or revoked")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to introspect token: %s", resp.Status)
+	}
+
+	var claims struct {
+		UserID    string    `json:"user_id"`
+		Email     string    `json:"email"`
+		Roles     []string  `json:"roles"`
+		Scopes    []string  `json:"scopes"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("invalid introspection response: %v", err)
+	}
+	if claims.UserID == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	identity := &Identity{UserID: claims.UserID, Email: claims.Email, Roles: claims.Roles, Scopes: claims.Scopes}
+	if identity.Roles == nil {
+		identity.Roles = []string{}
+	}
+	expiresAt := now.Add(i.TTL)
+	if !claims.ExpiresAt.IsZero() && claims.ExpiresAt.Before(expiresAt) {
+		expiresAt = claims.ExpiresAt
+	}
+
+	i.mu.Lock()
+	if len(i.cache) >= introspectionSweepSize {
+		for k, entry := range i.cache {
+			if !now.Before(entry.expiresAt) {
+				delete(i.cache, k)
+			}
+		}
+	}
+	i.cache[key] = introspection{identity: identity, expiresAt: expiresAt}
+	i.mu.Unlock()
+
+	return identity, nil
+}
@@ -0,0 +1,201 @@
+package authtoken
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Keys are refetched after this long unless the response sets a max-age
+	defaultJWKSTTL = 10 * time.Minute
+	// Unknown key IDs trigger a refetch at most this often, so forged kids cannot hammer the auth service
+	jwksMinRefreshInterval = 30 * time.Second
+)
+
+// ErrUnknownKey is returned when no signing key matches a token key ID
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// JWK is a JSON Web Key as published by the auth service
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSCache fetches signing keys from a JWKS endpoint and caches them by key ID
+type JWKSCache struct {
+	URL    string
+	Client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]interface{}
+	expiresAt time.Time
+	fetchedAt time.Time
+}
+
+// NewJWKSCache creates a cache for the key set published at url
+func NewJWKSCache(url string) *JWKSCache {
+	return &JWKSCache{
+		URL:    url,
+		Client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Key returns the public key for a key ID, refreshing the key set when it expired
+// or the key ID is new, e.g. right after the auth service rotated its keys
+func (c *JWKSCache) Key(ctx context.Context, kid string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	key, ok := c.keys[kid]
+	if ok && now.Before(c.expiresAt) {
+		return key, nil
+	}
+
+	if !ok && now.Sub(c.fetchedAt) < jwksMinRefreshInterval && now.Before(c.expiresAt) {
+		return nil, ErrUnknownKey
+	}
+
+	if err := c.refresh(ctx); err != nil {
+		// Keep serving known keys while the auth service is unreachable
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	if key, ok = c.keys[kid]; !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+func (c *JWKSCache) refresh(ctx context.Context) error {
+	c.fetchedAt = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []JWK `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("invalid JWKS: %v", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			// Skip keys of unsupported types rather than rejecting the whole set
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	c.keys = keys
+	c.expiresAt = c.fetchedAt.Add(cacheMaxAge(resp.Header.Get("Cache-Control")))
+	return nil
+}
+
+// cacheMaxAge reads max-age from a Cache-Control header
+func cacheMaxAge(header string) time.Duration {
+	for _, directive := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if strings.EqualFold(name, "max-age") {
+			if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return defaultJWKSTTL
+}
+
+// PublicKey decodes an RSA, EC (P-256, P-384) or Ed25519 public key
+func (k JWK) PublicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(bytes) == 0 {
+		return nil, fmt.Errorf("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
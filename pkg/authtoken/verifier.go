@@ -0,0 +1,166 @@
+// Package authtoken verifies the bearer tokens issued by the auth service. Session
+// tokens are JWTs checked against the published signing keys, personal access and
+// service account tokens are opaque and checked by the auth service itself.
+package authtoken
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// AccessTokenPrefix starts personal access and service account tokens
+const AccessTokenPrefix = "dvi_"
+
+// Identity is the caller verified from a bearer token
+type Identity struct {
+	UserID string   `json:"userId"`
+	Email  string   `json:"email,omitempty"`
+	Roles  []string `json:"roles"`
+	// Scopes narrow what an access token may do, empty for session tokens
+	Scopes []string `json:"scopes,omitempty"`
+	// Claims are those of a session token, nil for access tokens
+	Claims jwt.MapClaims `json:"-"`
+}
+
+// Config configures how tokens issued by the auth service are checked
+type Config struct {
+	Issuer   string
+	Audience string
+	// JWKSURL is where the auth service publishes its signing keys
+	JWKSURL string
+	// IntrospectionURL is the auth service endpoint checking access tokens, which are
+	// rejected when it is empty
+	IntrospectionURL string
+	// HMACSecret accepts HS256 tokens signed with a shared secret, for local development only
+	HMACSecret []byte
+	// Leeway tolerates clock skew with the auth service
+	Leeway time.Duration
+}
+
+// Verifier validates signature, expiry, issuer and audience of session tokens and
+// introspects access tokens
+type Verifier struct {
+	config       Config
+	methods      []string
+	keys         *JWKSCache
+	introspector *Introspector
+}
+
+// NewVerifier creates a verifier accepting RS256, ES256 and EdDSA tokens signed with
+// published keys, plus HS256 when a development secret is configured
+func NewVerifier(config Config) *Verifier {
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	verifier := &Verifier{config: config}
+	if config.JWKSURL != "" {
+		verifier.methods = append(verifier.methods, "RS256", "ES256", "EdDSA")
+		verifier.keys = &JWKSCache{URL: config.JWKSURL, Client: client}
+	}
+	if len(config.HMACSecret) > 0 {
+		verifier.methods = append(verifier.methods, "HS256")
+	}
+	if config.IntrospectionURL != "" {
+		verifier.introspector = NewIntrospector(config.IntrospectionURL)
+		verifier.introspector.Client = client
+	}
+	return verifier
+}
+
+// IsAccessToken reports whether a bearer token is an opaque access token rather than a JWT
+func IsAccessToken(raw string) bool {
+	return strings.HasPrefix(raw, AccessTokenPrefix)
+}
+
+// Verify checks a raw bearer token and returns the identity it carries
+func (v *Verifier) Verify(ctx context.Context, raw string) (*Identity, error) {
+	if IsAccessToken(raw) {
+		if v.introspector == nil {
+			return nil, errors.New("access tokens are not accepted")
+		}
+		return v.introspector.Introspect(ctx, raw)
+	}
+
+	parser := &jwt.Parser{ValidMethods: v.methods, SkipClaimsValidation: true}
+
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+			return v.config.HMACSecret, nil
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("token has no key ID")
+		}
+		if v.keys == nil {
+			return nil, ErrUnknownKey
+		}
+		return v.keys.Key(ctx, kid)
+	})
+	if err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Inner != nil {
+			err = validationErr.Inner
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if !claims.VerifyExpiresAt(now.Add(-v.config.Leeway).Unix(), true) {
+		return nil, errors.New("token is expired or has no expiry")
+	}
+	if !claims.VerifyNotBefore(now.Add(v.config.Leeway).Unix(), false) {
+		return nil, errors.New("token is not valid yet")
+	}
+	if v.config.Issuer != "" && !claims.VerifyIssuer(v.config.Issuer, true) {
+		return nil, errors.New("unexpected token issuer")
+	}
+	if v.config.Audience != "" && !claims.VerifyAudience(v.config.Audience, true) {
+		return nil, errors.New("token is not intended for this audience")
+	}
+
+	identity := &Identity{Claims: claims}
+	identity.UserID, _ = claims["sub"].(string)
+	if identity.UserID == "" {
+		identity.UserID, _ = claims["user_id"].(string)
+	}
+	if identity.UserID == "" {
+		return nil, errors.New("token has no subject")
+	}
+	identity.Email, _ = claims["email"].(string)
+	identity.Roles = stringList(claims["roles"])
+
+	return identity, nil
+}
+
+// stringList reads a claim holding a JSON array of strings
+func stringList(claim interface{}) []string {
+	values, _ := claim.([]interface{})
+	list := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// BearerToken reads the token of an "Authorization: Bearer" header, returning an
+// empty token when the header is missing
+func BearerToken(header string) (string, error) {
+	if header == "" {
+		return "", nil
+	}
+
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", fmt.Errorf("authorization header must use the Bearer scheme")
+	}
+	return strings.TrimSpace(token), nil
+}
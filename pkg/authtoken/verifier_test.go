@@ -0,0 +1,186 @@
+package authtoken
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// authServer stands in for the JWKS and verify endpoints of the auth service
+type authServer struct {
+	*httptest.Server
+	keys           map[string]*rsa.PrivateKey
+	jwksFetches    int32
+	introspections int32
+}
+
+func newAuthServer(t *testing.T, kids ...string) *authServer {
+	t.Helper()
+
+	server := &authServer{keys: make(map[string]*rsa.PrivateKey)}
+	for _, kid := range kids {
+		server.addKey(t, kid)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&server.jwksFetches, 1)
+		var set struct {
+			Keys []JWK `json:"keys"`
+		}
+		for kid, key := range server.keys {
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(set)
+	})
+	mux.HandleFunc("/auth/verify", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&server.introspections, 1)
+		if r.Header.Get("Authorization") != "Bearer dvi_pat_valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"user_id": "svc-1",
+			"scopes":  []string{"files:read"},
+		})
+	})
+
+	server.Server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *authServer) addKey(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.keys[kid] = key
+}
+
+func (s *authServer) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(s.keys[kid])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func (s *authServer) verifier() *Verifier {
+	return NewVerifier(Config{
+		Issuer:           "devops-ide-auth",
+		Audience:         "devops-ide",
+		JWKSURL:          s.URL + "/.well-known/jwks.json",
+		IntrospectionURL: s.URL + "/auth/verify",
+	})
+}
+
+func sessionClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   "user-1",
+		"email": "dev@example.com",
+		"roles": []string{"developer"},
+		"iss":   "devops-ide-auth",
+		"aud":   "devops-ide",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	}
+}
+
+func TestVerifySessionTokens(t *testing.T) {
+	server := newAuthServer(t, "key-1")
+	verifier := server.verifier()
+	ctx := context.Background()
+
+	identity, err := verifier.Verify(ctx, server.sign(t, "key-1", sessionClaims()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.UserID != "user-1" || identity.Email != "dev@example.com" || len(identity.Roles) != 1 || identity.Roles[0] != "developer" {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+
+	// Unknown key IDs refetch the key set at most every jwksMinRefreshInterval, after
+	// that a key published by a rotation is picked up on first use
+	server.addKey(t, "key-2")
+	rotated := server.sign(t, "key-2", sessionClaims())
+	if _, err := verifier.Verify(ctx, rotated); err == nil {
+		t.Fatal("expected unknown keys not to refetch right after a fetch")
+	}
+	verifier.keys.mu.Lock()
+	verifier.keys.fetchedAt = time.Now().Add(-jwksMinRefreshInterval)
+	verifier.keys.mu.Unlock()
+	if _, err := verifier.Verify(ctx, rotated); err != nil {
+		t.Fatalf("expected the rotated key to be picked up: %v", err)
+	}
+	if fetches := atomic.LoadInt32(&server.jwksFetches); fetches != 2 {
+		t.Fatalf("expected 2 key set fetches, got %d", fetches)
+	}
+
+	rejected := map[string]func(jwt.MapClaims){
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = "another-service" },
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "someone-else" },
+		"no subject":     func(c jwt.MapClaims) { delete(c, "sub") },
+	}
+	for name, modify := range rejected {
+		claims := sessionClaims()
+		modify(claims)
+		if _, err := verifier.Verify(ctx, server.sign(t, "key-1", claims)); err == nil {
+			t.Errorf("%s: expected the token to be rejected", name)
+		}
+	}
+
+	forger := &authServer{keys: make(map[string]*rsa.PrivateKey)}
+	forger.addKey(t, "key-1")
+	if _, err := verifier.Verify(ctx, forger.sign(t, "key-1", sessionClaims())); err == nil {
+		t.Error("expected a token signed with another key under a known key ID to be rejected")
+	}
+}
+
+func TestVerifyAccessTokens(t *testing.T) {
+	server := newAuthServer(t)
+	verifier := server.verifier()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		identity, err := verifier.Verify(ctx, "dvi_pat_valid")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if identity.UserID != "svc-1" || len(identity.Scopes) != 1 || identity.Roles == nil {
+			t.Fatalf("unexpected identity %+v", identity)
+		}
+	}
+	if n := atomic.LoadInt32(&server.introspections); n != 1 {
+		t.Fatalf("expected accepted tokens to be cached, got %d introspections", n)
+	}
+
+	if _, err := verifier.Verify(ctx, "dvi_pat_revoked"); err == nil {
+		t.Error("expected a rejected access token to fail")
+	}
+
+	withoutIntrospection := NewVerifier(Config{JWKSURL: server.URL + "/.well-known/jwks.json"})
+	if _, err := withoutIntrospection.Verify(ctx, "dvi_pat_valid"); err == nil {
+		t.Error("expected access tokens to be refused without an introspection URL")
+	}
+}
@@ -1,17 +1,168 @@
 package middleware
 
 import (
+    "context"
+    "fmt"
     "net/http"
+    "strings"
+
+    "devops-ide/pkg/authtoken"
+)
+
+// Headers carrying the verified identity to downstream services. Incoming values are
+// always discarded so clients cannot impersonate another user.
+const (
+    UserIDHeader    = "X-User-ID"
+    UserEmailHeader = "X-User-Email"
+    UserRolesHeader = "X-User-Roles"
+    // UserScopesHeader lists the scopes of an access token, absent for session tokens
+    UserScopesHeader = "X-User-Scopes"
 )
 
-func AuthMiddleware(next http.Handler) http.Handler {
-    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        token := r.Header.Get("Authorization")
-        if token == "" {
-            http.Error(w, "Unauthorized", http.StatusUnauthorized)
-            return
+// Realm reported in WWW-Authenticate challenges
+const authRealm = "devops-ide"
+
+type contextKey int
+
+const identityKey contextKey = iota
+
+// tokenError describes why a token was rejected, reported in the WWW-Authenticate header
+type tokenError struct {
+    code        string
+    description string
+    status      int
+    // scope is the scope that was missing, for insufficient_scope errors
+    scope string
+}
+
+// AuthMiddleware rejects requests without a valid bearer token and forwards the verified
+// identity to downstream services as headers and to later middleware in the context
+func AuthMiddleware(verifier *authtoken.Verifier) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            r.Header.Del(UserIDHeader)
+            r.Header.Del(UserEmailHeader)
+            r.Header.Del(UserRolesHeader)
+            r.Header.Del(UserScopesHeader)
+
+            header := r.Header.Get("Authorization")
+            if header == "" {
+                header = queryToken(r)
+            }
+            token, err := authtoken.BearerToken(header)
+            if err != nil {
+                challenge(w, &tokenError{code: "invalid_request", description: err.Error(), status: http.StatusBadRequest})
+                return
+            }
+            if token == "" {
+                challenge(w, nil)
+                return
+            }
+
+            identity, err := verifier.Verify(r.Context(), token)
+            if err != nil {
+                challenge(w, &tokenError{code: "invalid_token", description: err.Error(), status: http.StatusUnauthorized})
+                return
+            }
+
+            r.Header.Set(UserIDHeader, identity.UserID)
+            if identity.Email != "" {
+                r.Header.Set(UserEmailHeader, identity.Email)
+            }
+            if len(identity.Roles) > 0 {
+                r.Header.Set(UserRolesHeader, strings.Join(identity.Roles, ","))
+            }
+            if len(identity.Scopes) > 0 {
+                r.Header.Set(UserScopesHeader, strings.Join(identity.Scopes, ","))
+            }
+
+            next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey, identity)))
+        })
+    }
+}
+
+// queryToken moves an access_token query parameter of a websocket handshake or an
+// EventSource request into a bearer header, since browsers cannot set headers on either.
+// The token is removed from the URL so it is not forwarded or logged downstream.
+func queryToken(r *http.Request) string {
+    if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") && !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+        return ""
+    }
+
+    query := r.URL.Query()
+    token := query.Get("access_token")
+    if token == "" {
+        return ""
+    }
+    query.Del("access_token")
+    r.URL.RawQuery = query.Encode()
+    header := "Bearer " + token
+    r.Header.Set("Authorization", header)
+    return header
+}
+
+// RequireScope limits access tokens with scopes to those covering the service, as
+// "<service>:read" for safe methods and "<service>:write" for everything else. Session
+// tokens and access tokens without scopes carry the full permissions of their user.
+func RequireScope(service string) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            identity, ok := IdentityFromContext(r.Context())
+            if !ok {
+                challenge(w, nil)
+                return
+            }
+
+            scope := service + ":write"
+            if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+                scope = service + ":read"
+            }
+            if len(identity.Scopes) > 0 && !scopeGranted(identity.Scopes, scope) {
+                challenge(w, &tokenError{
+                    code:        "insufficient_scope",
+                    description: fmt.Sprintf("token lacks the %s scope", scope),
+                    status:      http.StatusForbidden,
+                    scope:       scope,
+                })
+                return
+            }
+
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+// scopeGranted matches a scope exactly, by "<service>:*" or by "*"
+func scopeGranted(granted []string, scope string) bool {
+    service, _, _ := strings.Cut(scope, ":")
+    for _, g := range granted {
+        if g == "*" || g == scope || g == service+":*" {
+            return true
         }
-        // Verify token with auth service
-        next.ServeHTTP(w, r)
-    })
+    }
+    return false
+}
+
+// IdentityFromContext returns the identity verified by AuthMiddleware
+func IdentityFromContext(ctx context.Context) (*authtoken.Identity, bool) {
+    identity, ok := ctx.Value(identityKey).(*authtoken.Identity)
+    return identity, ok
+}
+
+// challenge writes a Bearer challenge as described in RFC 6750, without error details
+// when the request carried no credentials at all
+func challenge(w http.ResponseWriter, err *tokenError) {
+    if err == nil {
+        w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", authRealm))
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    description := strings.ReplaceAll(err.description, `"`, `'`)
+    value := fmt.Sprintf("Bearer realm=%q, error=%q, error_description=%q", authRealm, err.code, description)
+    if err.scope != "" {
+        value += fmt.Sprintf(", scope=%q", err.scope)
+    }
+    w.Header().Set("WWW-Authenticate", value)
+    http.Error(w, http.StatusText(err.status), err.status)
 }
\ No newline at end of file
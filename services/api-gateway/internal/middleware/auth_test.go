@@ -0,0 +1,108 @@
+package middleware
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "devops-ide/pkg/authtoken"
+    "devops-ide/services/api-gateway/internal/proxy"
+
+    "github.com/golang-jwt/jwt"
+    "github.com/gorilla/websocket"
+)
+
+func signToken(t *testing.T, secret []byte) string {
+    t.Helper()
+
+    token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+        "sub": "user-1",
+        "exp": time.Now().Add(time.Minute).Unix(),
+    }).SignedString(secret)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return token
+}
+
+func TestWebsocketQueryToken(t *testing.T) {
+    secret := []byte("test-secret")
+    token := signToken(t, secret)
+
+    // The upstream authenticates handshakes itself, like the websocket service does
+    upgrader := websocket.Upgrader{}
+    backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("Authorization") != "Bearer "+token {
+            http.Error(w, "Unauthorized", http.StatusUnauthorized)
+            return
+        }
+        if r.URL.Query().Has("access_token") {
+            http.Error(w, "token forwarded in the URL", http.StatusBadRequest)
+            return
+        }
+
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+        conn.WriteMessage(websocket.TextMessage, []byte(r.Header.Get(UserIDHeader)))
+    }))
+    defer backend.Close()
+
+    upstream, err := proxy.NewUpstream("websocket", []string{backend.URL}, proxy.RoundRobin)
+    if err != nil {
+        t.Fatal(err)
+    }
+    verifier := authtoken.NewVerifier(authtoken.Config{HMACSecret: secret})
+    gateway := httptest.NewServer(AuthMiddleware(verifier)(proxy.NewWebsocketProxy(upstream)))
+    defer gateway.Close()
+
+    wsURL := "ws" + strings.TrimPrefix(gateway.URL, "http") + "/ws"
+
+    conn, resp, err := websocket.DefaultDialer.Dial(wsURL+"?access_token="+token, nil)
+    if err != nil {
+        status := 0
+        if resp != nil {
+            status = resp.StatusCode
+        }
+        t.Fatalf("expected the handshake to reach the upstream with the token as a header, got %v (%d)", err, status)
+    }
+    defer conn.Close()
+
+    if _, message, err := conn.ReadMessage(); err != nil || string(message) != "user-1" {
+        t.Fatalf("expected the verified user from the upstream, got %q (%v)", message, err)
+    }
+
+    if _, resp, err := websocket.DefaultDialer.Dial(wsURL+"?access_token=forged", nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+        t.Fatal("expected a handshake with an invalid token to be refused by the gateway")
+    }
+}
+
+func TestEventSourceQueryToken(t *testing.T) {
+    secret := []byte("test-secret")
+    token := signToken(t, secret)
+
+    handler := AuthMiddleware(authtoken.NewVerifier(authtoken.Config{HMACSecret: secret}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("Authorization") != "Bearer "+token || r.URL.Query().Has("access_token") {
+            t.Errorf("expected the token as a header only, got %q and %q", r.Header.Get("Authorization"), r.URL.RawQuery)
+        }
+    }))
+
+    r := httptest.NewRequest("GET", "/api/containers/events?access_token="+token+"&type=container", nil)
+    r.Header.Set("Accept", "text/event-stream")
+    w := httptest.NewRecorder()
+    handler.ServeHTTP(w, r)
+    if w.Code != http.StatusOK {
+        t.Fatalf("expected an event stream with a query token to pass, got %d", w.Code)
+    }
+
+    // Other requests must send the header, so tokens do not end up in URLs needlessly
+    w = httptest.NewRecorder()
+    handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/containers?access_token="+token, nil))
+    if w.Code != http.StatusUnauthorized {
+        t.Fatalf("expected a query token on a plain request to be refused, got %d", w.Code)
+    }
+}
@@ -0,0 +1,167 @@
+package middleware
+
+import (
+    "log"
+    "math"
+    "net"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "devops-ide/services/api-gateway/internal/ratelimit"
+)
+
+// RouteLimit applies a stricter limit per user to expensive routes, on top of the
+// general user limit
+type RouteLimit struct {
+    // Method matches any method when empty
+    Method string
+    // Prefix matches the path. A "*" segment matches any single segment, so
+    // "/jenkins/*/build" covers the build of every job, and "**" matches one or more
+    // segments, for IDs containing slashes such as image names.
+    Prefix string
+    Limit  ratelimit.Limit
+}
+
+func (l RouteLimit) matches(r *http.Request) bool {
+    if l.Method != "" && !strings.EqualFold(l.Method, r.Method) {
+        return false
+    }
+    return matchSegments(strings.Split(l.Prefix, "/"), strings.Split(r.URL.Path, "/"))
+}
+
+// matchSegments matches path segments against a pattern, the last pattern segment being
+// a prefix so "/jenkins/" matches every jenkins path
+func matchSegments(pattern, path []string) bool {
+    if len(pattern) == 0 {
+        return true
+    }
+
+    segment, rest := pattern[0], pattern[1:]
+    if segment == "**" {
+        for i := 1; i <= len(path); i++ {
+            if matchSegments(rest, path[i:]) {
+                return true
+            }
+        }
+        return false
+    }
+
+    if len(path) == 0 {
+        return false
+    }
+    switch {
+    case segment == "*":
+    case len(rest) == 0:
+        if !strings.HasPrefix(path[0], segment) {
+            return false
+        }
+    case segment != path[0]:
+        return false
+    }
+    return matchSegments(rest, path[1:])
+}
+
+func (l RouteLimit) String() string {
+    if l.Method == "" {
+        return l.Prefix
+    }
+    return l.Method + " " + l.Prefix
+}
+
+// RateLimiter enforces token bucket limits per client IP and per user
+type RateLimiter struct {
+    Store ratelimit.Store
+    IP    ratelimit.Limit
+    User  ratelimit.Limit
+    // Routes are checked in order and the first match applies
+    Routes []RouteLimit
+    // TrustProxy takes the client IP from the last X-Forwarded-For entry, for gateways
+    // behind a load balancer. Without a proxy in front clients could pick any IP.
+    TrustProxy bool
+}
+
+// PerIP limits requests by client IP. It runs before authentication so floods of
+// invalid tokens are rejected without verifying them.
+func (l *RateLimiter) PerIP() func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if l.take(w, r, "ip:"+l.clientIP(r), l.IP) {
+                next.ServeHTTP(w, r)
+            }
+        })
+    }
+}
+
+// PerUser limits requests by the identity verified by AuthMiddleware, and applies the
+// first matching route limit
+func (l *RateLimiter) PerUser() func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            identity, ok := IdentityFromContext(r.Context())
+            if !ok {
+                challenge(w, nil)
+                return
+            }
+
+            user := "user:" + identity.UserID
+            if !l.take(w, r, user, l.User) {
+                return
+            }
+            for _, route := range l.Routes {
+                if route.matches(r) {
+                    if !l.take(w, r, "route:"+route.String()+":"+user, route.Limit) {
+                        return
+                    }
+                    break
+                }
+            }
+
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+// take spends a token of the bucket at key, answering 429 with Retry-After when it is
+// empty. Requests pass when the store fails, since refusing all traffic because of the
+// limiter would be worse than briefly not limiting.
+func (l *RateLimiter) take(w http.ResponseWriter, r *http.Request, key string, limit ratelimit.Limit) bool {
+    if limit.Unlimited() {
+        return true
+    }
+
+    result, err := l.Store.Take(r.Context(), key, limit)
+    if err != nil {
+        log.Printf("Rate limiting %s failed: %v", key, err)
+        return true
+    }
+
+    w.Header().Set("X-RateLimit-Limit", limit.String())
+    w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+    if result.Allowed {
+        return true
+    }
+
+    retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+    if retryAfter < 1 {
+        retryAfter = 1
+    }
+    w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+    http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+    return false
+}
+
+func (l *RateLimiter) clientIP(r *http.Request) string {
+    if l.TrustProxy {
+        forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+        if ip := strings.TrimSpace(forwarded[len(forwarded)-1]); ip != "" {
+            return ip
+        }
+    }
+
+    ip, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        return r.RemoteAddr
+    }
+    return ip
+}
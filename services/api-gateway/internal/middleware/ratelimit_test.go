@@ -0,0 +1,105 @@
+package middleware
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "testing"
+    "time"
+
+    "devops-ide/pkg/authtoken"
+    "devops-ide/services/api-gateway/internal/ratelimit"
+)
+
+func TestRouteLimitMatches(t *testing.T) {
+    tests := []struct {
+        route    RouteLimit
+        method   string
+        path     string
+        expected bool
+    }{
+        {RouteLimit{Method: "POST", Prefix: "/jenkins/"}, "POST", "/jenkins/job/api/build", true},
+        {RouteLimit{Method: "POST", Prefix: "/jenkins/"}, "GET", "/jenkins/job/api/build", false},
+        {RouteLimit{Prefix: "/jenkins/"}, "GET", "/jenkins/jobs", true},
+        {RouteLimit{Prefix: "/jenkins/*/build"}, "POST", "/jenkins/api/build", true},
+        {RouteLimit{Prefix: "/jenkins/*/build"}, "POST", "/jenkins/api/tests", false},
+        {RouteLimit{Method: "POST", Prefix: "/api/images/**/scan"}, "POST", "/api/images/nginx/scan", true},
+        {RouteLimit{Method: "POST", Prefix: "/api/images/**/scan"}, "POST", "/api/images/registry.example.com/team/web:1.0/scan", true},
+        {RouteLimit{Method: "POST", Prefix: "/api/images/**/scan"}, "POST", "/api/images/scan", false},
+        {RouteLimit{Method: "POST", Prefix: "/api/images/**/scan"}, "POST", "/api/images/nginx/tag", false},
+        {RouteLimit{Method: "POST", Prefix: "/api/images/build"}, "POST", "/api/images/build", true},
+    }
+
+    for _, test := range tests {
+        r := httptest.NewRequest(test.method, test.path, nil)
+        if matched := test.route.matches(r); matched != test.expected {
+            t.Errorf("%s against %s %s: expected %v", test.route, test.method, test.path, test.expected)
+        }
+    }
+}
+
+// serve sends a request through the middleware as the given user, or anonymously when
+// the user is empty
+func serve(handler http.Handler, method, path, user string) *httptest.ResponseRecorder {
+    r := httptest.NewRequest(method, path, nil)
+    r.RemoteAddr = "192.0.2.1:40000"
+    if user != "" {
+        r = r.WithContext(context.WithValue(r.Context(), identityKey, &authtoken.Identity{UserID: user}))
+    }
+
+    w := httptest.NewRecorder()
+    handler.ServeHTTP(w, r)
+    return w
+}
+
+func TestRateLimiterPerIP(t *testing.T) {
+    limiter := &RateLimiter{Store: ratelimit.NewMemoryStore(), IP: ratelimit.Limit{Requests: 2, Per: time.Minute}}
+    handler := limiter.PerIP()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+    for i := 0; i < 2; i++ {
+        if w := serve(handler, "GET", "/files/", ""); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Remaining") != strconv.Itoa(1-i) {
+            t.Fatalf("request %d: expected 200 with %d remaining, got %d %v", i+1, 1-i, w.Code, w.Header())
+        }
+    }
+
+    w := serve(handler, "GET", "/files/", "")
+    if w.Code != http.StatusTooManyRequests {
+        t.Fatalf("expected 429, got %d", w.Code)
+    }
+    // One token comes back every 30 seconds
+    if retryAfter, _ := strconv.Atoi(w.Header().Get("Retry-After")); retryAfter < 29 || retryAfter > 30 {
+        t.Fatalf("expected Retry-After of about 30 seconds, got %q", w.Header().Get("Retry-After"))
+    }
+    if limit := w.Header().Get("X-RateLimit-Limit"); limit != "2/1m" {
+        t.Fatalf("expected X-RateLimit-Limit 2/1m, got %q", limit)
+    }
+}
+
+func TestRateLimiterPerUserRoutes(t *testing.T) {
+    limiter := &RateLimiter{
+        Store: ratelimit.NewMemoryStore(),
+        User:  ratelimit.Limit{Requests: 100, Per: time.Minute},
+        Routes: []RouteLimit{
+            {Method: "POST", Prefix: "/api/images/build", Limit: ratelimit.Limit{Requests: 1, Per: time.Minute}},
+        },
+    }
+    handler := limiter.PerUser()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+    codes := []int{
+        serve(handler, "POST", "/api/images/build", "alice").Code,
+        serve(handler, "POST", "/api/images/build", "alice").Code,
+        serve(handler, "GET", "/api/images", "alice").Code,
+        serve(handler, "POST", "/api/images/build", "bob").Code,
+    }
+    expected := []int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK, http.StatusOK}
+    for i := range expected {
+        if codes[i] != expected[i] {
+            t.Fatalf("expected %v, got %v", expected, codes)
+        }
+    }
+
+    if w := serve(handler, "GET", "/api/images", ""); w.Code != http.StatusUnauthorized {
+        t.Fatalf("expected requests without an identity to be refused, got %d", w.Code)
+    }
+}
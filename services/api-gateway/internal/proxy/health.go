@@ -0,0 +1,154 @@
+package proxy
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// Registry holds the upstream services and actively checks the health of their instances
+type Registry struct {
+    Interval time.Duration
+    Timeout  time.Duration
+
+    client    *http.Client
+    upstreams []*Upstream
+}
+
+// InstanceStatus is the health of one instance as reported by the gateway /health
+type InstanceStatus struct {
+    URL               string     `json:"url"`
+    Healthy           bool       `json:"healthy"`
+    ActiveConnections int64      `json:"active_connections"`
+    LastChecked       *time.Time `json:"last_checked,omitempty"`
+    LastError         string     `json:"last_error,omitempty"`
+}
+
+// UpstreamStatus summarizes the instances of a service. Status is "ok" when every
+// instance is healthy, "degraded" when some are and "down" when none is.
+type UpstreamStatus struct {
+    Status           string           `json:"status"`
+    Strategy         Strategy         `json:"strategy"`
+    HealthyInstances int              `json:"healthy_instances"`
+    Instances        []InstanceStatus `json:"instances"`
+}
+
+// NewRegistry creates a registry checking every 10 seconds by default
+func NewRegistry(upstreams ...*Upstream) *Registry {
+    return &Registry{
+        Interval:  10 * time.Second,
+        Timeout:   2 * time.Second,
+        client:    &http.Client{},
+        upstreams: upstreams,
+    }
+}
+
+// Get returns the upstream of a service, nil when it is not configured
+func (r *Registry) Get(name string) *Upstream {
+    for _, upstream := range r.upstreams {
+        if upstream.Name == name {
+            return upstream
+        }
+    }
+    return nil
+}
+
+// Run checks all instances right away and then every Interval until ctx is done
+func (r *Registry) Run(ctx context.Context) {
+    ticker := time.NewTicker(r.Interval)
+    defer ticker.Stop()
+
+    for {
+        r.CheckAll(ctx)
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// CheckAll checks every instance concurrently, so one slow instance does not delay the others
+func (r *Registry) CheckAll(ctx context.Context) {
+    var wg sync.WaitGroup
+    for _, upstream := range r.upstreams {
+        for _, instance := range upstream.instances {
+            wg.Add(1)
+            go func(upstream *Upstream, instance *Instance) {
+                defer wg.Done()
+                upstream.record(instance, r.check(ctx, upstream, instance), true)
+            }(upstream, instance)
+        }
+    }
+    wg.Wait()
+}
+
+func (r *Registry) check(ctx context.Context, upstream *Upstream, instance *Instance) error {
+    ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+    defer cancel()
+
+    target := *instance.URL
+    target.Path = upstream.HealthPath
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+    if err != nil {
+        return err
+    }
+
+    resp, err := r.client.Do(req)
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+
+    if resp.StatusCode >= http.StatusInternalServerError {
+        return fmt.Errorf("health check returned %s", resp.Status)
+    }
+    return nil
+}
+
+// Status reports the health of every upstream and whether all instances are healthy
+func (r *Registry) Status() (map[string]UpstreamStatus, bool) {
+    statuses := make(map[string]UpstreamStatus, len(r.upstreams))
+    allHealthy := true
+
+    for _, upstream := range r.upstreams {
+        status := UpstreamStatus{Strategy: upstream.Strategy, Instances: []InstanceStatus{}}
+        for _, instance := range upstream.instances {
+            instance.mu.Lock()
+            entry := InstanceStatus{
+                URL:               instance.URL.String(),
+                Healthy:           instance.healthy,
+                ActiveConnections: atomic.LoadInt64(&instance.active),
+                LastError:         instance.lastError,
+            }
+            if !instance.lastChecked.IsZero() {
+                checked := instance.lastChecked
+                entry.LastChecked = &checked
+            }
+            instance.mu.Unlock()
+
+            if entry.Healthy {
+                status.HealthyInstances++
+            }
+            status.Instances = append(status.Instances, entry)
+        }
+
+        switch status.HealthyInstances {
+        case len(upstream.instances):
+            status.Status = "ok"
+        case 0:
+            status.Status = "down"
+        default:
+            status.Status = "degraded"
+        }
+        if status.Status != "ok" {
+            allHealthy = false
+        }
+        statuses[upstream.Name] = status
+    }
+    return statuses, allHealthy
+}
@@ -1,15 +1,199 @@
 package proxy
 
 import (
+    "fmt"
+    "log"
     "net/http"
     "net/http/httputil"
     "net/url"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
 )
 
-func CreateServiceProxy(targetURL string) http.Handler {
-    url, err := url.Parse("http://" + targetURL)
+// Strategy picks the instance that serves a request
+type Strategy string
+
+const (
+    RoundRobin       Strategy = "round_robin"
+    LeastConnections Strategy = "least_connections"
+)
+
+// ParseStrategy reads a strategy name, accepting dashes as well as underscores
+func ParseStrategy(name string) (Strategy, error) {
+    switch Strategy(strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "-", "_")) {
+    case RoundRobin, "":
+        return RoundRobin, nil
+    case LeastConnections:
+        return LeastConnections, nil
+    default:
+        return "", fmt.Errorf("unknown load balancing strategy %q", name)
+    }
+}
+
+// Instance is one server of an upstream service
+type Instance struct {
+    URL   *url.URL
+    proxy *httputil.ReverseProxy
+
+    // active counts requests in flight, including open websocket connections
+    active int64
+
+    mu          sync.Mutex
+    healthy     bool
+    failures    int
+    successes   int
+    lastChecked time.Time
+    lastError   string
+}
+
+// Healthy reports whether the instance receives traffic
+func (i *Instance) Healthy() bool {
+    i.mu.Lock()
+    defer i.mu.Unlock()
+    return i.healthy
+}
+
+// Upstream balances requests over the healthy instances of a service
+type Upstream struct {
+    Name     string
+    Strategy Strategy
+    // HealthPath is requested by health checks, any answer below 500 counts as healthy
+    HealthPath string
+    // Instances turn unhealthy after FailThreshold failures in a row and healthy again
+    // after RiseThreshold successful health checks in a row
+    FailThreshold int
+    RiseThreshold int
+
+    instances []*Instance
+    next      uint64
+}
+
+// NewUpstream creates an upstream for the instance URLs. Instances start healthy so
+// traffic flows before the first health check.
+func NewUpstream(name string, urls []string, strategy Strategy) (*Upstream, error) {
+    if len(urls) == 0 {
+        return nil, fmt.Errorf("upstream %s has no instances", name)
+    }
+
+    upstream := &Upstream{Name: name, Strategy: strategy, HealthPath: "/health", FailThreshold: 3, RiseThreshold: 2}
+    for _, raw := range urls {
+        target, err := parseInstanceURL(raw)
+        if err != nil {
+            return nil, fmt.Errorf("upstream %s: %v", name, err)
+        }
+
+        instance := &Instance{URL: target, healthy: true}
+        instance.proxy = httputil.NewSingleHostReverseProxy(target)
+        instance.proxy.ErrorHandler = upstream.errorHandler(instance)
+        upstream.instances = append(upstream.instances, instance)
+    }
+    return upstream, nil
+}
+
+// parseInstanceURL accepts "http://host:port", "https://host:port" or a bare "host:port"
+func parseInstanceURL(raw string) (*url.URL, error) {
+    raw = strings.TrimSpace(raw)
+    if !strings.Contains(raw, "://") {
+        raw = "http://" + raw
+    }
+
+    target, err := url.Parse(raw)
     if err != nil {
-        panic(err)
+        return nil, fmt.Errorf("invalid instance URL %q: %v", raw, err)
+    }
+    if (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+        return nil, fmt.Errorf("invalid instance URL %q: expected http(s)://host:port", raw)
+    }
+    return target, nil
+}
+
+// ServeHTTP proxies the request to an instance chosen by the strategy, or answers 503
+// when every instance is ejected
+func (u *Upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    instance := u.pick()
+    if instance == nil {
+        http.Error(w, fmt.Sprintf("No healthy %s instance", u.Name), http.StatusServiceUnavailable)
+        return
+    }
+
+    atomic.AddInt64(&instance.active, 1)
+    defer atomic.AddInt64(&instance.active, -1)
+    instance.proxy.ServeHTTP(w, r)
+}
+
+func (u *Upstream) pick() *Instance {
+    healthy := make([]*Instance, 0, len(u.instances))
+    for _, instance := range u.instances {
+        if instance.Healthy() {
+            healthy = append(healthy, instance)
+        }
+    }
+    if len(healthy) == 0 {
+        return nil
+    }
+
+    // Starting from the next round robin position also spreads ties between equally
+    // loaded instances
+    start := int(atomic.AddUint64(&u.next, 1) % uint64(len(healthy)))
+    if u.Strategy != LeastConnections {
+        return healthy[start]
+    }
+
+    chosen := healthy[start]
+    for n := 1; n < len(healthy); n++ {
+        candidate := healthy[(start+n)%len(healthy)]
+        if atomic.LoadInt64(&candidate.active) < atomic.LoadInt64(&chosen.active) {
+            chosen = candidate
+        }
+    }
+    return chosen
+}
+
+// errorHandler answers 502 when an instance cannot be reached and counts the failure, so
+// a dead instance is ejected without waiting for the next health check
+func (u *Upstream) errorHandler(instance *Instance) func(http.ResponseWriter, *http.Request, error) {
+    return func(w http.ResponseWriter, r *http.Request, err error) {
+        log.Printf("Proxying %s %s to %s failed: %v", r.Method, r.URL.Path, instance.URL.Host, err)
+        if r.Context().Err() == nil {
+            u.record(instance, err, false)
+        }
+        w.WriteHeader(http.StatusBadGateway)
+    }
+}
+
+// record updates the health of an instance after a check or a proxied request. Passive
+// results from proxied requests can eject an instance but only health checks restore it.
+func (u *Upstream) record(instance *Instance, err error, check bool) {
+    instance.mu.Lock()
+    defer instance.mu.Unlock()
+
+    if check {
+        instance.lastChecked = time.Now()
+    }
+
+    if err == nil {
+        instance.failures = 0
+        instance.lastError = ""
+        if !check || instance.healthy {
+            return
+        }
+
+        instance.successes++
+        if instance.successes >= u.RiseThreshold {
+            instance.healthy = true
+            instance.successes = 0
+            log.Printf("Upstream %s instance %s is healthy again", u.Name, instance.URL.Host)
+        }
+        return
+    }
+
+    instance.successes = 0
+    instance.failures++
+    instance.lastError = err.Error()
+    if instance.healthy && instance.failures >= u.FailThreshold {
+        instance.healthy = false
+        log.Printf("Upstream %s instance %s ejected: %v", u.Name, instance.URL.Host, err)
     }
-    return httputil.NewSingleHostReverseProxy(url)
 }
\ No newline at end of file
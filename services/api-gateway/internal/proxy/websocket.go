@@ -0,0 +1,235 @@
+package proxy
+
+import (
+    "bufio"
+    "context"
+    "crypto/tls"
+    "hash/fnv"
+    "io"
+    "log"
+    "net"
+    "net/http"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// WebsocketProxy relays websocket connections to the instances of an upstream. All
+// connections with the same sticky key go to the same instance while it is healthy, so
+// state the service keeps per client survives reconnects.
+type WebsocketProxy struct {
+    Upstream *Upstream
+    // IdleTimeout closes connections without traffic in either direction for this long,
+    // zero keeps them open until a side closes
+    IdleTimeout time.Duration
+    // StickyKey returns the key a request is routed by, the client IP when it returns ""
+    StickyKey func(r *http.Request) string
+
+    dialer net.Dialer
+}
+
+// NewWebsocketProxy creates a proxy with a 10 minute idle timeout
+func NewWebsocketProxy(upstream *Upstream) *WebsocketProxy {
+    return &WebsocketProxy{
+        Upstream:    upstream,
+        IdleTimeout: 10 * time.Minute,
+        dialer:      net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second},
+    }
+}
+
+func (p *WebsocketProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    instance := p.pick(r)
+    if instance == nil {
+        http.Error(w, "No healthy "+p.Upstream.Name+" instance", http.StatusServiceUnavailable)
+        return
+    }
+
+    atomic.AddInt64(&instance.active, 1)
+    defer atomic.AddInt64(&instance.active, -1)
+
+    if !isWebsocketUpgrade(r) {
+        instance.proxy.ServeHTTP(w, r)
+        return
+    }
+
+    if err := p.relay(w, r, instance); err != nil {
+        log.Printf("Websocket proxy to %s failed: %v", instance.URL.Host, err)
+    }
+}
+
+// pick chooses an instance by rendezvous hashing, which keeps every key on its instance
+// unless that instance is ejected, and then only moves the keys it had
+func (p *WebsocketProxy) pick(r *http.Request) *Instance {
+    key := ""
+    if p.StickyKey != nil {
+        key = p.StickyKey(r)
+    }
+    if key == "" {
+        key, _, _ = net.SplitHostPort(r.RemoteAddr)
+    }
+
+    var chosen *Instance
+    var best uint64
+    for _, instance := range p.Upstream.instances {
+        if !instance.Healthy() {
+            continue
+        }
+
+        h := fnv.New64a()
+        io.WriteString(h, key)
+        io.WriteString(h, "|")
+        io.WriteString(h, instance.URL.Host)
+        if score := h.Sum64(); chosen == nil || score > best {
+            chosen, best = instance, score
+        }
+    }
+    return chosen
+}
+
+// relay forwards the handshake and, once the instance switched protocols, copies bytes
+// in both directions until either side closes or the connection is idle too long
+func (p *WebsocketProxy) relay(w http.ResponseWriter, r *http.Request, instance *Instance) error {
+    backend, err := p.dial(r.Context(), instance)
+    if err != nil {
+        p.Upstream.record(instance, err, false)
+        http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+        return err
+    }
+    defer backend.Close()
+
+    outreq := r.Clone(r.Context())
+    outreq.URL.Scheme = instance.URL.Scheme
+    outreq.URL.Host = instance.URL.Host
+    outreq.RequestURI = ""
+    if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+        if prior := outreq.Header.Get("X-Forwarded-For"); prior != "" {
+            ip = prior + ", " + ip
+        }
+        outreq.Header.Set("X-Forwarded-For", ip)
+    }
+    if err := outreq.Write(backend); err != nil {
+        http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+        return err
+    }
+
+    backendReader := bufio.NewReader(backend)
+    resp, err := http.ReadResponse(backendReader, outreq)
+    if err != nil {
+        http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+        return err
+    }
+    defer resp.Body.Close()
+
+    // A refused handshake is passed on as an ordinary response
+    if resp.StatusCode != http.StatusSwitchingProtocols {
+        for name, values := range resp.Header {
+            w.Header()[name] = values
+        }
+        w.WriteHeader(resp.StatusCode)
+        io.Copy(w, resp.Body)
+        return nil
+    }
+
+    client, clientBuf, err := http.NewResponseController(w).Hijack()
+    if err != nil {
+        http.Error(w, "Websocket proxying is not supported", http.StatusInternalServerError)
+        return err
+    }
+    defer client.Close()
+
+    if err := resp.Write(client); err != nil {
+        return err
+    }
+
+    p.pipe(client, clientBuf.Reader, backend, backendReader)
+    return nil
+}
+
+func (p *WebsocketProxy) dial(ctx context.Context, instance *Instance) (net.Conn, error) {
+    host := instance.URL.Host
+    if instance.URL.Port() == "" {
+        if instance.URL.Scheme == "https" {
+            host += ":443"
+        } else {
+            host += ":80"
+        }
+    }
+
+    if instance.URL.Scheme == "https" {
+        dialer := &tls.Dialer{NetDialer: &p.dialer, Config: &tls.Config{ServerName: instance.URL.Hostname()}}
+        return dialer.DialContext(ctx, "tcp", host)
+    }
+    return p.dialer.DialContext(ctx, "tcp", host)
+}
+
+// pipe copies both directions. Buffered readers are read from so bytes already read
+// past the handshake are not lost.
+func (p *WebsocketProxy) pipe(client net.Conn, fromClient io.Reader, backend net.Conn, fromBackend io.Reader) {
+    var lastActivity int64
+    touch := func() { atomic.StoreInt64(&lastActivity, time.Now().UnixNano()) }
+    touch()
+
+    var once sync.Once
+    closeBoth := func() {
+        once.Do(func() {
+            client.Close()
+            backend.Close()
+        })
+    }
+
+    done := make(chan struct{}, 2)
+    copyStream := func(dst net.Conn, src io.Reader) {
+        io.Copy(dst, &activityReader{src: src, touch: touch})
+        closeBoth()
+        done <- struct{}{}
+    }
+    go copyStream(backend, fromClient)
+    go copyStream(client, fromBackend)
+
+    if p.IdleTimeout <= 0 {
+        <-done
+        <-done
+        return
+    }
+
+    ticker := time.NewTicker(p.IdleTimeout / 10)
+    defer ticker.Stop()
+    for finished := 0; finished < 2; {
+        select {
+        case <-done:
+            finished++
+        case <-ticker.C:
+            if time.Since(time.Unix(0, atomic.LoadInt64(&lastActivity))) >= p.IdleTimeout {
+                closeBoth()
+            }
+        }
+    }
+}
+
+// activityReader notes the time of every successful read
+type activityReader struct {
+    src   io.Reader
+    touch func()
+}
+
+func (r *activityReader) Read(b []byte) (int, error) {
+    n, err := r.src.Read(b)
+    if n > 0 {
+        r.touch()
+    }
+    return n, err
+}
+
+// isWebsocketUpgrade reports whether the request asks to switch to the websocket protocol
+func isWebsocketUpgrade(r *http.Request) bool {
+    if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+        return false
+    }
+    for _, value := range strings.Split(r.Header.Get("Connection"), ",") {
+        if strings.EqualFold(strings.TrimSpace(value), "upgrade") {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+    "context"
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Limit allows Requests per Per, as a token bucket holding up to Requests tokens that
+// refills continuously. The zero Limit allows everything.
+type Limit struct {
+    Requests int
+    Per      time.Duration
+}
+
+// Unlimited reports whether the limit is disabled
+func (l Limit) Unlimited() bool {
+    return l.Requests <= 0 || l.Per <= 0
+}
+
+// rate returns the tokens added per second
+func (l Limit) rate() float64 {
+    return float64(l.Requests) / l.Per.Seconds()
+}
+
+func (l Limit) String() string {
+    if l.Unlimited() {
+        return "off"
+    }
+    // Drop the zero units time.Duration prints, so 1m0s reads as 1m like in the configuration
+    per := l.Per.String()
+    if strings.HasSuffix(per, "m0s") {
+        per = strings.TrimSuffix(per, "0s")
+    }
+    if strings.HasSuffix(per, "h0m") {
+        per = strings.TrimSuffix(per, "0m")
+    }
+    return fmt.Sprintf("%d/%s", l.Requests, per)
+}
+
+// ParseLimit reads "<requests>/<duration>" such as "300/1m" or "10/s". "off", "0" and
+// an empty string disable the limit.
+func ParseLimit(value string) (Limit, error) {
+    value = strings.TrimSpace(value)
+    if value == "" || value == "0" || strings.EqualFold(value, "off") {
+        return Limit{}, nil
+    }
+
+    count, period, found := strings.Cut(value, "/")
+    if !found {
+        return Limit{}, fmt.Errorf("invalid limit %q: expected <requests>/<duration>", value)
+    }
+
+    requests, err := strconv.Atoi(strings.TrimSpace(count))
+    if err != nil || requests < 0 {
+        return Limit{}, fmt.Errorf("invalid limit %q: request count must be a positive number", value)
+    }
+
+    period = strings.TrimSpace(period)
+    if period != "" && (period[0] < '0' || period[0] > '9') {
+        period = "1" + period
+    }
+    per, err := time.ParseDuration(period)
+    if err != nil || per <= 0 {
+        return Limit{}, fmt.Errorf("invalid limit %q: duration must be positive, such as 1m", value)
+    }
+    return Limit{Requests: requests, Per: per}, nil
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+    Allowed bool
+    // Remaining is the number of whole tokens left in the bucket
+    Remaining int
+    // RetryAfter is how long until a token is available, zero when the request is allowed
+    RetryAfter time.Duration
+}
+
+// Store keeps the token buckets. Keys share a bucket across every limit they are used
+// with, so callers include the limit scope in the key.
+type Store interface {
+    Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// bucket is a token bucket of the memory store
+type bucket struct {
+    tokens  float64
+    updated time.Time
+    per     time.Duration
+}
+
+// MemoryStore keeps buckets in the gateway process. Each replica enforces its own
+// budget, so it stands in for the Redis store in development and tests.
+type MemoryStore struct {
+    mu        sync.Mutex
+    buckets   map[string]*bucket
+    lastSweep time.Time
+}
+
+// NewMemoryStore creates an empty memory store
+func NewMemoryStore() *MemoryStore {
+    return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+    if limit.Unlimited() {
+        return Result{Allowed: true, Remaining: math.MaxInt32}, nil
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now := time.Now()
+    s.sweep(now)
+
+    b, ok := s.buckets[key]
+    if !ok {
+        b = &bucket{tokens: float64(limit.Requests), updated: now}
+        s.buckets[key] = b
+    }
+    b.per = limit.Per
+
+    rate := limit.rate()
+    b.tokens = math.Min(float64(limit.Requests), b.tokens+now.Sub(b.updated).Seconds()*rate)
+    b.updated = now
+
+    if b.tokens < 1 {
+        wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+        return Result{RetryAfter: wait}, nil
+    }
+    b.tokens--
+    return Result{Allowed: true, Remaining: int(b.tokens)}, nil
+}
+
+// sweep drops buckets that have refilled completely, at most once a minute, so keys of
+// clients that went away do not accumulate
+func (s *MemoryStore) sweep(now time.Time) {
+    if now.Sub(s.lastSweep) < time.Minute {
+        return
+    }
+    s.lastSweep = now
+
+    for key, b := range s.buckets {
+        if now.Sub(b.updated) > b.per {
+            delete(s.buckets, key)
+        }
+    }
+}
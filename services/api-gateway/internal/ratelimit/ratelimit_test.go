@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/alicebob/miniredis/v2"
+)
+
+func TestParseLimit(t *testing.T) {
+    for value, expected := range map[string]Limit{
+        "300/1m":  {Requests: 300, Per: time.Minute},
+        "10/s":    {Requests: 10, Per: time.Second},
+        " 5 / h ": {Requests: 5, Per: time.Hour},
+        "off":     {},
+        "":        {},
+    } {
+        limit, err := ParseLimit(value)
+        if err != nil || limit != expected {
+            t.Errorf("%q: expected %v, got %v (%v)", value, expected, limit, err)
+        }
+    }
+
+    for _, value := range []string{"300", "x/1m", "-1/1m", "10/0s", "10/soon"} {
+        if _, err := ParseLimit(value); err == nil {
+            t.Errorf("%q: expected an error", value)
+        }
+    }
+
+    if s := (Limit{Requests: 20, Per: time.Minute}).String(); s != "20/1m" {
+        t.Errorf("expected 20/1m, got %s", s)
+    }
+}
+
+// takeAll spends the whole bucket and checks the request after it is refused
+func takeAll(t *testing.T, store Store, key string, limit Limit) Result {
+    t.Helper()
+    ctx := context.Background()
+
+    for i := 0; i < limit.Requests; i++ {
+        result, err := store.Take(ctx, key, limit)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !result.Allowed || result.Remaining != limit.Requests-i-1 {
+            t.Fatalf("request %d: expected to be allowed with %d remaining, got %+v", i+1, limit.Requests-i-1, result)
+        }
+    }
+
+    result, err := store.Take(ctx, key, limit)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if result.Allowed || result.RetryAfter <= 0 || result.RetryAfter > limit.Per/time.Duration(limit.Requests) {
+        t.Fatalf("expected an empty bucket to refuse with a retry within one refill, got %+v", result)
+    }
+    return result
+}
+
+func TestMemoryStoreTokenBucket(t *testing.T) {
+    store := NewMemoryStore()
+    limit := Limit{Requests: 3, Per: 300 * time.Millisecond}
+
+    result := takeAll(t, store, "user:1", limit)
+
+    // Other keys have their own bucket
+    if other, _ := store.Take(context.Background(), "user:2", limit); !other.Allowed {
+        t.Fatal("expected another key to be allowed")
+    }
+
+    // A token is back once RetryAfter has passed
+    time.Sleep(result.RetryAfter + 10*time.Millisecond)
+    if refilled, _ := store.Take(context.Background(), "user:1", limit); !refilled.Allowed {
+        t.Fatalf("expected a refilled token after %s, got %+v", result.RetryAfter, refilled)
+    }
+
+    if unlimited, _ := store.Take(context.Background(), "user:1", Limit{}); !unlimited.Allowed {
+        t.Fatal("expected the zero limit to allow everything")
+    }
+}
+
+func TestRedisStore(t *testing.T) {
+    server := miniredis.RunT(t)
+    limit := Limit{Requests: 3, Per: time.Minute}
+
+    replica, err := NewRedisStore("redis://" + server.Addr())
+    if err != nil {
+        t.Fatal(err)
+    }
+    takeAll(t, replica, "user:1", limit)
+
+    if ttl := server.TTL("ratelimit:user:1"); ttl <= 0 || ttl > limit.Per+time.Second {
+        t.Fatalf("expected the bucket to expire once it would be full again, got a TTL of %s", ttl)
+    }
+
+    // Replicas share the bucket
+    other, err := NewRedisStore("redis://" + server.Addr())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if result, err := other.Take(context.Background(), "user:1", limit); err != nil || result.Allowed {
+        t.Fatalf("expected another replica to see the empty bucket, got %+v (%v)", result, err)
+    }
+
+    // Without Redis each replica limits on its own
+    server.Close()
+    if result, err := replica.Take(context.Background(), "user:1", limit); err != nil || !result.Allowed {
+        t.Fatalf("expected the local fallback to allow the request, got %+v (%v)", result, err)
+    }
+
+    replica.Fallback = nil
+    if _, err := replica.Take(context.Background(), "user:1", limit); err == nil {
+        t.Fatal("expected an error without Redis and without fallback")
+    }
+}
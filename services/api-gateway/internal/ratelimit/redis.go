@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "math"
+    "sync"
+    "time"
+
+    "github.com/redis/go-redis/v9"
+)
+
+// takeScript refills and takes from a bucket atomically. It reads the clock of the
+// Redis server so gateway replicas with skewed clocks agree on the refill.
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) * 1000000 + tonumber(clock[2])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1])
+local updated = tonumber(state[2])
+if tokens == nil then
+    tokens = capacity
+    updated = now
+end
+
+tokens = math.min(capacity, tokens + math.max(0, now - updated) / 1000000 * rate)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+    tokens = tokens - 1
+    allowed = 1
+else
+    retry = math.ceil((1 - tokens) / rate * 1000)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate * 1000) + 1000)
+return {allowed, math.floor(tokens), retry}
+`)
+
+// RedisStore shares buckets between gateway replicas through Redis. When Redis cannot
+// be reached it takes from Fallback instead, so limits still apply per replica.
+type RedisStore struct {
+    Client *redis.Client
+    // Prefix is prepended to every key
+    Prefix   string
+    Fallback Store
+
+    mu        sync.Mutex
+    lastError time.Time
+}
+
+// NewRedisStore connects to a redis:// URL, falling back to a memory store on errors
+func NewRedisStore(url string) (*RedisStore, error) {
+    options, err := redis.ParseURL(url)
+    if err != nil {
+        return nil, fmt.Errorf("invalid Redis URL: %v", err)
+    }
+
+    return &RedisStore{
+        Client:   redis.NewClient(options),
+        Prefix:   "ratelimit:",
+        Fallback: NewMemoryStore(),
+    }, nil
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+    if limit.Unlimited() {
+        return Result{Allowed: true, Remaining: math.MaxInt32}, nil
+    }
+
+    values, err := takeScript.Run(ctx, s.Client, []string{s.Prefix + key}, limit.Requests, limit.rate()).Int64Slice()
+    if err == nil && len(values) != 3 {
+        err = fmt.Errorf("unexpected rate limit script result %v", values)
+    }
+    if err != nil {
+        if s.Fallback == nil {
+            return Result{}, err
+        }
+        s.logError(err)
+        return s.Fallback.Take(ctx, key, limit)
+    }
+
+    return Result{
+        Allowed:    values[0] == 1,
+        Remaining:  int(values[1]),
+        RetryAfter: time.Duration(values[2]) * time.Millisecond,
+    }, nil
+}
+
+// logError reports Redis failures at most once a minute, since every request fails
+// the same way while Redis is down
+func (s *RedisStore) logError(err error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if time.Since(s.lastError) < time.Minute {
+        return
+    }
+    s.lastError = time.Now()
+    log.Printf("Rate limiting with Redis failed, using local limits: %v", err)
+}
@@ -1,38 +1,118 @@
 package main
 
 import (
+    "context"
+    "encoding/json"
     "log"
     "net/http"
+    "os"
+    "time"
+
+    "devops-ide/pkg/authtoken"
+    "devops-ide/services/api-gateway/internal/middleware"
+    "devops-ide/services/api-gateway/internal/proxy"
 
     "github.com/gorilla/mux"
     "github.com/rs/cors"
 )
 
+// upstreams routes requests to the healthy instances of each service
+var upstreams *proxy.Registry
+
 func main() {
+    var err error
+    upstreams, err = loadUpstreams()
+    if err != nil {
+        log.Fatalf("Invalid upstream configuration: %v", err)
+    }
+    go upstreams.Run(context.Background())
+
+    limiter, err := loadRateLimiter()
+    if err != nil {
+        log.Fatalf("Invalid rate limit configuration: %v", err)
+    }
+
     r := mux.NewRouter()
 
     // Routes
     r.HandleFunc("/health", healthCheckHandler).Methods("GET")
-    
-    // Service routes
-    r.PathPrefix("/auth/").Handler(createServiceProxy("auth-service:8081"))
-    r.PathPrefix("/files/").Handler(createServiceProxy("file-service:8082"))
-    r.PathPrefix("/jenkins/").Handler(createServiceProxy("jenkins-service:8083"))
-    r.PathPrefix("/kubernetes/").Handler(createServiceProxy("kubernetes-service:8084"))
-    r.PathPrefix("/terraform/").Handler(createServiceProxy("terraform-service:8085"))
+
+    // Login and token refresh happen before the caller has an access token
+    r.PathPrefix("/auth/").Handler(limiter.PerIP()(upstreams.Get("auth")))
+
+    // Everything else requires a verified bearer token
+    protected := r.PathPrefix("/").Subrouter()
+    protected.Use(limiter.PerIP(), middleware.AuthMiddleware(newTokenVerifier()), limiter.PerUser())
+    for _, service := range []string{"files", "jenkins", "kubernetes", "terraform"} {
+        protected.PathPrefix("/" + service + "/").Handler(middleware.RequireScope(service)(upstreams.Get(service)))
+    }
+
+    // The IDE backend checks the permission of every request against its access policy
+    // and the token scopes itself
+    protected.PathPrefix("/api/").Handler(upstreams.Get("backend"))
+
+    // Websocket connections stay on one instance per user so reconnects find their session
+    websocket := proxy.NewWebsocketProxy(upstreams.Get("websocket"))
+    websocket.StickyKey = func(r *http.Request) string { return r.Header.Get(middleware.UserIDHeader) }
+    if websocket.IdleTimeout, err = getDuration("WS_IDLE_TIMEOUT", websocket.IdleTimeout); err != nil {
+        log.Fatalf("Invalid websocket configuration: %v", err)
+    }
+    protected.Handle("/ws", middleware.RequireScope("websocket")(websocket))
 
     // CORS
     c := cors.New(cors.Options{
         AllowedOrigins: []string{"*"},
         AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-        AllowedHeaders: []string{"Authorization", "Content-Type"},
+        AllowedHeaders: []string{"Authorization", "Content-Type", "X-Docker-Endpoint"},
+        ExposedHeaders: []string{"Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining"},
     })
 
     handler := c.Handler(r)
     log.Fatal(http.ListenAndServe(":8080", handler))
 }
 
+// newTokenVerifier checks session tokens against the auth service signing keys and access
+// tokens against its verify endpoint. AUTH_DEV_HMAC_SECRET additionally accepts HS256
+// tokens and must only be set in local development.
+func newTokenVerifier() *authtoken.Verifier {
+    config := authtoken.Config{
+        Issuer:           getEnv("AUTH_ISSUER", "devops-ide-auth"),
+        Audience:         getEnv("AUTH_AUDIENCE", "devops-ide"),
+        JWKSURL:          getEnv("AUTH_JWKS_URL", "http://auth-service:8081/.well-known/jwks.json"),
+        IntrospectionURL: getEnv("AUTH_VERIFY_URL", "http://auth-service:8081/auth/verify"),
+        Leeway:           30 * time.Second,
+    }
+
+    if secret := os.Getenv("AUTH_DEV_HMAC_SECRET"); secret != "" {
+        log.Printf("WARNING: accepting HS256 tokens signed with AUTH_DEV_HMAC_SECRET, do not use in production")
+        config.HMACSecret = []byte(secret)
+    }
+
+    return authtoken.NewVerifier(config)
+}
+
+func getEnv(key, defaultValue string) string {
+    if value := os.Getenv(key); value != "" {
+        return value
+    }
+    return defaultValue
+}
+
+// healthCheckHandler reports the gateway as up together with the health of every
+// upstream instance. It answers 200 even when upstreams are down, since restarting the
+// gateway would not help them.
 func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
-    w.WriteHeader(http.StatusOK)
-    w.Write([]byte("API Gateway is healthy"))
+    statuses, allHealthy := upstreams.Status()
+
+    status := "ok"
+    if !allHealthy {
+        status = "degraded"
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "status":    status,
+        "upstreams": statuses,
+    })
 }
\ No newline at end of file
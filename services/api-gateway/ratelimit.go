@@ -0,0 +1,88 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "os"
+    "strings"
+
+    "devops-ide/services/api-gateway/internal/middleware"
+    "devops-ide/services/api-gateway/internal/ratelimit"
+)
+
+// defaultRouteLimits slow down routes that start image builds, scans, Jenkins builds and
+// infrastructure runs
+const defaultRouteLimits = "POST /api/images/build=10/1m,POST /api/images/**/scan=10/1m," +
+    "POST /jenkins/=20/1m,POST /terraform/=10/1m"
+
+// loadRateLimiter builds the limiter from the environment. Buckets are shared through
+// Redis when RATE_LIMIT_REDIS_URL is set and kept per gateway replica otherwise.
+func loadRateLimiter() (*middleware.RateLimiter, error) {
+    limiter := &middleware.RateLimiter{TrustProxy: os.Getenv("RATE_LIMIT_TRUST_PROXY") == "true"}
+
+    var err error
+    if limiter.IP, err = ratelimit.ParseLimit(getEnv("RATE_LIMIT_IP", "300/1m")); err != nil {
+        return nil, fmt.Errorf("RATE_LIMIT_IP: %v", err)
+    }
+    if limiter.User, err = ratelimit.ParseLimit(getEnv("RATE_LIMIT_USER", "600/1m")); err != nil {
+        return nil, fmt.Errorf("RATE_LIMIT_USER: %v", err)
+    }
+    if limiter.Routes, err = parseRouteLimits(getEnv("RATE_LIMIT_ROUTES", defaultRouteLimits)); err != nil {
+        return nil, fmt.Errorf("RATE_LIMIT_ROUTES: %v", err)
+    }
+
+    if url := os.Getenv("RATE_LIMIT_REDIS_URL"); url != "" {
+        store, err := ratelimit.NewRedisStore(url)
+        if err != nil {
+            return nil, fmt.Errorf("RATE_LIMIT_REDIS_URL: %v", err)
+        }
+        limiter.Store = store
+        log.Printf("Sharing rate limits through Redis")
+    } else {
+        limiter.Store = ratelimit.NewMemoryStore()
+    }
+    return limiter, nil
+}
+
+// parseRouteLimits reads a comma separated list of "[METHOD] /path/prefix=<limit>", such
+// as "POST /jenkins/=20/1m". "off" disables route limits.
+func parseRouteLimits(value string) ([]middleware.RouteLimit, error) {
+    if strings.EqualFold(strings.TrimSpace(value), "off") {
+        return nil, nil
+    }
+
+    var routes []middleware.RouteLimit
+    for _, entry := range strings.Split(value, ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+
+        route, rawLimit, found := strings.Cut(entry, "=")
+        if !found {
+            return nil, fmt.Errorf("invalid route limit %q: expected [METHOD] /path=<limit>", entry)
+        }
+
+        var routeLimit middleware.RouteLimit
+        fields := strings.Fields(route)
+        switch len(fields) {
+        case 1:
+            routeLimit.Prefix = fields[0]
+        case 2:
+            routeLimit.Method, routeLimit.Prefix = strings.ToUpper(fields[0]), fields[1]
+        default:
+            return nil, fmt.Errorf("invalid route limit %q: expected [METHOD] /path=<limit>", entry)
+        }
+        if !strings.HasPrefix(routeLimit.Prefix, "/") {
+            return nil, fmt.Errorf("invalid route limit %q: path must start with /", entry)
+        }
+
+        limit, err := ratelimit.ParseLimit(rawLimit)
+        if err != nil {
+            return nil, err
+        }
+        routeLimit.Limit = limit
+        routes = append(routes, routeLimit)
+    }
+    return routes, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strings"
+    "time"
+
+    "devops-ide/services/api-gateway/internal/proxy"
+)
+
+// upstreamService is a backend service the gateway routes to. Its instances are read
+// from <Env>_SERVICE_URL as a comma separated list of URLs.
+type upstreamService struct {
+    Name       string
+    Env        string
+    DefaultURL string
+}
+
+var upstreamServices = []upstreamService{
+    {Name: "auth", Env: "AUTH", DefaultURL: "http://auth-service:8081"},
+    {Name: "files", Env: "FILE", DefaultURL: "http://file-service:8082"},
+    {Name: "jenkins", Env: "JENKINS", DefaultURL: "http://jenkins-service:8083"},
+    {Name: "kubernetes", Env: "KUBERNETES", DefaultURL: "http://kubernetes-service:8084"},
+    {Name: "terraform", Env: "TERRAFORM", DefaultURL: "http://terraform-service:8085"},
+    {Name: "websocket", Env: "WEBSOCKET", DefaultURL: "http://websocket-service:8086"},
+    {Name: "backend", Env: "BACKEND", DefaultURL: "http://backend:8080"},
+}
+
+// loadUpstreams builds the upstreams from the environment. UPSTREAM_LB_STRATEGY and
+// UPSTREAM_HEALTH_PATH apply to every service unless <Env>_SERVICE_LB_STRATEGY or
+// <Env>_SERVICE_HEALTH_PATH override them.
+func loadUpstreams() (*proxy.Registry, error) {
+    var upstreams []*proxy.Upstream
+    for _, service := range upstreamServices {
+        prefix := service.Env + "_SERVICE_"
+
+        strategy, err := proxy.ParseStrategy(getEnv(prefix+"LB_STRATEGY", os.Getenv("UPSTREAM_LB_STRATEGY")))
+        if err != nil {
+            return nil, fmt.Errorf("%sLB_STRATEGY: %v", prefix, err)
+        }
+
+        var urls []string
+        for _, url := range strings.Split(getEnv(prefix+"URL", service.DefaultURL), ",") {
+            if url = strings.TrimSpace(url); url != "" {
+                urls = append(urls, url)
+            }
+        }
+
+        upstream, err := proxy.NewUpstream(service.Name, urls, strategy)
+        if err != nil {
+            return nil, err
+        }
+        upstream.HealthPath = getEnv(prefix+"HEALTH_PATH", getEnv("UPSTREAM_HEALTH_PATH", upstream.HealthPath))
+        upstreams = append(upstreams, upstream)
+    }
+
+    registry := proxy.NewRegistry(upstreams...)
+    interval, err := getDuration("UPSTREAM_HEALTH_INTERVAL", registry.Interval)
+    if err != nil {
+        return nil, err
+    }
+    if interval <= 0 {
+        return nil, fmt.Errorf("UPSTREAM_HEALTH_INTERVAL must be positive")
+    }
+    registry.Interval = interval
+    return registry, nil
+}
+
+func getDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+    value := os.Getenv(key)
+    if value == "" {
+        return defaultValue, nil
+    }
+
+    duration, err := time.ParseDuration(value)
+    if err != nil {
+        return 0, fmt.Errorf("invalid %s: %v", key, err)
+    }
+    return duration, nil
+}
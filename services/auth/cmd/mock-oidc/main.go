@@ -0,0 +1,42 @@
+// Command mock-oidc runs a local OpenID Connect provider that signs everyone in as
+// one configurable user, for developing the single sign-on flow without a real IdP.
+package main
+
+import (
+    "log"
+    "net/http"
+    "os"
+    "strings"
+
+    "devops-ide/services/auth/internal/mockoidc"
+)
+
+func main() {
+    addr := getEnv("MOCK_OIDC_ADDR", ":9999")
+    issuer := getEnv("MOCK_OIDC_ISSUER", "http://localhost:9999")
+
+    provider, err := mockoidc.NewProvider(
+        issuer,
+        getEnv("MOCK_OIDC_CLIENT_ID", "devops-ide"),
+        getEnv("MOCK_OIDC_CLIENT_SECRET", "devops-ide-secret"),
+        mockoidc.User{
+            Subject: getEnv("MOCK_OIDC_SUBJECT", "mock-user"),
+            Email:   getEnv("MOCK_OIDC_EMAIL", "developer@example.com"),
+            Name:    getEnv("MOCK_OIDC_NAME", "Mock Developer"),
+            Groups:  strings.Split(getEnv("MOCK_OIDC_GROUPS", "developers"), ","),
+        },
+    )
+    if err != nil {
+        log.Fatalf("Failed to create mock OIDC provider: %v", err)
+    }
+
+    log.Printf("Mock OIDC provider %s listening on %s", issuer, addr)
+    log.Fatal(http.ListenAndServe(addr, provider.Handler()))
+}
+
+func getEnv(key, defaultValue string) string {
+    if value := os.Getenv(key); value != "" {
+        return value
+    }
+    return defaultValue
+}
@@ -1,12 +1,127 @@
 package domain
 
+import (
+    "errors"
+    "time"
+)
+
+var (
+    ErrUserNotFound  = errors.New("user not found")
+    ErrEmailTaken    = errors.New("email already registered")
+    ErrTokenNotFound = errors.New("token not found")
+    // ErrTokenRevoked is returned when rotating a refresh token that was already used or revoked
+    ErrTokenRevoked = errors.New("token revoked")
+    // ErrCodeUsed is returned when a one-time password or recovery code was already used
+    ErrCodeUsed = errors.New("code already used")
+)
+
 type User struct {
-    ID       string `json:"id"`
-    Email    string `json:"email"`
-    Password string `json:"-"`
+    ID       string   `json:"id"`
+    Email    string   `json:"email"`
+    Password string   `json:"-"`
+    Roles    []string `json:"roles"`
+    // Provider and ExternalID link accounts provisioned through single sign-on to the
+    // issuer and subject of the identity provider
+    Provider   string `json:"provider,omitempty"`
+    ExternalID string `json:"-"`
+    // ServiceAccount marks non-interactive accounts that only authenticate with tokens
+    ServiceAccount bool `json:"service_account,omitempty"`
+    // MFA is changed through the store's MFA methods, UpdateUser leaves it untouched
+    MFA       MFA       `json:"mfa"`
+    CreatedAt time.Time `json:"created_at"`
+    UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MFA is the second factor state of a user. A TOTP secret is pending until the user
+// proves their authenticator produces matching codes, then MFA is enabled.
+type MFA struct {
+    Enabled   bool       `json:"enabled"`
+    EnabledAt *time.Time `json:"enabled_at,omitempty"`
+    // Secret and PendingSecret are base32 encoded TOTP secrets
+    Secret        string `json:"-"`
+    PendingSecret string `json:"-"`
+    // LastStep is the TOTP time step of the last accepted code, codes from it or earlier
+    // steps are rejected so an observed code cannot be replayed
+    LastStep int64 `json:"-"`
+    // RecoveryCodes are hashes of the unused recovery codes
+    RecoveryCodes  []string   `json:"-"`
+    FailedAttempts int        `json:"-"`
+    LastFailureAt  *time.Time `json:"-"`
+}
+
+// MFAPolicy lists the roles whose members must use a second factor
+type MFAPolicy struct {
+    RequiredRoles []string  `json:"required_roles"`
+    UpdatedAt     time.Time `json:"updated_at"`
+    UpdatedBy     string    `json:"updated_by,omitempty"`
+}
+
+// Requires reports whether any of the roles requires MFA
+func (p *MFAPolicy) Requires(roles []string) bool {
+    for _, required := range p.RequiredRoles {
+        for _, role := range roles {
+            if role == required {
+                return true
+            }
+        }
+    }
+    return false
 }
 
 type TokenPair struct {
     AccessToken  string `json:"access_token"`
     RefreshToken string `json:"refresh_token"`
+    TokenType    string `json:"token_type"`
+    ExpiresIn    int64  `json:"expires_in"`
+}
+
+// RefreshToken is the stored side of an opaque refresh token. Tokens issued by rotating
+// one another share a family, so reuse of a rotated token revokes the whole chain.
+type RefreshToken struct {
+    ID         string
+    UserID     string
+    FamilyID   string
+    TokenHash  string
+    ExpiresAt  time.Time
+    CreatedAt  time.Time
+    RevokedAt  *time.Time
+    ReplacedBy string
+}
+
+// Revoked reports whether the token was rotated or revoked
+func (t *RefreshToken) Revoked() bool {
+    return t.RevokedAt != nil
+}
+
+// AccessToken is the stored side of a personal access token or service account token.
+// Scopes narrow what the token may do to a subset of the owner's permissions.
+type AccessToken struct {
+    ID     string `json:"id"`
+    UserID string `json:"user_id"`
+    Name   string `json:"name"`
+    // Prefix is the start of the token value, shown to tell tokens apart
+    Prefix     string     `json:"prefix"`
+    TokenHash  string     `json:"-"`
+    Scopes     []string   `json:"scopes"`
+    ExpiresAt  time.Time  `json:"expires_at"`
+    CreatedAt  time.Time  `json:"created_at"`
+    LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+    RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Revoked reports whether the token was revoked
+func (t *AccessToken) Revoked() bool {
+    return t.RevokedAt != nil
+}
+
+// SigningKey is a key pair signing access tokens. Keys are published before they
+// activate and stay published after a newer key takes over, so verifiers caching the
+// key set never see a token signed with a key they do not know.
+type SigningKey struct {
+    ID        string
+    Algorithm string
+    // PrivateKey is the PKCS #8 DER encoding of the private key
+    PrivateKey  []byte
+    CreatedAt   time.Time
+    ActivatesAt time.Time
 }
\ No newline at end of file
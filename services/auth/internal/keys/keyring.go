@@ -0,0 +1,356 @@
+// Package keys signs access tokens and publishes the keys verifying them
+package keys
+
+import (
+    "context"
+    "crypto"
+    "crypto/ed25519"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "log"
+    "math/big"
+    "sort"
+    "sync"
+    "time"
+
+    "devops-ide/services/auth/internal/domain"
+    "devops-ide/services/auth/internal/store"
+
+    "github.com/golang-jwt/jwt"
+)
+
+// Supported signing algorithms. HS256 shares the secret with every verifier and is
+// meant for local development only.
+const (
+    AlgorithmRS256 = "RS256"
+    AlgorithmEdDSA = "EdDSA"
+    AlgorithmHS256 = "HS256"
+)
+
+const rsaKeyBits = 2048
+
+var (
+    ErrUnknownKey   = errors.New("unknown signing key")
+    ErrNoSigningKey = errors.New("no active signing key")
+)
+
+// Signer signs access tokens and resolves the keys that verify them
+type Signer interface {
+    Sign(claims jwt.MapClaims) (string, error)
+    // Keyfunc returns the verification key of a parsed token
+    Keyfunc(token *jwt.Token) (interface{}, error)
+    // Algorithms lists the algorithms of tokens the signer issues
+    Algorithms() []string
+}
+
+// JWK is a public key in the JSON Web Key format of RFC 7517
+type JWK struct {
+    KeyType   string `json:"kty"`
+    KeyID     string `json:"kid"`
+    Use       string `json:"use"`
+    Algorithm string `json:"alg"`
+    // RSA keys
+    N string `json:"n,omitempty"`
+    E string `json:"e,omitempty"`
+    // Ed25519 keys
+    Curve string `json:"crv,omitempty"`
+    X     string `json:"x,omitempty"`
+}
+
+// JWKS is the key set served at /.well-known/jwks.json
+type JWKS struct {
+    Keys []JWK `json:"keys"`
+}
+
+type signingKey struct {
+    domain.SigningKey
+    private crypto.Signer
+    // retiresAt is when the key stops being published, zero while no newer key is active
+    retiresAt time.Time
+}
+
+// Keyring signs with RS256 or EdDSA keys that it rotates on a schedule. A new key is
+// published Overlap before it starts signing, and the key it replaces stays published
+// for Overlap afterwards, so Overlap must exceed both the access token lifetime and
+// how long verifiers cache the key set.
+type Keyring struct {
+    Algorithm        string
+    RotationInterval time.Duration
+    Overlap          time.Duration
+
+    store store.SigningKeyStore
+    // now reads the clock, replaced by tests to step through rotations
+    now func() time.Time
+
+    mu   sync.RWMutex
+    keys []*signingKey
+}
+
+func NewKeyring(store store.SigningKeyStore, algorithm string) (*Keyring, error) {
+    if algorithm != AlgorithmRS256 && algorithm != AlgorithmEdDSA {
+        return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+    }
+
+    return &Keyring{
+        Algorithm:        algorithm,
+        RotationInterval: 30 * 24 * time.Hour,
+        Overlap:          time.Hour,
+        store:            store,
+        now:              time.Now,
+    }, nil
+}
+
+// Run rotates the keys every interval until the context is cancelled. Reloading from
+// the store also picks up keys created by other replicas.
+func (k *Keyring) Run(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ticker.C:
+            if err := k.Rotate(ctx); err != nil {
+                log.Printf("Failed to rotate signing keys: %v", err)
+            }
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+// Rotate reloads the keys from the store, creates a successor when the active key is
+// due for rotation and deletes keys whose overlap window has passed
+func (k *Keyring) Rotate(ctx context.Context) error {
+    now := k.now().UTC()
+
+    keys, err := k.load(ctx, now)
+    if err != nil {
+        return err
+    }
+
+    var active *signingKey
+    pending := false
+    for _, key := range keys {
+        if key.ActivatesAt.After(now) {
+            pending = true
+        } else {
+            active = key
+        }
+    }
+
+    switch {
+    case active == nil && !pending:
+        // Nothing was published before, so there is no cache to wait for
+        key, err := k.generate(ctx, now, now)
+        if err != nil {
+            return err
+        }
+        keys = append(keys, key)
+    case active != nil && !pending && k.rotationDue(active, now):
+        key, err := k.generate(ctx, now, now.Add(k.Overlap))
+        if err != nil {
+            return err
+        }
+        keys = append(keys, key)
+    }
+
+    published := keys[:0]
+    for _, key := range keys {
+        if !key.retiresAt.IsZero() && !now.Before(key.retiresAt) {
+            if err := k.store.DeleteSigningKey(ctx, key.ID); err != nil {
+                return err
+            }
+            log.Printf("Retired signing key %s", key.ID)
+            continue
+        }
+        published = append(published, key)
+    }
+
+    k.mu.Lock()
+    k.keys = published
+    k.mu.Unlock()
+    return nil
+}
+
+// rotationDue starts publishing the successor early enough for it to take over when the
+// active key reaches the rotation interval, or right away when the algorithm changed
+func (k *Keyring) rotationDue(active *signingKey, now time.Time) bool {
+    if active.Algorithm != k.Algorithm {
+        return true
+    }
+    return !now.Before(active.ActivatesAt.Add(k.RotationInterval - k.Overlap))
+}
+
+// load reads and parses the stored keys ordered by activation, each superseded key
+// retiring Overlap after its successor activated
+func (k *Keyring) load(ctx context.Context, now time.Time) ([]*signingKey, error) {
+    stored, err := k.store.ListSigningKeys(ctx)
+    if err != nil {
+        return nil, err
+    }
+    sort.Slice(stored, func(i, j int) bool { return stored[i].ActivatesAt.Before(stored[j].ActivatesAt) })
+
+    keys := make([]*signingKey, 0, len(stored))
+    for _, key := range stored {
+        private, err := x509.ParsePKCS8PrivateKey(key.PrivateKey)
+        if err != nil {
+            return nil, fmt.Errorf("failed to parse signing key %s: %v", key.ID, err)
+        }
+        signer, ok := private.(crypto.Signer)
+        if !ok {
+            return nil, fmt.Errorf("signing key %s has unsupported type %T", key.ID, private)
+        }
+        keys = append(keys, &signingKey{SigningKey: *key, private: signer})
+    }
+
+    for i := 0; i+1 < len(keys); i++ {
+        if next := keys[i+1]; !next.ActivatesAt.After(now) {
+            keys[i].retiresAt = next.ActivatesAt.Add(k.Overlap)
+        }
+    }
+    return keys, nil
+}
+
+func (k *Keyring) generate(ctx context.Context, now, activatesAt time.Time) (*signingKey, error) {
+    var private crypto.Signer
+    var err error
+    switch k.Algorithm {
+    case AlgorithmRS256:
+        private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+    case AlgorithmEdDSA:
+        _, private, err = ed25519.GenerateKey(rand.Reader)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    der, err := x509.MarshalPKCS8PrivateKey(private)
+    if err != nil {
+        return nil, err
+    }
+
+    id := make([]byte, 8)
+    rand.Read(id)
+
+    key := &signingKey{
+        SigningKey: domain.SigningKey{
+            ID:          hex.EncodeToString(id),
+            Algorithm:   k.Algorithm,
+            PrivateKey:  der,
+            CreatedAt:   now,
+            ActivatesAt: activatesAt,
+        },
+        private: private,
+    }
+    if err := k.store.SaveSigningKey(ctx, &key.SigningKey); err != nil {
+        return nil, err
+    }
+
+    log.Printf("Created %s signing key %s, active from %s", key.Algorithm, key.ID, activatesAt.Format(time.RFC3339))
+    return key, nil
+}
+
+// Sign signs the claims with the newest active key and names it in the kid header
+func (k *Keyring) Sign(claims jwt.MapClaims) (string, error) {
+    now := k.now()
+
+    k.mu.RLock()
+    var active *signingKey
+    for _, key := range k.keys {
+        if !key.ActivatesAt.After(now) {
+            active = key
+        }
+    }
+    k.mu.RUnlock()
+
+    if active == nil {
+        return "", ErrNoSigningKey
+    }
+
+    token := jwt.NewWithClaims(jwt.GetSigningMethod(active.Algorithm), claims)
+    token.Header["kid"] = active.ID
+    return token.SignedString(active.private)
+}
+
+func (k *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+    kid, _ := token.Header["kid"].(string)
+
+    k.mu.RLock()
+    defer k.mu.RUnlock()
+
+    for _, key := range k.keys {
+        if key.ID != kid {
+            continue
+        }
+        if token.Method.Alg() != key.Algorithm {
+            return nil, fmt.Errorf("token algorithm %s does not match key %s", token.Method.Alg(), kid)
+        }
+        return key.private.Public(), nil
+    }
+    return nil, ErrUnknownKey
+}
+
+// Algorithms includes the algorithm of keys still published after a configuration change
+func (k *Keyring) Algorithms() []string {
+    k.mu.RLock()
+    defer k.mu.RUnlock()
+
+    algorithms := []string{k.Algorithm}
+    for _, key := range k.keys {
+        if key.Algorithm != k.Algorithm {
+            algorithms = append(algorithms, key.Algorithm)
+        }
+    }
+    return algorithms
+}
+
+// JWKS returns the public keys of all published keys, including ones not active yet
+func (k *Keyring) JWKS() JWKS {
+    k.mu.RLock()
+    defer k.mu.RUnlock()
+
+    set := JWKS{Keys: []JWK{}}
+    for _, key := range k.keys {
+        jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Algorithm}
+        switch public := key.private.Public().(type) {
+        case *rsa.PublicKey:
+            jwk.KeyType = "RSA"
+            jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+            jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+        case ed25519.PublicKey:
+            jwk.KeyType = "OKP"
+            jwk.Curve = "Ed25519"
+            jwk.X = base64.RawURLEncoding.EncodeToString(public)
+        default:
+            continue
+        }
+        set.Keys = append(set.Keys, jwk)
+    }
+    return set
+}
+
+// HMACSigner signs with a shared HS256 secret, for local development only
+type HMACSigner struct {
+    secret []byte
+}
+
+func NewHMACSigner(secret string) *HMACSigner {
+    return &HMACSigner{secret: []byte(secret)}
+}
+
+func (h *HMACSigner) Sign(claims jwt.MapClaims) (string, error) {
+    return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(h.secret)
+}
+
+func (h *HMACSigner) Keyfunc(token *jwt.Token) (interface{}, error) {
+    return h.secret, nil
+}
+
+func (h *HMACSigner) Algorithms() []string {
+    return []string{AlgorithmHS256}
+}
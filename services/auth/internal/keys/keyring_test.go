@@ -0,0 +1,187 @@
+package keys
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "devops-ide/services/auth/internal/store"
+
+    "github.com/golang-jwt/jwt"
+)
+
+// testClock is a clock the tests move by hand
+type testClock struct {
+    t time.Time
+}
+
+func (c *testClock) now() time.Time {
+    return c.t
+}
+
+func newTestKeyring(t *testing.T, keys store.SigningKeyStore, algorithm string, clock *testClock) *Keyring {
+    t.Helper()
+    k, err := NewKeyring(keys, algorithm)
+    if err != nil {
+        t.Fatal(err)
+    }
+    k.RotationInterval = 24 * time.Hour
+    k.Overlap = time.Hour
+    k.now = clock.now
+    return k
+}
+
+func rotate(t *testing.T, k *Keyring) {
+    t.Helper()
+    if err := k.Rotate(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+}
+
+// publishedKeys returns the key IDs of the key set
+func publishedKeys(k *Keyring) []string {
+    var ids []string
+    for _, key := range k.JWKS().Keys {
+        ids = append(ids, key.KeyID)
+    }
+    return ids
+}
+
+// signingKeyID signs a token and returns the kid it names, after checking it verifies
+func signingKeyID(t *testing.T, k *Keyring) string {
+    t.Helper()
+    signed, err := k.Sign(jwt.MapClaims{"sub": "user-1"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    token, err := (&jwt.Parser{ValidMethods: k.Algorithms()}).Parse(signed, k.Keyfunc)
+    if err != nil {
+        t.Fatalf("expected the token to verify: %v", err)
+    }
+    kid, _ := token.Header["kid"].(string)
+    return kid
+}
+
+func TestKeyringRotation(t *testing.T) {
+    start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+    clock := &testClock{t: start}
+    keys := store.NewMemoryStore()
+    k := newTestKeyring(t, keys, AlgorithmEdDSA, clock)
+
+    // The first key signs right away, nothing can have cached an earlier key set
+    rotate(t, k)
+    published := publishedKeys(k)
+    if len(published) != 1 {
+        t.Fatalf("expected one key, got %v", published)
+    }
+    first := published[0]
+    if kid := signingKeyID(t, k); kid != first {
+        t.Fatalf("expected %s to sign, got %s", first, kid)
+    }
+
+    // The successor is published Overlap before the rotation interval ends
+    clock.t = start.Add(23*time.Hour - time.Second)
+    rotate(t, k)
+    if published := publishedKeys(k); len(published) != 1 {
+        t.Fatalf("expected no successor before it is due, got %v", published)
+    }
+
+    clock.t = start.Add(23 * time.Hour)
+    rotate(t, k)
+    published = publishedKeys(k)
+    if len(published) != 2 || published[0] != first {
+        t.Fatalf("expected the successor to be published next to %s, got %v", first, published)
+    }
+    second := published[1]
+
+    stored, err := keys.ListSigningKeys(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, key := range stored {
+        if key.ID == second && !key.ActivatesAt.Equal(start.Add(24*time.Hour)) {
+            t.Fatalf("expected the successor to activate at the end of the interval, got %s", key.ActivatesAt)
+        }
+    }
+    if kid := signingKeyID(t, k); kid != first {
+        t.Fatalf("expected %s to keep signing until its successor activates, got %s", first, kid)
+    }
+
+    // Once active the successor signs, and the old key still verifies for Overlap
+    clock.t = start.Add(24 * time.Hour)
+    rotate(t, k)
+    if kid := signingKeyID(t, k); kid != second {
+        t.Fatalf("expected %s to sign, got %s", second, kid)
+    }
+
+    clock.t = start.Add(25*time.Hour - time.Second)
+    rotate(t, k)
+    if published := publishedKeys(k); len(published) != 2 {
+        t.Fatalf("expected %s to stay published during the overlap, got %v", first, published)
+    }
+
+    clock.t = start.Add(25 * time.Hour)
+    rotate(t, k)
+    if published := publishedKeys(k); len(published) != 1 || published[0] != second {
+        t.Fatalf("expected only %s after the overlap, got %v", second, published)
+    }
+    if stored, _ := keys.ListSigningKeys(context.Background()); len(stored) != 1 {
+        t.Fatalf("expected the retired key to be deleted from the store, got %d keys", len(stored))
+    }
+}
+
+func TestKeyringLoadsKeysOfOtherReplicas(t *testing.T) {
+    clock := &testClock{t: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}
+    keys := store.NewMemoryStore()
+    first := newTestKeyring(t, keys, AlgorithmEdDSA, clock)
+    second := newTestKeyring(t, keys, AlgorithmEdDSA, clock)
+
+    rotate(t, first)
+    rotate(t, second)
+
+    if a, b := publishedKeys(first), publishedKeys(second); len(b) != 1 || a[0] != b[0] {
+        t.Fatalf("expected both replicas to publish the same key, got %v and %v", a, b)
+    }
+    if kid := signingKeyID(t, second); kid != publishedKeys(first)[0] {
+        t.Fatalf("expected the replicas to sign with the same key, got %s", kid)
+    }
+}
+
+func TestKeyringAlgorithmChange(t *testing.T) {
+    start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+    clock := &testClock{t: start}
+    keys := store.NewMemoryStore()
+
+    previous := newTestKeyring(t, keys, AlgorithmRS256, clock)
+    rotate(t, previous)
+    old := publishedKeys(previous)[0]
+
+    // A restart with another algorithm rotates right away instead of waiting for the interval
+    clock.t = start.Add(time.Minute)
+    k := newTestKeyring(t, keys, AlgorithmEdDSA, clock)
+    rotate(t, k)
+    if published := publishedKeys(k); len(published) != 2 {
+        t.Fatalf("expected an EdDSA successor next to the RS256 key, got %v", published)
+    }
+    if kid := signingKeyID(t, k); kid != old {
+        t.Fatalf("expected the RS256 key to sign until its successor activates, got %s", kid)
+    }
+    if algorithms := k.Algorithms(); len(algorithms) != 2 {
+        t.Fatalf("expected tokens of both algorithms to verify, got %v", algorithms)
+    }
+
+    clock.t = start.Add(time.Minute + time.Hour)
+    rotate(t, k)
+    if kid := signingKeyID(t, k); kid == old {
+        t.Fatal("expected the EdDSA key to sign once active")
+    }
+    if jwk := k.JWKS().Keys[1]; jwk.KeyType != "OKP" || jwk.Algorithm != AlgorithmEdDSA {
+        t.Fatalf("expected an Ed25519 key, got %+v", jwk)
+    }
+
+    clock.t = start.Add(time.Minute + 2*time.Hour)
+    rotate(t, k)
+    if algorithms := k.Algorithms(); len(algorithms) != 1 || algorithms[0] != AlgorithmEdDSA {
+        t.Fatalf("expected only EdDSA once the RS256 key retired, got %v", algorithms)
+    }
+}
@@ -0,0 +1,250 @@
+// Package mockoidc is a minimal OpenID Connect provider for local development and
+// tests. It signs in a single configured user without asking for credentials.
+package mockoidc
+
+import (
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/base64"
+    "encoding/json"
+    "math/big"
+    "net/http"
+    "net/url"
+    "sync"
+    "time"
+
+    "github.com/golang-jwt/jwt"
+)
+
+const (
+    keyID        = "mock-oidc"
+    codeLifetime = time.Minute
+)
+
+// User is the identity the mock provider signs in
+type User struct {
+    Subject string
+    Email   string
+    Name    string
+    Groups  []string
+}
+
+type authorization struct {
+    clientID      string
+    redirectURI   string
+    nonce         string
+    codeChallenge string
+    expiresAt     time.Time
+}
+
+// Provider serves discovery, authorization, token and JWKS endpoints. Issuer must be
+// the URL the provider is reachable at, e.g. the URL of an httptest server.
+type Provider struct {
+    Issuer       string
+    ClientID     string
+    ClientSecret string
+    User         User
+    // Audience replaces the client ID as the aud claim of ID tokens, to test audience checks
+    Audience string
+    // IDTokenLifetime is how long ID tokens are valid, an hour when zero. A negative
+    // lifetime issues expired tokens.
+    IDTokenLifetime time.Duration
+
+    key   *rsa.PrivateKey
+    mu    sync.Mutex
+    codes map[string]authorization
+}
+
+func NewProvider(issuer, clientID, clientSecret string, user User) (*Provider, error) {
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        return nil, err
+    }
+
+    return &Provider{
+        Issuer:       issuer,
+        ClientID:     clientID,
+        ClientSecret: clientSecret,
+        User:         user,
+        key:          key,
+        codes:        make(map[string]authorization),
+    }, nil
+}
+
+// Handler routes the provider endpoints
+func (p *Provider) Handler() http.Handler {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+    mux.HandleFunc("/authorize", p.authorize)
+    mux.HandleFunc("/token", p.token)
+    mux.HandleFunc("/keys", p.keys)
+    return mux
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "issuer":                                p.Issuer,
+        "authorization_endpoint":                p.Issuer + "/authorize",
+        "token_endpoint":                        p.Issuer + "/token",
+        "jwks_uri":                              p.Issuer + "/keys",
+        "response_types_supported":              []string{"code"},
+        "subject_types_supported":               []string{"public"},
+        "id_token_signing_alg_values_supported": []string{"RS256"},
+        "code_challenge_methods_supported":      []string{"S256"},
+        "scopes_supported":                      []string{"openid", "email", "profile", "groups"},
+    })
+}
+
+// authorize approves every request for the configured user and redirects back with a code
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+
+    if query.Get("client_id") != p.ClientID {
+        http.Error(w, "unknown client_id", http.StatusBadRequest)
+        return
+    }
+    if query.Get("response_type") != "code" {
+        http.Error(w, "unsupported response_type", http.StatusBadRequest)
+        return
+    }
+    if query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+        http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+        return
+    }
+
+    redirectURI, err := url.Parse(query.Get("redirect_uri"))
+    if err != nil || !redirectURI.IsAbs() {
+        http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+        return
+    }
+
+    code := randomString()
+    p.mu.Lock()
+    p.codes[code] = authorization{
+        clientID:      p.ClientID,
+        redirectURI:   redirectURI.String(),
+        nonce:         query.Get("nonce"),
+        codeChallenge: query.Get("code_challenge"),
+        expiresAt:     time.Now().Add(codeLifetime),
+    }
+    p.mu.Unlock()
+
+    values := redirectURI.Query()
+    values.Set("code", code)
+    values.Set("state", query.Get("state"))
+    redirectURI.RawQuery = values.Encode()
+
+    http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// token redeems a code once, checking client credentials, redirect URI and PKCE verifier
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    if err := r.ParseForm(); err != nil {
+        tokenError(w, "invalid_request")
+        return
+    }
+
+    clientID, clientSecret, ok := r.BasicAuth()
+    if !ok {
+        clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+    }
+    if clientID != p.ClientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(p.ClientSecret)) != 1 {
+        tokenError(w, "invalid_client")
+        return
+    }
+
+    if r.PostForm.Get("grant_type") != "authorization_code" {
+        tokenError(w, "unsupported_grant_type")
+        return
+    }
+
+    code := r.PostForm.Get("code")
+    p.mu.Lock()
+    auth, ok := p.codes[code]
+    delete(p.codes, code)
+    p.mu.Unlock()
+
+    if !ok || time.Now().After(auth.expiresAt) || auth.redirectURI != r.PostForm.Get("redirect_uri") {
+        tokenError(w, "invalid_grant")
+        return
+    }
+
+    challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+    if base64.RawURLEncoding.EncodeToString(challenge[:]) != auth.codeChallenge {
+        tokenError(w, "invalid_grant")
+        return
+    }
+
+    audience := auth.clientID
+    if p.Audience != "" {
+        audience = p.Audience
+    }
+    lifetime := p.IDTokenLifetime
+    if lifetime == 0 {
+        lifetime = time.Hour
+    }
+
+    now := time.Now()
+    idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+        "iss":            p.Issuer,
+        "sub":            p.User.Subject,
+        "aud":            audience,
+        "iat":            now.Unix(),
+        "exp":            now.Add(lifetime).Unix(),
+        "nonce":          auth.nonce,
+        "email":          p.User.Email,
+        "email_verified": true,
+        "name":           p.User.Name,
+        "groups":         p.User.Groups,
+    })
+    idToken.Header["kid"] = keyID
+
+    signed, err := idToken.SignedString(p.key)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "access_token": randomString(),
+        "token_type":   "Bearer",
+        "expires_in":   3600,
+        "id_token":     signed,
+    })
+}
+
+func (p *Provider) keys(w http.ResponseWriter, r *http.Request) {
+    public := p.key.PublicKey
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "keys": []map[string]string{{
+            "kty": "RSA",
+            "kid": keyID,
+            "use": "sig",
+            "alg": "RS256",
+            "n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+            "e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+        }},
+    })
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+    writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(data)
+}
+
+func randomString() string {
+    value := make([]byte, 24)
+    rand.Read(value)
+    return base64.RawURLEncoding.EncodeToString(value)
+}
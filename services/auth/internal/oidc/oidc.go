@@ -0,0 +1,219 @@
+package oidc
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "sort"
+    "sync"
+    "time"
+
+    gooidc "github.com/coreos/go-oidc/v3/oidc"
+    "golang.org/x/oauth2"
+)
+
+// Pending logins expire if the user does not come back from the provider in time
+const loginTimeout = 10 * time.Minute
+
+var ErrUnknownState = errors.New("unknown or expired login state")
+
+// Config describes the OpenID Connect provider and how its groups map to IDE roles
+type Config struct {
+    IssuerURL    string
+    ClientID     string
+    ClientSecret string
+    RedirectURL  string
+    Scopes       []string
+    // GroupsClaim names the ID token claim holding the user's groups
+    GroupsClaim string
+    // RoleMapping maps provider groups to IDE roles
+    RoleMapping map[string]string
+    // DefaultRole is granted when no group maps to a role, empty to grant none
+    DefaultRole string
+}
+
+// Identity is the verified user returned by the provider
+type Identity struct {
+    Issuer        string
+    Subject       string
+    Email         string
+    EmailVerified bool
+    Name          string
+    Groups        []string
+}
+
+type pendingLogin struct {
+    nonce     string
+    verifier  string
+    expiresAt time.Time
+}
+
+// Provider runs the authorization code flow with PKCE against an OpenID Connect provider
+type Provider struct {
+    config Config
+
+    mu       sync.Mutex
+    provider *gooidc.Provider
+    pending  map[string]pendingLogin
+}
+
+func NewProvider(config Config) *Provider {
+    if len(config.Scopes) == 0 {
+        config.Scopes = []string{gooidc.ScopeOpenID, "email", "profile"}
+    }
+    if config.GroupsClaim == "" {
+        config.GroupsClaim = "groups"
+    }
+
+    return &Provider{
+        config:  config,
+        pending: make(map[string]pendingLogin),
+    }
+}
+
+// discover fetches the discovery document on first use, so the auth service starts
+// even when the provider is briefly unreachable
+func (p *Provider) discover(ctx context.Context) (*gooidc.Provider, error) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    if p.provider != nil {
+        return p.provider, nil
+    }
+
+    provider, err := gooidc.NewProvider(ctx, p.config.IssuerURL)
+    if err != nil {
+        return nil, fmt.Errorf("OIDC discovery failed: %v", err)
+    }
+
+    p.provider = provider
+    return provider, nil
+}
+
+func (p *Provider) oauth2Config(provider *gooidc.Provider) *oauth2.Config {
+    return &oauth2.Config{
+        ClientID:     p.config.ClientID,
+        ClientSecret: p.config.ClientSecret,
+        RedirectURL:  p.config.RedirectURL,
+        Endpoint:     provider.Endpoint(),
+        Scopes:       p.config.Scopes,
+    }
+}
+
+// StartLogin returns the provider URL to send the user to and the state that
+// identifies the login when the provider redirects back
+func (p *Provider) StartLogin(ctx context.Context) (string, string, error) {
+    provider, err := p.discover(ctx)
+    if err != nil {
+        return "", "", err
+    }
+
+    state, nonce := randomString(), randomString()
+    verifier := oauth2.GenerateVerifier()
+
+    p.mu.Lock()
+    now := time.Now()
+    for key, login := range p.pending {
+        if now.After(login.expiresAt) {
+            delete(p.pending, key)
+        }
+    }
+    p.pending[state] = pendingLogin{nonce: nonce, verifier: verifier, expiresAt: now.Add(loginTimeout)}
+    p.mu.Unlock()
+
+    url := p.oauth2Config(provider).AuthCodeURL(state, gooidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+    return url, state, nil
+}
+
+// FinishLogin exchanges the authorization code and validates the ID token signature,
+// issuer, audience, expiry and nonce
+func (p *Provider) FinishLogin(ctx context.Context, state, code string) (*Identity, error) {
+    p.mu.Lock()
+    login, ok := p.pending[state]
+    delete(p.pending, state)
+    p.mu.Unlock()
+
+    if !ok || time.Now().After(login.expiresAt) {
+        return nil, ErrUnknownState
+    }
+
+    provider, err := p.discover(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    token, err := p.oauth2Config(provider).Exchange(ctx, code, oauth2.VerifierOption(login.verifier))
+    if err != nil {
+        return nil, fmt.Errorf("code exchange failed: %v", err)
+    }
+
+    rawIDToken, ok := token.Extra("id_token").(string)
+    if !ok {
+        return nil, errors.New("token response has no id_token")
+    }
+
+    idToken, err := provider.Verifier(&gooidc.Config{ClientID: p.config.ClientID}).Verify(ctx, rawIDToken)
+    if err != nil {
+        return nil, fmt.Errorf("invalid ID token: %v", err)
+    }
+    if idToken.Nonce != login.nonce {
+        return nil, errors.New("invalid ID token: nonce mismatch")
+    }
+
+    var claims map[string]interface{}
+    if err := idToken.Claims(&claims); err != nil {
+        return nil, fmt.Errorf("invalid ID token claims: %v", err)
+    }
+
+    identity := &Identity{Issuer: idToken.Issuer, Subject: idToken.Subject}
+    identity.Email, _ = claims["email"].(string)
+    identity.EmailVerified, _ = claims["email_verified"].(bool)
+    identity.Name, _ = claims["name"].(string)
+    identity.Groups = stringList(claims[p.config.GroupsClaim])
+
+    return identity, nil
+}
+
+// Roles maps the groups of an identity to IDE roles
+func (p *Provider) Roles(identity *Identity) []string {
+    seen := make(map[string]bool)
+    roles := []string{}
+    for _, group := range identity.Groups {
+        if role, ok := p.config.RoleMapping[group]; ok && !seen[role] {
+            seen[role] = true
+            roles = append(roles, role)
+        }
+    }
+
+    if len(roles) == 0 && p.config.DefaultRole != "" {
+        roles = append(roles, p.config.DefaultRole)
+    }
+    sort.Strings(roles)
+    return roles
+}
+
+// stringList reads a claim holding a list of strings, or a single string
+func stringList(claim interface{}) []string {
+    switch value := claim.(type) {
+    case string:
+        return []string{value}
+    case []interface{}:
+        list := make([]string, 0, len(value))
+        for _, item := range value {
+            if s, ok := item.(string); ok {
+                list = append(list, s)
+            }
+        }
+        return list
+    default:
+        return nil
+    }
+}
+
+func randomString() string {
+    value := make([]byte, 24)
+    rand.Read(value)
+    return base64.RawURLEncoding.EncodeToString(value)
+}
@@ -0,0 +1,167 @@
+package oidc
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+
+    "devops-ide/services/auth/internal/mockoidc"
+
+    "golang.org/x/oauth2"
+)
+
+// newTestProvider runs the mock provider on a local server and a client configured for it
+func newTestProvider(t *testing.T) (*mockoidc.Provider, *Provider) {
+    t.Helper()
+
+    var handler http.Handler
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        handler.ServeHTTP(w, r)
+    }))
+    t.Cleanup(server.Close)
+
+    mock, err := mockoidc.NewProvider(server.URL, "devops-ide", "devops-ide-secret", mockoidc.User{
+        Subject: "user-1",
+        Email:   "dev@example.com",
+        Name:    "Dev",
+        Groups:  []string{"sre", "unmapped"},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    handler = mock.Handler()
+
+    provider := NewProvider(Config{
+        IssuerURL:    server.URL,
+        ClientID:     "devops-ide",
+        ClientSecret: "devops-ide-secret",
+        RedirectURL:  "http://localhost:8080/auth/oidc/callback",
+        RoleMapping:  map[string]string{"sre": "operator"},
+        DefaultRole:  "viewer",
+    })
+    return mock, provider
+}
+
+// authorize starts a login and follows it to the provider like a browser, returning the
+// state and the code the provider redirects back with
+func authorize(t *testing.T, provider *Provider) (string, string) {
+    t.Helper()
+
+    authURL, state, err := provider.StartLogin(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    browser := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+        return http.ErrUseLastResponse
+    }}
+    resp, err := browser.Get(authURL)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+
+    location, err := url.Parse(resp.Header.Get("Location"))
+    if err != nil || resp.StatusCode != http.StatusFound {
+        t.Fatalf("expected a redirect back, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+    }
+    if location.Query().Get("state") != state {
+        t.Fatalf("expected the state to be returned, got %q", location.Query().Get("state"))
+    }
+    return state, location.Query().Get("code")
+}
+
+func TestLogin(t *testing.T) {
+    _, provider := newTestProvider(t)
+    ctx := context.Background()
+
+    state, code := authorize(t, provider)
+    identity, err := provider.FinishLogin(ctx, state, code)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if identity.Subject != "user-1" || identity.Email != "dev@example.com" || !identity.EmailVerified {
+        t.Fatalf("unexpected identity %+v", identity)
+    }
+    if roles := provider.Roles(identity); len(roles) != 1 || roles[0] != "operator" {
+        t.Fatalf("expected the sre group to map to operator, got %v", roles)
+    }
+
+    // A state finishes one login only
+    if _, err := provider.FinishLogin(ctx, state, code); !errors.Is(err, ErrUnknownState) {
+        t.Fatalf("expected a replayed state to be rejected, got %v", err)
+    }
+}
+
+func TestLoginRejected(t *testing.T) {
+    tests := []struct {
+        name string
+        // setup runs between the redirect back and the code exchange
+        setup    func(mock *mockoidc.Provider, provider *Provider, state string) string
+        expected string
+    }{
+        {
+            name: "bad state",
+            setup: func(_ *mockoidc.Provider, _ *Provider, _ string) string {
+                return "forged-state"
+            },
+            expected: ErrUnknownState.Error(),
+        },
+        {
+            name: "PKCE verifier mismatch",
+            setup: func(_ *mockoidc.Provider, provider *Provider, state string) string {
+                login := provider.pending[state]
+                login.verifier = oauth2.GenerateVerifier()
+                provider.pending[state] = login
+                return state
+            },
+            expected: "invalid_grant",
+        },
+        {
+            name: "nonce mismatch",
+            setup: func(_ *mockoidc.Provider, provider *Provider, state string) string {
+                login := provider.pending[state]
+                login.nonce = "another-nonce"
+                provider.pending[state] = login
+                return state
+            },
+            expected: "nonce mismatch",
+        },
+        {
+            name: "wrong audience",
+            setup: func(mock *mockoidc.Provider, _ *Provider, state string) string {
+                mock.Audience = "another-client"
+                return state
+            },
+            expected: "audience",
+        },
+        {
+            name: "expired token",
+            setup: func(mock *mockoidc.Provider, _ *Provider, state string) string {
+                mock.IDTokenLifetime = -time.Minute
+                return state
+            },
+            expected: "expired",
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            mock, provider := newTestProvider(t)
+            state, code := authorize(t, provider)
+
+            identity, err := provider.FinishLogin(context.Background(), test.setup(mock, provider, state), code)
+            if err == nil {
+                t.Fatalf("expected the login to fail, got %+v", identity)
+            }
+            if !strings.Contains(err.Error(), test.expected) {
+                t.Fatalf("expected an error mentioning %q, got %v", test.expected, err)
+            }
+        })
+    }
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "regexp"
+    "strings"
+    "time"
+
+    "devops-ide/services/auth/internal/domain"
+)
+
+const (
+    // PersonalTokenPrefix and ServiceTokenPrefix start every access token, so they are
+    // easy to tell from JWTs and to find with secret scanners
+    PersonalTokenPrefix = "dvi_pat_"
+    ServiceTokenPrefix  = "dvi_sat_"
+
+    DefaultAccessTokenLifetime = 30 * 24 * time.Hour
+    MaxAccessTokenLifetime     = 365 * 24 * time.Hour
+
+    // Service accounts get addresses under a reserved domain no identity provider can verify
+    serviceAccountDomain = "service-accounts.invalid"
+
+    // lastUsedPrecision limits how often a busy token writes its last use to the store
+    lastUsedPrecision = time.Minute
+)
+
+var (
+    ErrInvalidScope       = errors.New(`scopes must be "*" or "resource:action" with action "*" allowed`)
+    ErrInvalidLifetime    = fmt.Errorf("token lifetime must be positive and at most %s", MaxAccessTokenLifetime)
+    ErrInvalidName        = errors.New("a name of at most 100 characters is required")
+    ErrNotServiceAccount  = errors.New("service account not found")
+    ErrServiceAccountName = errors.New("service account names may only contain lowercase letters, digits and dashes")
+
+    scopePattern              = regexp.MustCompile(`^[a-z][a-z0-9-]*:([a-z][a-z0-9-]*|\*)$`)
+    serviceAccountNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+)
+
+// CreateAccessToken issues a token for the user. The token value is only returned here,
+// the store keeps its hash. No scopes means the token may do whatever the user may.
+func (s *AuthService) CreateAccessToken(ctx context.Context, user *domain.User, name string, scopes []string, lifetime time.Duration) (string, *domain.AccessToken, error) {
+    name = strings.TrimSpace(name)
+    if name == "" || len(name) > 100 {
+        return "", nil, ErrInvalidName
+    }
+    if lifetime == 0 {
+        lifetime = DefaultAccessTokenLifetime
+    }
+    if lifetime < 0 || lifetime > MaxAccessTokenLifetime {
+        return "", nil, ErrInvalidLifetime
+    }
+    for _, scope := range scopes {
+        if scope != "*" && !scopePattern.MatchString(scope) {
+            return "", nil, ErrInvalidScope
+        }
+    }
+    if scopes == nil {
+        scopes = []string{}
+    }
+
+    prefix := PersonalTokenPrefix
+    if user.ServiceAccount {
+        prefix = ServiceTokenPrefix
+    }
+    value := make([]byte, 32)
+    rand.Read(value)
+    raw := prefix + base64.RawURLEncoding.EncodeToString(value)
+
+    now := time.Now().UTC()
+    token := &domain.AccessToken{
+        ID:        newID(),
+        UserID:    user.ID,
+        Name:      name,
+        Prefix:    raw[:len(prefix)+6],
+        TokenHash: hashToken(raw),
+        Scopes:    scopes,
+        ExpiresAt: now.Add(lifetime),
+        CreatedAt: now,
+    }
+    if err := s.store.CreateAccessToken(ctx, token); err != nil {
+        return "", nil, err
+    }
+    return raw, token, nil
+}
+
+// ListAccessTokens returns the tokens of a user, newest first, including expired and
+// revoked ones
+func (s *AuthService) ListAccessTokens(ctx context.Context, userID string) ([]*domain.AccessToken, error) {
+    return s.store.ListAccessTokens(ctx, userID)
+}
+
+// RevokeAccessToken revokes a token of the user
+func (s *AuthService) RevokeAccessToken(ctx context.Context, userID, id string) error {
+    return s.store.RevokeAccessToken(ctx, userID, id)
+}
+
+// CreateServiceAccount registers a non-interactive account. It has no password and
+// cannot log in, it only acts through the tokens issued to it.
+func (s *AuthService) CreateServiceAccount(ctx context.Context, name string, roles []string) (*domain.User, error) {
+    if !serviceAccountNamePattern.MatchString(name) {
+        return nil, ErrServiceAccountName
+    }
+    if roles == nil {
+        roles = []string{}
+    }
+
+    now := time.Now().UTC()
+    user := &domain.User{
+        ID:             newID(),
+        Email:          name + "@" + serviceAccountDomain,
+        Roles:          roles,
+        ServiceAccount: true,
+        CreatedAt:      now,
+        UpdatedAt:      now,
+    }
+    if err := s.store.CreateUser(ctx, user); err != nil {
+        return nil, err
+    }
+    return user, nil
+}
+
+// ListServiceAccounts returns every service account
+func (s *AuthService) ListServiceAccounts(ctx context.Context) ([]*domain.User, error) {
+    return s.store.ListServiceAccounts(ctx)
+}
+
+// GetServiceAccount looks up a service account by ID
+func (s *AuthService) GetServiceAccount(ctx context.Context, id string) (*domain.User, error) {
+    user, err := s.store.GetUserByID(ctx, id)
+    if errors.Is(err, domain.ErrUserNotFound) || (err == nil && !user.ServiceAccount) {
+        return nil, ErrNotServiceAccount
+    }
+    return user, err
+}
+
+// IsAccessToken reports whether a bearer token is an access token rather than a JWT
+func IsAccessToken(token string) bool {
+    return strings.HasPrefix(token, PersonalTokenPrefix) || strings.HasPrefix(token, ServiceTokenPrefix)
+}
+
+// IntrospectAccessToken checks an access token and returns the claims it grants. Roles
+// are those the owner has now, so demoting a user also narrows their tokens.
+func (s *AuthService) IntrospectAccessToken(ctx context.Context, raw string) (*Claims, error) {
+    token, err := s.store.GetAccessToken(ctx, hashToken(raw))
+    if errors.Is(err, domain.ErrTokenNotFound) {
+        return nil, ErrInvalidToken
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    now := time.Now()
+    if token.Revoked() || now.After(token.ExpiresAt) {
+        return nil, ErrInvalidToken
+    }
+
+    user, err := s.store.GetUserByID(ctx, token.UserID)
+    if errors.Is(err, domain.ErrUserNotFound) {
+        return nil, ErrInvalidToken
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= lastUsedPrecision {
+        s.store.TouchAccessToken(ctx, token.ID, now.UTC())
+    }
+
+    return &Claims{
+        UserID:    user.ID,
+        Email:     user.Email,
+        Roles:     user.Roles,
+        Scopes:    token.Scopes,
+        ExpiresAt: token.ExpiresAt,
+    }, nil
+}
@@ -1,45 +1,294 @@
 package service
 
 import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
     "errors"
+    "strings"
     "time"
 
+    "devops-ide/services/auth/internal/domain"
+    "devops-ide/services/auth/internal/keys"
+    "devops-ide/services/auth/internal/store"
+
     "github.com/golang-jwt/jwt"
 )
 
+var (
+    ErrInvalidCredentials = errors.New("invalid email or password")
+    ErrInvalidToken       = errors.New("invalid or expired token")
+    // ErrTokenReuse is returned when an already rotated refresh token is presented again,
+    // which means it leaked; every token of its family is revoked
+    ErrTokenReuse = errors.New("refresh token reuse detected")
+)
+
 type AuthService struct {
-    secretKey []byte
+    signer keys.Signer
+    store  store.Store
+
+    Issuer          string
+    Audience        string
+    AccessTokenTTL  time.Duration
+    RefreshTokenTTL time.Duration
+    // MFAIssuer names the service in authenticator apps
+    MFAIssuer string
+    // MFAChallengeTTL is how long the second login step may take
+    MFAChallengeTTL time.Duration
+
+    // dummyHash is compared against when the email is unknown, so login takes as long
+    // for missing accounts as for wrong passwords
+    dummyHash string
 }
 
-func NewAuthService(secretKey string) *AuthService {
+// Claims are the verified contents of a session or access token. Scopes narrow access
+// tokens to part of the roles' permissions and are empty for session tokens.
+type Claims struct {
+    UserID    string    `json:"user_id"`
+    Email     string    `json:"email"`
+    Roles     []string  `json:"roles"`
+    Scopes    []string  `json:"scopes,omitempty"`
+    ExpiresAt time.Time `json:"expires_at"`
+}
+
+func NewAuthService(signer keys.Signer, store store.Store) *AuthService {
+    dummyHash, _ := HashPassword("not a real password")
+
     return &AuthService{
-        secretKey: []byte(secretKey),
+        signer:          signer,
+        store:           store,
+        Issuer:          "devops-ide-auth",
+        Audience:        "devops-ide",
+        AccessTokenTTL:  15 * time.Minute,
+        RefreshTokenTTL: 7 * 24 * time.Hour,
+        MFAIssuer:       "DevOps IDE",
+        MFAChallengeTTL: 5 * time.Minute,
+        dummyHash:       dummyHash,
     }
 }
 
-func (s *AuthService) GenerateTokens(userID string) (*TokenPair, error) {
-    accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-        "user_id": userID,
-        "exp":     time.Now().Add(time.Hour * 24).Unix(),
-    })
+// CreateUser registers a user with a password hashed with argon2id
+func (s *AuthService) CreateUser(ctx context.Context, email, password string, roles []string) (*domain.User, error) {
+    hash, err := HashPassword(password)
+    if err != nil {
+        return nil, err
+    }
+
+    now := time.Now().UTC()
+    user := &domain.User{
+        ID:        newID(),
+        Email:     strings.ToLower(strings.TrimSpace(email)),
+        Password:  hash,
+        Roles:     roles,
+        CreatedAt: now,
+        UpdatedAt: now,
+    }
+
+    if err := s.store.CreateUser(ctx, user); err != nil {
+        return nil, err
+    }
+    return user, nil
+}
 
-    accessTokenString, err := accessToken.SignedString(s.secretKey)
+// GetUser looks up a user by ID
+func (s *AuthService) GetUser(ctx context.Context, id string) (*domain.User, error) {
+    return s.store.GetUserByID(ctx, id)
+}
+
+// Login checks the password and starts a new refresh token family. Users with MFA, or
+// whose roles require it, get a *MFARequiredError with a challenge for the second step.
+func (s *AuthService) Login(ctx context.Context, email, password string) (*domain.TokenPair, error) {
+    user, err := s.store.GetUserByEmail(ctx, strings.TrimSpace(email))
+    if errors.Is(err, domain.ErrUserNotFound) {
+        VerifyPassword(s.dummyHash, password)
+        return nil, ErrInvalidCredentials
+    }
     if err != nil {
         return nil, err
     }
 
-    refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-        "user_id": userID,
-        "exp":     time.Now().Add(time.Hour * 24 * 7).Unix(),
-    })
+    // Service accounts have no password and only authenticate with access tokens
+    ok, err := VerifyPassword(user.Password, password)
+    if err != nil || !ok || user.ServiceAccount {
+        return nil, ErrInvalidCredentials
+    }
+
+    // Upgrade bcrypt and outdated argon2id hashes while the password is at hand
+    if NeedsRehash(user.Password) {
+        if hash, err := HashPassword(password); err == nil {
+            user.Password = hash
+            user.UpdatedAt = time.Now().UTC()
+            s.store.UpdateUser(ctx, user)
+        }
+    }
+
+    if err := s.mfaChallenge(ctx, user); err != nil {
+        return nil, err
+    }
+    return s.GenerateTokens(ctx, user)
+}
+
+// GenerateTokens issues an access token and the first refresh token of a new family
+func (s *AuthService) GenerateTokens(ctx context.Context, user *domain.User) (*domain.TokenPair, error) {
+    refreshToken, stored := s.newRefreshToken(user.ID, newID())
+    if err := s.store.SaveRefreshToken(ctx, stored); err != nil {
+        return nil, err
+    }
+
+    return s.tokenPair(user, refreshToken)
+}
+
+// Refresh exchanges a refresh token for a new token pair. Each refresh token can be used
+// once; presenting a rotated token again revokes the whole family.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*domain.TokenPair, error) {
+    current, err := s.store.GetRefreshToken(ctx, hashToken(refreshToken))
+    if errors.Is(err, domain.ErrTokenNotFound) {
+        return nil, ErrInvalidToken
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    if current.Revoked() {
+        // Tokens revoked by logout were never rotated and are simply invalid
+        if current.ReplacedBy == "" {
+            return nil, ErrInvalidToken
+        }
+        return nil, s.revokeReusedFamily(ctx, current)
+    }
+    if time.Now().After(current.ExpiresAt) {
+        return nil, ErrInvalidToken
+    }
 
-    refreshTokenString, err := refreshToken.SignedString(s.secretKey)
+    user, err := s.store.GetUserByID(ctx, current.UserID)
+    if errors.Is(err, domain.ErrUserNotFound) {
+        return nil, ErrInvalidToken
+    }
     if err != nil {
         return nil, err
     }
 
-    return &TokenPair{
-        AccessToken:  accessTokenString,
-        RefreshToken: refreshTokenString,
+    nextToken, next := s.newRefreshToken(user.ID, current.FamilyID)
+    if err := s.store.RotateRefreshToken(ctx, current.ID, next); err != nil {
+        // A concurrent request rotated the same token first
+        if errors.Is(err, domain.ErrTokenRevoked) {
+            return nil, s.revokeReusedFamily(ctx, current)
+        }
+        return nil, err
+    }
+
+    return s.tokenPair(user, nextToken)
+}
+
+func (s *AuthService) revokeReusedFamily(ctx context.Context, token *domain.RefreshToken) error {
+    if err := s.store.RevokeTokenFamily(ctx, token.FamilyID); err != nil {
+        return err
+    }
+    return ErrTokenReuse
+}
+
+// Logout revokes the refresh token family of a session, or every session of the user.
+// Unknown tokens are ignored so logging out twice succeeds.
+func (s *AuthService) Logout(ctx context.Context, refreshToken string, everywhere bool) error {
+    token, err := s.store.GetRefreshToken(ctx, hashToken(refreshToken))
+    if errors.Is(err, domain.ErrTokenNotFound) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+
+    if everywhere {
+        return s.store.RevokeUserTokens(ctx, token.UserID)
+    }
+    return s.store.RevokeTokenFamily(ctx, token.FamilyID)
+}
+
+// VerifyAccessToken checks the signature, expiry, issuer and audience of an access token
+func (s *AuthService) VerifyAccessToken(tokenString string) (*Claims, error) {
+    parser := &jwt.Parser{ValidMethods: s.signer.Algorithms()}
+
+    claims := jwt.MapClaims{}
+    if _, err := parser.ParseWithClaims(tokenString, claims, s.signer.Keyfunc); err != nil {
+        return nil, ErrInvalidToken
+    }
+
+    if !claims.VerifyExpiresAt(time.Now().Unix(), true) ||
+        !claims.VerifyIssuer(s.Issuer, true) ||
+        !claims.VerifyAudience(s.Audience, true) {
+        return nil, ErrInvalidToken
+    }
+
+    result := &Claims{}
+    result.UserID, _ = claims["sub"].(string)
+    result.Email, _ = claims["email"].(string)
+    if exp, ok := claims["exp"].(float64); ok {
+        result.ExpiresAt = time.Unix(int64(exp), 0).UTC()
+    }
+    roles, _ := claims["roles"].([]interface{})
+    for _, role := range roles {
+        if role, ok := role.(string); ok {
+            result.Roles = append(result.Roles, role)
+        }
+    }
+
+    if result.UserID == "" {
+        return nil, ErrInvalidToken
+    }
+    return result, nil
+}
+
+func (s *AuthService) tokenPair(user *domain.User, refreshToken string) (*domain.TokenPair, error) {
+    now := time.Now()
+    accessToken, err := s.signer.Sign(jwt.MapClaims{
+        "sub":   user.ID,
+        "email": user.Email,
+        "roles": user.Roles,
+        "iss":   s.Issuer,
+        "aud":   s.Audience,
+        "iat":   now.Unix(),
+        "exp":   now.Add(s.AccessTokenTTL).Unix(),
+        "jti":   newID(),
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    return &domain.TokenPair{
+        AccessToken:  accessToken,
+        RefreshToken: refreshToken,
+        TokenType:    "Bearer",
+        ExpiresIn:    int64(s.AccessTokenTTL.Seconds()),
     }, nil
+}
+
+// newRefreshToken creates an opaque refresh token and the record stored for it
+func (s *AuthService) newRefreshToken(userID, familyID string) (string, *domain.RefreshToken) {
+    value := make([]byte, 32)
+    rand.Read(value)
+    token := base64.RawURLEncoding.EncodeToString(value)
+
+    now := time.Now().UTC()
+    return token, &domain.RefreshToken{
+        ID:        newID(),
+        UserID:    userID,
+        FamilyID:  familyID,
+        TokenHash: hashToken(token),
+        ExpiresAt: now.Add(s.RefreshTokenTTL),
+        CreatedAt: now,
+    }
+}
+
+// hashToken derives the stored lookup key of a token, the value itself is never stored
+func hashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
+func newID() string {
+    id := make([]byte, 16)
+    rand.Read(id)
+    return hex.EncodeToString(id)
 }
\ No newline at end of file
@@ -0,0 +1,183 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+
+    "devops-ide/services/auth/internal/domain"
+)
+
+// loginTestUser creates a user and logs in, returning the first token pair of a new family
+func loginTestUser(t *testing.T, s *AuthService) (*domain.User, *domain.TokenPair) {
+    t.Helper()
+    ctx := context.Background()
+
+    user, err := s.CreateUser(ctx, "dev@example.com", "correct horse battery staple", []string{"developer"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    tokens, err := s.Login(ctx, "dev@example.com", "correct horse battery staple")
+    if err != nil {
+        t.Fatal(err)
+    }
+    return user, tokens
+}
+
+func TestRefreshRotates(t *testing.T) {
+    s := newTestService()
+    ctx := context.Background()
+    user, first := loginTestUser(t, s)
+
+    second, err := s.Refresh(ctx, first.RefreshToken)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if second.RefreshToken == first.RefreshToken {
+        t.Fatal("expected a new refresh token")
+    }
+
+    claims, err := s.VerifyAccessToken(second.AccessToken)
+    if err != nil || claims.UserID != user.ID {
+        t.Fatalf("expected an access token for %s, got %+v, %v", user.ID, claims, err)
+    }
+
+    if _, err := s.Refresh(ctx, second.RefreshToken); err != nil {
+        t.Fatalf("expected the rotated token to be usable once: %v", err)
+    }
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+    s := newTestService()
+    ctx := context.Background()
+    _, first := loginTestUser(t, s)
+
+    second, err := s.Refresh(ctx, first.RefreshToken)
+    if err != nil {
+        t.Fatal(err)
+    }
+    third, err := s.Refresh(ctx, second.RefreshToken)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // Replaying a rotated token means it leaked
+    if _, err := s.Refresh(ctx, first.RefreshToken); !errors.Is(err, ErrTokenReuse) {
+        t.Fatalf("expected ErrTokenReuse, got %v", err)
+    }
+
+    // The newest token of the family is revoked as well, and keeps being refused as reuse
+    if _, err := s.Refresh(ctx, third.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+        t.Fatalf("expected the latest token of the family to be revoked, got %v", err)
+    }
+    for _, token := range []string{first.RefreshToken, second.RefreshToken, third.RefreshToken} {
+        stored, err := s.store.GetRefreshToken(ctx, hashToken(token))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !stored.Revoked() {
+            t.Fatalf("expected every token of family %s to be revoked", stored.FamilyID)
+        }
+    }
+}
+
+func TestRefreshReuseLeavesOtherSessions(t *testing.T) {
+    s := newTestService()
+    ctx := context.Background()
+    _, first := loginTestUser(t, s)
+
+    other, err := s.Login(ctx, "dev@example.com", "correct horse battery staple")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if _, err := s.Refresh(ctx, first.RefreshToken); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := s.Refresh(ctx, first.RefreshToken); !errors.Is(err, ErrTokenReuse) {
+        t.Fatalf("expected ErrTokenReuse, got %v", err)
+    }
+
+    if _, err := s.Refresh(ctx, other.RefreshToken); err != nil {
+        t.Fatalf("expected the session of another login to survive: %v", err)
+    }
+}
+
+func TestRefreshAfterLogout(t *testing.T) {
+    s := newTestService()
+    ctx := context.Background()
+    _, tokens := loginTestUser(t, s)
+
+    if err := s.Logout(ctx, tokens.RefreshToken, false); err != nil {
+        t.Fatal(err)
+    }
+    // Logging out twice succeeds
+    if err := s.Logout(ctx, tokens.RefreshToken, false); err != nil {
+        t.Fatal(err)
+    }
+
+    // A logged out token was never rotated, so it is invalid rather than reused
+    if _, err := s.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+        t.Fatalf("expected ErrInvalidToken, got %v", err)
+    }
+}
+
+func TestLogoutEverywhere(t *testing.T) {
+    s := newTestService()
+    ctx := context.Background()
+    _, first := loginTestUser(t, s)
+
+    second, err := s.Login(ctx, "dev@example.com", "correct horse battery staple")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if err := s.Logout(ctx, first.RefreshToken, true); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := s.Refresh(ctx, second.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+        t.Fatalf("expected every session of the user to be revoked, got %v", err)
+    }
+}
+
+func TestRefreshUnknownAndExpired(t *testing.T) {
+    s := newTestService()
+    s.RefreshTokenTTL = -time.Minute
+    ctx := context.Background()
+    _, tokens := loginTestUser(t, s)
+
+    if _, err := s.Refresh(ctx, "not-a-token"); !errors.Is(err, ErrInvalidToken) {
+        t.Fatalf("expected ErrInvalidToken for an unknown token, got %v", err)
+    }
+    if _, err := s.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+        t.Fatalf("expected ErrInvalidToken for an expired token, got %v", err)
+    }
+}
+
+func TestLoginUnknownEmailHashesDummy(t *testing.T) {
+    s := newTestService()
+    ctx := context.Background()
+    loginTestUser(t, s)
+
+    // The dummy hash must cost as much to check as the hash of a real account
+    if NeedsRehash(s.dummyHash) {
+        t.Fatalf("expected the dummy hash to use the current argon2id parameters, got %q", s.dummyHash)
+    }
+
+    login := func(email string) time.Duration {
+        start := time.Now()
+        if _, err := s.Login(ctx, email, "wrong password"); !errors.Is(err, ErrInvalidCredentials) {
+            t.Fatalf("expected ErrInvalidCredentials for %s, got %v", email, err)
+        }
+        return time.Since(start)
+    }
+
+    // Without the dummy hash an unknown email fails in microseconds, while argon2id
+    // takes tens of milliseconds
+    wrongPassword := login("dev@example.com")
+    unknownEmail := login("nobody@example.com")
+    if unknownEmail < wrongPassword/4 {
+        t.Fatalf("expected an unknown email to take about as long as a wrong password, took %v against %v", unknownEmail, wrongPassword)
+    }
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "sort"
+    "strings"
+    "time"
+
+    "devops-ide/services/auth/internal/domain"
+
+    "github.com/golang-jwt/jwt"
+)
+
+const (
+    // MFA challenges carry this purpose for users who still have to enroll
+    mfaPurposeVerify = "mfa_verify"
+    mfaPurposeEnroll = "mfa_enroll"
+
+    // After this many wrong codes in a row the second step is locked for mfaLockout
+    mfaMaxFailures = 5
+    mfaLockout     = 15 * time.Minute
+)
+
+var (
+    ErrInvalidCode         = errors.New("invalid authentication code")
+    ErrMFALocked           = errors.New("too many invalid authentication codes, try again later")
+    ErrMFAEnabled          = errors.New("multi-factor authentication is already enabled")
+    ErrMFANotEnabled       = errors.New("multi-factor authentication is not enabled")
+    ErrNoPendingEnrollment = errors.New("no multi-factor enrollment in progress")
+    ErrMFARequiredByPolicy = errors.New("multi-factor authentication is required for your role")
+    ErrInvalidMFAPolicy    = errors.New("role names must not be empty")
+)
+
+// MFARequiredError is returned by Login when the password was right but the user has to
+// pass a second factor, or enroll one first. The challenge token stands in for the
+// password in the following requests.
+type MFARequiredError struct {
+    Token     string
+    Enroll    bool
+    ExpiresIn time.Duration
+}
+
+func (e *MFARequiredError) Error() string {
+    if e.Enroll {
+        return "multi-factor enrollment required"
+    }
+    return "multi-factor authentication required"
+}
+
+// MFAChallenge identifies the user a challenge token was issued to
+type MFAChallenge struct {
+    UserID string
+    Enroll bool
+}
+
+// MFAEnrollment is what an authenticator app needs to generate codes
+type MFAEnrollment struct {
+    Secret          string `json:"secret"`
+    ProvisioningURI string `json:"provisioning_uri"`
+    // QRCode is the provisioning URI as a PNG data URI
+    QRCode string `json:"qr_code"`
+}
+
+// MFAStatus describes the second factor of a user
+type MFAStatus struct {
+    Enabled                bool       `json:"enabled"`
+    EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+    RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+    Required               bool       `json:"required"`
+}
+
+// mfaChallenge decides whether a user who passed the password check needs a second step
+func (s *AuthService) mfaChallenge(ctx context.Context, user *domain.User) error {
+    enroll := false
+    if !user.MFA.Enabled {
+        policy, err := s.store.GetMFAPolicy(ctx)
+        if err != nil {
+            return err
+        }
+        if !policy.Requires(user.Roles) {
+            return nil
+        }
+        enroll = true
+    }
+
+    purpose := mfaPurposeVerify
+    if enroll {
+        purpose = mfaPurposeEnroll
+    }
+
+    now := time.Now()
+    token, err := s.signer.Sign(jwt.MapClaims{
+        "sub":     user.ID,
+        "purpose": purpose,
+        "iss":     s.Issuer,
+        "aud":     s.mfaAudience(),
+        "iat":     now.Unix(),
+        "exp":     now.Add(s.MFAChallengeTTL).Unix(),
+        "jti":     newID(),
+    })
+    if err != nil {
+        return err
+    }
+    return &MFARequiredError{Token: token, Enroll: enroll, ExpiresIn: s.MFAChallengeTTL}
+}
+
+// mfaAudience keeps challenge tokens from being accepted as access tokens
+func (s *AuthService) mfaAudience() string {
+    return s.Audience + ":mfa"
+}
+
+// ParseMFAChallenge verifies a challenge token issued by Login
+func (s *AuthService) ParseMFAChallenge(token string) (*MFAChallenge, error) {
+    parser := &jwt.Parser{ValidMethods: s.signer.Algorithms()}
+
+    claims := jwt.MapClaims{}
+    if _, err := parser.ParseWithClaims(token, claims, s.signer.Keyfunc); err != nil {
+        return nil, ErrInvalidToken
+    }
+    if !claims.VerifyExpiresAt(time.Now().Unix(), true) ||
+        !claims.VerifyIssuer(s.Issuer, true) ||
+        !claims.VerifyAudience(s.mfaAudience(), true) {
+        return nil, ErrInvalidToken
+    }
+
+    challenge := &MFAChallenge{}
+    challenge.UserID, _ = claims["sub"].(string)
+    purpose, _ := claims["purpose"].(string)
+    if challenge.UserID == "" || (purpose != mfaPurposeVerify && purpose != mfaPurposeEnroll) {
+        return nil, ErrInvalidToken
+    }
+    challenge.Enroll = purpose == mfaPurposeEnroll
+    return challenge, nil
+}
+
+// VerifyMFA finishes a login with a code from the authenticator app or a recovery code
+func (s *AuthService) VerifyMFA(ctx context.Context, challengeToken, code, recoveryCode string) (*domain.TokenPair, error) {
+    challenge, err := s.ParseMFAChallenge(challengeToken)
+    if err != nil || challenge.Enroll {
+        return nil, ErrInvalidToken
+    }
+
+    user, err := s.store.GetUserByID(ctx, challenge.UserID)
+    if errors.Is(err, domain.ErrUserNotFound) {
+        return nil, ErrInvalidToken
+    }
+    if err != nil {
+        return nil, err
+    }
+    if !user.MFA.Enabled {
+        return nil, ErrInvalidToken
+    }
+
+    if err := s.checkSecondFactor(ctx, user, code, recoveryCode); err != nil {
+        return nil, err
+    }
+    return s.GenerateTokens(ctx, user)
+}
+
+// checkSecondFactor accepts a TOTP code or an unused recovery code. Both are consumed,
+// so a code seen by someone else cannot be used again.
+func (s *AuthService) checkSecondFactor(ctx context.Context, user *domain.User, code, recoveryCode string) error {
+    now := time.Now()
+    if user.MFA.FailedAttempts >= mfaMaxFailures && user.MFA.LastFailureAt != nil &&
+        now.Before(user.MFA.LastFailureAt.Add(mfaLockout)) {
+        return ErrMFALocked
+    }
+
+    var err error
+    switch {
+    case code != "":
+        step, ok := matchTOTP(user.MFA.Secret, code, now)
+        if !ok {
+            return s.mfaFailure(ctx, user, now)
+        }
+        err = s.store.ConsumeTOTPStep(ctx, user.ID, step)
+    case recoveryCode != "":
+        err = s.store.ConsumeRecoveryCode(ctx, user.ID, hashRecoveryCode(recoveryCode))
+    default:
+        return ErrInvalidCode
+    }
+
+    if errors.Is(err, domain.ErrCodeUsed) {
+        return s.mfaFailure(ctx, user, now)
+    }
+    return err
+}
+
+// mfaFailure counts a wrong or reused code towards the lockout
+func (s *AuthService) mfaFailure(ctx context.Context, user *domain.User, now time.Time) error {
+    if _, err := s.store.RecordMFAFailure(ctx, user.ID, now.UTC()); err != nil {
+        return err
+    }
+    return ErrInvalidCode
+}
+
+// BeginMFAEnrollment generates a TOTP secret for the user. It only takes effect once
+// ConfirmMFAEnrollment proves the authenticator app produces matching codes.
+func (s *AuthService) BeginMFAEnrollment(ctx context.Context, user *domain.User) (*MFAEnrollment, error) {
+    if user.MFA.Enabled {
+        return nil, ErrMFAEnabled
+    }
+
+    key, err := newTOTPKey(s.MFAIssuer, user.Email)
+    if err != nil {
+        return nil, err
+    }
+    image, err := qrCode(key)
+    if err != nil {
+        return nil, err
+    }
+
+    mfa := user.MFA
+    mfa.PendingSecret = key.Secret()
+    if err := s.store.SaveMFA(ctx, user.ID, &mfa); err != nil {
+        return nil, err
+    }
+
+    return &MFAEnrollment{Secret: key.Secret(), ProvisioningURI: key.URL(), QRCode: image}, nil
+}
+
+// ConfirmMFAEnrollment enables MFA when the code matches the pending secret and returns
+// the recovery codes, which are shown only this once
+func (s *AuthService) ConfirmMFAEnrollment(ctx context.Context, user *domain.User, code string) ([]string, error) {
+    if user.MFA.Enabled {
+        return nil, ErrMFAEnabled
+    }
+    if user.MFA.PendingSecret == "" {
+        return nil, ErrNoPendingEnrollment
+    }
+
+    step, ok := matchTOTP(user.MFA.PendingSecret, code, time.Now())
+    if !ok {
+        return nil, ErrInvalidCode
+    }
+
+    codes, hashes := newRecoveryCodes()
+    now := time.Now().UTC()
+    mfa := domain.MFA{
+        Enabled:       true,
+        EnabledAt:     &now,
+        Secret:        user.MFA.PendingSecret,
+        RecoveryCodes: hashes,
+    }
+    if err := s.store.SaveMFA(ctx, user.ID, &mfa); err != nil {
+        return nil, err
+    }
+    if err := s.store.ConsumeTOTPStep(ctx, user.ID, step); err != nil && !errors.Is(err, domain.ErrCodeUsed) {
+        return nil, err
+    }
+
+    user.MFA = mfa
+    return codes, nil
+}
+
+// DisableMFA turns MFA off after checking a current code. Users whose roles require MFA
+// cannot disable it.
+func (s *AuthService) DisableMFA(ctx context.Context, user *domain.User, code, recoveryCode string) error {
+    if !user.MFA.Enabled {
+        return ErrMFANotEnabled
+    }
+
+    policy, err := s.store.GetMFAPolicy(ctx)
+    if err != nil {
+        return err
+    }
+    if policy.Requires(user.Roles) {
+        return ErrMFARequiredByPolicy
+    }
+
+    if err := s.checkSecondFactor(ctx, user, code, recoveryCode); err != nil {
+        return err
+    }
+    return s.store.SaveMFA(ctx, user.ID, &domain.MFA{})
+}
+
+// ResetMFA removes the second factor of a user who lost it, for administrators. Users
+// whose roles require MFA have to enroll again at their next login.
+func (s *AuthService) ResetMFA(ctx context.Context, userID string) error {
+    return s.store.SaveMFA(ctx, userID, &domain.MFA{})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes after checking a current code
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, user *domain.User, code string) ([]string, error) {
+    if !user.MFA.Enabled {
+        return nil, ErrMFANotEnabled
+    }
+    if err := s.checkSecondFactor(ctx, user, code, ""); err != nil {
+        return nil, err
+    }
+
+    codes, hashes := newRecoveryCodes()
+    mfa := user.MFA
+    mfa.RecoveryCodes = hashes
+    if err := s.store.SaveMFA(ctx, user.ID, &mfa); err != nil {
+        return nil, err
+    }
+    return codes, nil
+}
+
+// GetMFAStatus reports whether the user has MFA and whether their roles require it
+func (s *AuthService) GetMFAStatus(ctx context.Context, user *domain.User) (*MFAStatus, error) {
+    policy, err := s.store.GetMFAPolicy(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    return &MFAStatus{
+        Enabled:                user.MFA.Enabled,
+        EnabledAt:              user.MFA.EnabledAt,
+        RecoveryCodesRemaining: len(user.MFA.RecoveryCodes),
+        Required:               policy.Requires(user.Roles) && !user.ServiceAccount,
+    }, nil
+}
+
+// GetMFAPolicy returns the roles that require MFA
+func (s *AuthService) GetMFAPolicy(ctx context.Context) (*domain.MFAPolicy, error) {
+    return s.store.GetMFAPolicy(ctx)
+}
+
+// SetMFAPolicy requires MFA for the roles. Members without MFA have to enroll at their
+// next password login; sessions they already have keep working until they expire.
+func (s *AuthService) SetMFAPolicy(ctx context.Context, roles []string, updatedBy string) (*domain.MFAPolicy, error) {
+    seen := make(map[string]bool)
+    required := []string{}
+    for _, role := range roles {
+        role = strings.TrimSpace(role)
+        if role == "" {
+            return nil, ErrInvalidMFAPolicy
+        }
+        if !seen[role] {
+            seen[role] = true
+            required = append(required, role)
+        }
+    }
+    sort.Strings(required)
+
+    policy := &domain.MFAPolicy{RequiredRoles: required, UpdatedAt: time.Now().UTC(), UpdatedBy: updatedBy}
+    if err := s.store.SaveMFAPolicy(ctx, policy); err != nil {
+        return nil, err
+    }
+    return policy, nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+    "crypto/rand"
+    "crypto/subtle"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "strings"
+
+    "golang.org/x/crypto/argon2"
+    "golang.org/x/crypto/bcrypt"
+)
+
+// argon2id parameters recommended by RFC 9106 for memory constrained environments
+const (
+    argonTime    = 3
+    argonMemory  = 64 * 1024
+    argonThreads = 2
+    argonKeyLen  = 32
+    argonSaltLen = 16
+)
+
+var errInvalidHash = errors.New("invalid password hash")
+
+// HashPassword hashes a password with argon2id in PHC string format
+func HashPassword(password string) (string, error) {
+    salt := make([]byte, argonSaltLen)
+    if _, err := rand.Read(salt); err != nil {
+        return "", err
+    }
+
+    key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+    return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+        argon2.Version, argonMemory, argonTime, argonThreads,
+        base64.RawStdEncoding.EncodeToString(salt),
+        base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword checks a password against an argon2id or bcrypt hash. Bcrypt hashes
+// are accepted so accounts imported from other systems keep working.
+func VerifyPassword(hash, password string) (bool, error) {
+    switch {
+    case strings.HasPrefix(hash, "$argon2id$"):
+        return verifyArgon2id(hash, password)
+    case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+        err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+        if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+            return false, nil
+        }
+        return err == nil, err
+    default:
+        return false, errInvalidHash
+    }
+}
+
+// NeedsRehash reports whether a hash should be upgraded to the current argon2id parameters
+func NeedsRehash(hash string) bool {
+    var version, memory, time, threads int
+    _, err := fmt.Sscanf(hash, "$argon2id$v=%d$m=%d,t=%d,p=%d$", &version, &memory, &time, &threads)
+    return err != nil || version != argon2.Version || memory != argonMemory || time != argonTime || threads != argonThreads
+}
+
+func verifyArgon2id(hash, password string) (bool, error) {
+    parts := strings.Split(hash, "$")
+    if len(parts) != 6 {
+        return false, errInvalidHash
+    }
+
+    var version int
+    if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+        return false, errInvalidHash
+    }
+
+    var memory, time uint32
+    var threads uint8
+    if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+        return false, errInvalidHash
+    }
+
+    salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+    if err != nil {
+        return false, errInvalidHash
+    }
+    expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+    if err != nil {
+        return false, errInvalidHash
+    }
+
+    key := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(expected)))
+    return subtle.ConstantTimeCompare(key, expected) == 1, nil
+}
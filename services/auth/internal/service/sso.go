@@ -0,0 +1,86 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "time"
+
+    "devops-ide/services/auth/internal/domain"
+)
+
+var ErrEmailNotVerified = errors.New("the identity provider did not verify the email address")
+
+// ExternalIdentity is a user authenticated by a single sign-on provider
+type ExternalIdentity struct {
+    Provider      string
+    Subject       string
+    Email         string
+    EmailVerified bool
+    Roles         []string
+}
+
+// LoginExternal signs in a user authenticated by an identity provider, provisioning the
+// account on first login. Roles follow the provider on every login. Like Login, users
+// with MFA, or whose roles require it, get a *MFARequiredError instead of tokens.
+func (s *AuthService) LoginExternal(ctx context.Context, identity ExternalIdentity) (*domain.TokenPair, error) {
+    user, err := s.provisionUser(ctx, identity)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := s.mfaChallenge(ctx, user); err != nil {
+        return nil, err
+    }
+    return s.GenerateTokens(ctx, user)
+}
+
+func (s *AuthService) provisionUser(ctx context.Context, identity ExternalIdentity) (*domain.User, error) {
+    email := strings.ToLower(strings.TrimSpace(identity.Email))
+    now := time.Now().UTC()
+
+    user, err := s.store.GetUserByExternalID(ctx, identity.Provider, identity.Subject)
+    if err == nil {
+        user.Roles = identity.Roles
+        if email != "" && identity.EmailVerified {
+            user.Email = email
+        }
+        user.UpdatedAt = now
+        return user, s.store.UpdateUser(ctx, user)
+    }
+    if !errors.Is(err, domain.ErrUserNotFound) {
+        return nil, err
+    }
+
+    // Accounts are matched by email only when the provider vouches for it, otherwise
+    // anyone could take over a local account by registering its address at the IdP
+    if email == "" || !identity.EmailVerified {
+        return nil, ErrEmailNotVerified
+    }
+
+    user, err = s.store.GetUserByEmail(ctx, email)
+    if err == nil {
+        user.Provider = identity.Provider
+        user.ExternalID = identity.Subject
+        user.Roles = identity.Roles
+        user.UpdatedAt = now
+        return user, s.store.UpdateUser(ctx, user)
+    }
+    if !errors.Is(err, domain.ErrUserNotFound) {
+        return nil, err
+    }
+
+    user = &domain.User{
+        ID:         newID(),
+        Email:      email,
+        Roles:      identity.Roles,
+        Provider:   identity.Provider,
+        ExternalID: identity.Subject,
+        CreatedAt:  now,
+        UpdatedAt:  now,
+    }
+    if err := s.store.CreateUser(ctx, user); err != nil {
+        return nil, err
+    }
+    return user, nil
+}
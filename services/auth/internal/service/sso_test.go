@@ -0,0 +1,88 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+
+    "devops-ide/services/auth/internal/keys"
+    "devops-ide/services/auth/internal/store"
+
+    "github.com/pquerna/otp/totp"
+)
+
+func newTestService() *AuthService {
+    return NewAuthService(keys.NewHMACSigner("test-secret"), store.NewMemoryStore())
+}
+
+func TestLoginExternalWithTOTP(t *testing.T) {
+    s := newTestService()
+    ctx := context.Background()
+    identity := ExternalIdentity{
+        Provider:      "https://idp.example.com",
+        Subject:       "sub-1",
+        Email:         "dev@example.com",
+        EmailVerified: true,
+        Roles:         []string{"developer"},
+    }
+
+    if _, err := s.LoginExternal(ctx, identity); err != nil {
+        t.Fatalf("expected tokens before MFA is enrolled: %v", err)
+    }
+
+    user, err := s.store.GetUserByExternalID(ctx, identity.Provider, identity.Subject)
+    if err != nil {
+        t.Fatal(err)
+    }
+    enrollment, err := s.BeginMFAEnrollment(ctx, user)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if user, err = s.GetUser(ctx, user.ID); err != nil {
+        t.Fatal(err)
+    }
+    code, _ := totp.GenerateCodeCustom(enrollment.Secret, time.Now(), totpOpts)
+    if _, err := s.ConfirmMFAEnrollment(ctx, user, code); err != nil {
+        t.Fatal(err)
+    }
+
+    // The provider vouching for the user does not replace the second factor
+    tokens, err := s.LoginExternal(ctx, identity)
+    var challenge *MFARequiredError
+    if !errors.As(err, &challenge) || tokens != nil {
+        t.Fatalf("expected an MFA challenge instead of tokens, got %v, %v", tokens, err)
+    }
+    if challenge.Enroll {
+        t.Fatal("expected a verification challenge for an enrolled user")
+    }
+
+    if _, err := s.VerifyMFA(ctx, challenge.Token, "000000", ""); !errors.Is(err, ErrInvalidCode) {
+        t.Fatalf("expected a wrong code to be rejected, got %v", err)
+    }
+    next, _ := totp.GenerateCodeCustom(enrollment.Secret, time.Now().Add(totpPeriod*time.Second), totpOpts)
+    tokens, err = s.VerifyMFA(ctx, challenge.Token, next, "")
+    if err != nil || tokens.AccessToken == "" {
+        t.Fatalf("expected tokens after the second factor, got %v", err)
+    }
+}
+
+func TestLoginExternalRequiredByPolicy(t *testing.T) {
+    s := newTestService()
+    ctx := context.Background()
+    if _, err := s.SetMFAPolicy(ctx, []string{"admin"}, "test"); err != nil {
+        t.Fatal(err)
+    }
+
+    _, err := s.LoginExternal(ctx, ExternalIdentity{
+        Provider:      "https://idp.example.com",
+        Subject:       "sub-2",
+        Email:         "admin@example.com",
+        EmailVerified: true,
+        Roles:         []string{"admin"},
+    })
+    var challenge *MFARequiredError
+    if !errors.As(err, &challenge) || !challenge.Enroll {
+        t.Fatalf("expected an enrollment challenge, got %v", err)
+    }
+}
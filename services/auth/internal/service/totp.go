@@ -0,0 +1,102 @@
+package service
+
+import (
+    "bytes"
+    "crypto/rand"
+    "crypto/subtle"
+    "encoding/base64"
+    "image/png"
+    "strings"
+    "time"
+
+    "github.com/pquerna/otp"
+    "github.com/pquerna/otp/totp"
+)
+
+// TOTP parameters understood by every common authenticator app (RFC 6238 defaults)
+const (
+    totpPeriod = 30
+    totpDigits = otp.DigitsSix
+    // totpSkew accepts codes from one step before and after the current one, tolerating
+    // clock drift on the phone
+    totpSkew = 1
+
+    recoveryCodeCount = 10
+    // Recovery codes use a lowercase alphabet without look-alike characters
+    recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+var totpOpts = totp.ValidateOpts{Period: totpPeriod, Digits: totpDigits, Algorithm: otp.AlgorithmSHA1}
+
+// newTOTPKey generates a random secret and the otpauth:// URI authenticator apps import
+func newTOTPKey(issuer, account string) (*otp.Key, error) {
+    return totp.Generate(totp.GenerateOpts{
+        Issuer:      issuer,
+        AccountName: account,
+        Period:      totpPeriod,
+        SecretSize:  20,
+        Digits:      totpDigits,
+        Algorithm:   otp.AlgorithmSHA1,
+    })
+}
+
+// qrCode renders the provisioning URI of a key as a PNG data URI
+func qrCode(key *otp.Key) (string, error) {
+    img, err := key.Image(256, 256)
+    if err != nil {
+        return "", err
+    }
+
+    var buf bytes.Buffer
+    if err := png.Encode(&buf, img); err != nil {
+        return "", err
+    }
+    return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// matchTOTP checks a code against the steps around now and returns the step it belongs to
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+    code = strings.TrimSpace(code)
+    if len(code) != totpDigits.Length() {
+        return 0, false
+    }
+
+    current := now.Unix() / totpPeriod
+    for step := current - totpSkew; step <= current+totpSkew; step++ {
+        expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*totpPeriod, 0), totpOpts)
+        if err != nil {
+            return 0, false
+        }
+        if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+            return step, true
+        }
+    }
+    return 0, false
+}
+
+// newRecoveryCodes generates single-use recovery codes formatted as "xxxxx-xxxxx" and the
+// hashes stored for them
+func newRecoveryCodes() (codes, hashes []string) {
+    for i := 0; i < recoveryCodeCount; i++ {
+        value := make([]byte, 0, 10)
+        random := make([]byte, 1)
+        for len(value) < cap(value) {
+            rand.Read(random)
+            // Bytes past the last full multiple of the alphabet size would bias the codes
+            if int(random[0]) < 256-256%len(recoveryCodeAlphabet) {
+                value = append(value, recoveryCodeAlphabet[int(random[0])%len(recoveryCodeAlphabet)])
+            }
+        }
+
+        code := string(value[:5]) + "-" + string(value[5:])
+        codes = append(codes, code)
+        hashes = append(hashes, hashRecoveryCode(code))
+    }
+    return codes, hashes
+}
+
+// hashRecoveryCode ignores case, spaces and dashes so codes can be typed as printed or not
+func hashRecoveryCode(code string) string {
+    normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+    return hashToken(normalized)
+}
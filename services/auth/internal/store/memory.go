@@ -0,0 +1,379 @@
+package store
+
+import (
+    "context"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "devops-ide/services/auth/internal/domain"
+)
+
+// MemoryStore keeps users and tokens in memory, for development and tests
+type MemoryStore struct {
+    mu            sync.RWMutex
+    users         map[string]*domain.User
+    emails        map[string]string
+    refreshTokens map[string]*domain.RefreshToken
+    accessTokens  map[string]*domain.AccessToken
+    mfaPolicy     domain.MFAPolicy
+    signingKeys   map[string]*domain.SigningKey
+}
+
+func NewMemoryStore() *MemoryStore {
+    return &MemoryStore{
+        users:         make(map[string]*domain.User),
+        emails:        make(map[string]string),
+        refreshTokens: make(map[string]*domain.RefreshToken),
+        accessTokens:  make(map[string]*domain.AccessToken),
+        signingKeys:   make(map[string]*domain.SigningKey),
+    }
+}
+
+func (s *MemoryStore) CreateUser(ctx context.Context, user *domain.User) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    email := strings.ToLower(user.Email)
+    if _, ok := s.emails[email]; ok {
+        return domain.ErrEmailTaken
+    }
+
+    copied := *user
+    s.users[user.ID] = &copied
+    s.emails[email] = user.ID
+    return nil
+}
+
+func (s *MemoryStore) GetUserByID(ctx context.Context, id string) (*domain.User, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    user, ok := s.users[id]
+    if !ok {
+        return nil, domain.ErrUserNotFound
+    }
+
+    copied := *user
+    return &copied, nil
+}
+
+func (s *MemoryStore) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+    s.mu.RLock()
+    id, ok := s.emails[strings.ToLower(email)]
+    s.mu.RUnlock()
+    if !ok {
+        return nil, domain.ErrUserNotFound
+    }
+
+    return s.GetUserByID(ctx, id)
+}
+
+func (s *MemoryStore) GetUserByExternalID(ctx context.Context, provider, externalID string) (*domain.User, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    for _, user := range s.users {
+        if user.Provider == provider && user.ExternalID == externalID {
+            copied := *user
+            return &copied, nil
+        }
+    }
+    return nil, domain.ErrUserNotFound
+}
+
+func (s *MemoryStore) UpdateUser(ctx context.Context, user *domain.User) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    existing, ok := s.users[user.ID]
+    if !ok {
+        return domain.ErrUserNotFound
+    }
+
+    email := strings.ToLower(user.Email)
+    if id, ok := s.emails[email]; ok && id != user.ID {
+        return domain.ErrEmailTaken
+    }
+    delete(s.emails, strings.ToLower(existing.Email))
+    s.emails[email] = user.ID
+
+    copied := *user
+    copied.MFA = existing.MFA
+    s.users[user.ID] = &copied
+    return nil
+}
+
+func (s *MemoryStore) ListServiceAccounts(ctx context.Context) ([]*domain.User, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    accounts := []*domain.User{}
+    for _, user := range s.users {
+        if user.ServiceAccount {
+            copied := *user
+            accounts = append(accounts, &copied)
+        }
+    }
+    sort.Slice(accounts, func(i, j int) bool { return accounts[i].Email < accounts[j].Email })
+    return accounts, nil
+}
+
+func (s *MemoryStore) SaveRefreshToken(ctx context.Context, token *domain.RefreshToken) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    copied := *token
+    s.refreshTokens[token.TokenHash] = &copied
+    return nil
+}
+
+func (s *MemoryStore) GetRefreshToken(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    token, ok := s.refreshTokens[tokenHash]
+    if !ok {
+        return nil, domain.ErrTokenNotFound
+    }
+
+    copied := *token
+    return &copied, nil
+}
+
+func (s *MemoryStore) RotateRefreshToken(ctx context.Context, id string, next *domain.RefreshToken) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for _, token := range s.refreshTokens {
+        if token.ID != id {
+            continue
+        }
+        if token.Revoked() {
+            return domain.ErrTokenRevoked
+        }
+
+        now := time.Now()
+        token.RevokedAt = &now
+        token.ReplacedBy = next.ID
+
+        copied := *next
+        s.refreshTokens[next.TokenHash] = &copied
+        return nil
+    }
+
+    return domain.ErrTokenNotFound
+}
+
+func (s *MemoryStore) RevokeTokenFamily(ctx context.Context, familyID string) error {
+    s.revokeWhere(func(token *domain.RefreshToken) bool { return token.FamilyID == familyID })
+    return nil
+}
+
+func (s *MemoryStore) RevokeUserTokens(ctx context.Context, userID string) error {
+    s.revokeWhere(func(token *domain.RefreshToken) bool { return token.UserID == userID })
+    return nil
+}
+
+func (s *MemoryStore) revokeWhere(match func(token *domain.RefreshToken) bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now := time.Now()
+    for hash, token := range s.refreshTokens {
+        if !match(token) {
+            continue
+        }
+        // Expired tokens are useless, drop them instead of keeping them around revoked
+        if token.ExpiresAt.Before(now) {
+            delete(s.refreshTokens, hash)
+            continue
+        }
+        if !token.Revoked() {
+            token.RevokedAt = &now
+        }
+    }
+}
+
+func (s *MemoryStore) CreateAccessToken(ctx context.Context, token *domain.AccessToken) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    copied := *token
+    s.accessTokens[token.TokenHash] = &copied
+    return nil
+}
+
+func (s *MemoryStore) GetAccessToken(ctx context.Context, tokenHash string) (*domain.AccessToken, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    token, ok := s.accessTokens[tokenHash]
+    if !ok {
+        return nil, domain.ErrTokenNotFound
+    }
+
+    copied := *token
+    return &copied, nil
+}
+
+func (s *MemoryStore) ListAccessTokens(ctx context.Context, userID string) ([]*domain.AccessToken, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    tokens := []*domain.AccessToken{}
+    for _, token := range s.accessTokens {
+        if token.UserID == userID {
+            copied := *token
+            tokens = append(tokens, &copied)
+        }
+    }
+    sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.After(tokens[j].CreatedAt) })
+    return tokens, nil
+}
+
+func (s *MemoryStore) RevokeAccessToken(ctx context.Context, userID, id string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for _, token := range s.accessTokens {
+        if token.ID == id && token.UserID == userID {
+            if !token.Revoked() {
+                now := time.Now()
+                token.RevokedAt = &now
+            }
+            return nil
+        }
+    }
+    return domain.ErrTokenNotFound
+}
+
+func (s *MemoryStore) TouchAccessToken(ctx context.Context, id string, usedAt time.Time) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for _, token := range s.accessTokens {
+        if token.ID == id {
+            token.LastUsedAt = &usedAt
+            return nil
+        }
+    }
+    return domain.ErrTokenNotFound
+}
+
+func (s *MemoryStore) SaveMFA(ctx context.Context, userID string, mfa *domain.MFA) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    user, ok := s.users[userID]
+    if !ok {
+        return domain.ErrUserNotFound
+    }
+
+    lastStep := user.MFA.LastStep
+    user.MFA = *mfa
+    user.MFA.RecoveryCodes = append([]string{}, mfa.RecoveryCodes...)
+    user.MFA.LastStep = lastStep
+    user.MFA.FailedAttempts = 0
+    user.MFA.LastFailureAt = nil
+    return nil
+}
+
+func (s *MemoryStore) ConsumeTOTPStep(ctx context.Context, userID string, step int64) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    user, ok := s.users[userID]
+    if !ok {
+        return domain.ErrUserNotFound
+    }
+    if step <= user.MFA.LastStep {
+        return domain.ErrCodeUsed
+    }
+
+    user.MFA.LastStep = step
+    user.MFA.FailedAttempts = 0
+    return nil
+}
+
+func (s *MemoryStore) ConsumeRecoveryCode(ctx context.Context, userID, codeHash string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    user, ok := s.users[userID]
+    if !ok {
+        return domain.ErrUserNotFound
+    }
+
+    for i, code := range user.MFA.RecoveryCodes {
+        if code == codeHash {
+            remaining := append([]string{}, user.MFA.RecoveryCodes[:i]...)
+            user.MFA.RecoveryCodes = append(remaining, user.MFA.RecoveryCodes[i+1:]...)
+            user.MFA.FailedAttempts = 0
+            return nil
+        }
+    }
+    return domain.ErrCodeUsed
+}
+
+func (s *MemoryStore) RecordMFAFailure(ctx context.Context, userID string, at time.Time) (int, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    user, ok := s.users[userID]
+    if !ok {
+        return 0, domain.ErrUserNotFound
+    }
+
+    user.MFA.FailedAttempts++
+    user.MFA.LastFailureAt = &at
+    return user.MFA.FailedAttempts, nil
+}
+
+func (s *MemoryStore) GetMFAPolicy(ctx context.Context) (*domain.MFAPolicy, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    policy := s.mfaPolicy
+    policy.RequiredRoles = append([]string{}, s.mfaPolicy.RequiredRoles...)
+    return &policy, nil
+}
+
+func (s *MemoryStore) SaveMFAPolicy(ctx context.Context, policy *domain.MFAPolicy) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    s.mfaPolicy = *policy
+    s.mfaPolicy.RequiredRoles = append([]string{}, policy.RequiredRoles...)
+    return nil
+}
+
+func (s *MemoryStore) ListSigningKeys(ctx context.Context) ([]*domain.SigningKey, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    keys := make([]*domain.SigningKey, 0, len(s.signingKeys))
+    for _, key := range s.signingKeys {
+        copied := *key
+        keys = append(keys, &copied)
+    }
+    return keys, nil
+}
+
+func (s *MemoryStore) SaveSigningKey(ctx context.Context, key *domain.SigningKey) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    copied := *key
+    s.signingKeys[key.ID] = &copied
+    return nil
+}
+
+func (s *MemoryStore) DeleteSigningKey(ctx context.Context, id string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    delete(s.signingKeys, id)
+    return nil
+}
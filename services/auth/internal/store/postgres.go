@@ -0,0 +1,469 @@
+package store
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "strings"
+    "time"
+
+    "devops-ide/services/auth/internal/domain"
+
+    "github.com/lib/pq"
+)
+
+// Unique constraint violation, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const uniqueViolation = "23505"
+
+const schema = `
+CREATE TABLE IF NOT EXISTS users (
+    id            TEXT PRIMARY KEY,
+    email         TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL DEFAULT '',
+    roles         TEXT[] NOT NULL DEFAULT '{}',
+    created_at    TIMESTAMPTZ NOT NULL,
+    updated_at    TIMESTAMPTZ NOT NULL
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS provider TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS external_id TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX IF NOT EXISTS users_external_id_idx ON users (provider, external_id) WHERE external_id <> '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS service_account BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_enabled_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_pending_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_last_step BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_recovery_codes TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_failed_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_last_failure_at TIMESTAMPTZ;
+
+-- Single row table holding the roles that must use MFA
+CREATE TABLE IF NOT EXISTS mfa_policy (
+    id             BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    required_roles TEXT[] NOT NULL DEFAULT '{}',
+    updated_at     TIMESTAMPTZ NOT NULL,
+    updated_by     TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id          TEXT PRIMARY KEY,
+    user_id     TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    family_id   TEXT NOT NULL,
+    token_hash  TEXT NOT NULL UNIQUE,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL,
+    revoked_at  TIMESTAMPTZ,
+    replaced_by TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS access_tokens (
+    id           TEXT PRIMARY KEY,
+    user_id      TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name         TEXT NOT NULL,
+    prefix       TEXT NOT NULL,
+    token_hash   TEXT NOT NULL UNIQUE,
+    scopes       TEXT[] NOT NULL DEFAULT '{}',
+    expires_at   TIMESTAMPTZ NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS access_tokens_user_id_idx ON access_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS signing_keys (
+    id           TEXT PRIMARY KEY,
+    algorithm    TEXT NOT NULL,
+    private_key  BYTEA NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL,
+    activates_at TIMESTAMPTZ NOT NULL
+);
+`
+
+// PostgresStore keeps users and tokens in PostgreSQL
+type PostgresStore struct {
+    db *sql.DB
+}
+
+// NewPostgresStore connects to the database and creates the tables if needed
+func NewPostgresStore(ctx context.Context, dsn string) (*PostgresStore, error) {
+    db, err := sql.Open("postgres", dsn)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := db.PingContext(ctx); err != nil {
+        db.Close()
+        return nil, err
+    }
+
+    if _, err := db.ExecContext(ctx, schema); err != nil {
+        db.Close()
+        return nil, err
+    }
+
+    return &PostgresStore{db: db}, nil
+}
+
+func (s *PostgresStore) Close() error {
+    return s.db.Close()
+}
+
+func (s *PostgresStore) CreateUser(ctx context.Context, user *domain.User) error {
+    _, err := s.db.ExecContext(ctx, `
+        INSERT INTO users (id, email, password_hash, roles, provider, external_id, service_account, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+        user.ID, strings.ToLower(user.Email), user.Password, pq.Array(user.Roles),
+        user.Provider, user.ExternalID, user.ServiceAccount, user.CreatedAt, user.UpdatedAt)
+    return userError(err)
+}
+
+func (s *PostgresStore) GetUserByID(ctx context.Context, id string) (*domain.User, error) {
+    return s.getUser(ctx, `WHERE id = $1`, id)
+}
+
+func (s *PostgresStore) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+    return s.getUser(ctx, `WHERE email = $1`, strings.ToLower(email))
+}
+
+func (s *PostgresStore) GetUserByExternalID(ctx context.Context, provider, externalID string) (*domain.User, error) {
+    return s.getUser(ctx, `WHERE provider = $1 AND external_id = $2`, provider, externalID)
+}
+
+// userColumns are the columns scanned by scanUser
+const userColumns = `id, email, password_hash, roles, provider, external_id, service_account, created_at, updated_at,
+    mfa_enabled, mfa_enabled_at, mfa_secret, mfa_pending_secret, mfa_last_step, mfa_recovery_codes,
+    mfa_failed_attempts, mfa_last_failure_at`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+    Scan(dest ...interface{}) error
+}
+
+func scanUser(row rowScanner) (*domain.User, error) {
+    var user domain.User
+    var enabledAt, lastFailureAt sql.NullTime
+    err := row.Scan(&user.ID, &user.Email, &user.Password, pq.Array(&user.Roles),
+        &user.Provider, &user.ExternalID, &user.ServiceAccount, &user.CreatedAt, &user.UpdatedAt,
+        &user.MFA.Enabled, &enabledAt, &user.MFA.Secret, &user.MFA.PendingSecret, &user.MFA.LastStep,
+        pq.Array(&user.MFA.RecoveryCodes), &user.MFA.FailedAttempts, &lastFailureAt)
+    if err != nil {
+        return nil, err
+    }
+
+    if enabledAt.Valid {
+        user.MFA.EnabledAt = &enabledAt.Time
+    }
+    if lastFailureAt.Valid {
+        user.MFA.LastFailureAt = &lastFailureAt.Time
+    }
+    return &user, nil
+}
+
+func (s *PostgresStore) getUser(ctx context.Context, where string, args ...interface{}) (*domain.User, error) {
+    user, err := scanUser(s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users `+where, args...))
+    if errors.Is(err, sql.ErrNoRows) {
+        return nil, domain.ErrUserNotFound
+    }
+    return user, err
+}
+
+func (s *PostgresStore) ListServiceAccounts(ctx context.Context) ([]*domain.User, error) {
+    rows, err := s.db.QueryContext(ctx, `SELECT `+userColumns+` FROM users WHERE service_account ORDER BY email`)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    accounts := []*domain.User{}
+    for rows.Next() {
+        user, err := scanUser(rows)
+        if err != nil {
+            return nil, err
+        }
+        accounts = append(accounts, user)
+    }
+    return accounts, rows.Err()
+}
+
+func (s *PostgresStore) UpdateUser(ctx context.Context, user *domain.User) error {
+    result, err := s.db.ExecContext(ctx, `
+        UPDATE users SET email = $2, password_hash = $3, roles = $4, provider = $5, external_id = $6, updated_at = $7
+        WHERE id = $1`,
+        user.ID, strings.ToLower(user.Email), user.Password, pq.Array(user.Roles),
+        user.Provider, user.ExternalID, user.UpdatedAt)
+    if err != nil {
+        return userError(err)
+    }
+    return expectRow(result, domain.ErrUserNotFound)
+}
+
+func (s *PostgresStore) SaveRefreshToken(ctx context.Context, token *domain.RefreshToken) error {
+    return saveRefreshToken(ctx, s.db, token)
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+    ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func saveRefreshToken(ctx context.Context, db execer, token *domain.RefreshToken) error {
+    _, err := db.ExecContext(ctx, `
+        INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6)`,
+        token.ID, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt, token.CreatedAt)
+    return err
+}
+
+func (s *PostgresStore) GetRefreshToken(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+    var token domain.RefreshToken
+    var revokedAt sql.NullTime
+    err := s.db.QueryRowContext(ctx, `
+        SELECT id, user_id, family_id, token_hash, expires_at, created_at, revoked_at, replaced_by
+        FROM refresh_tokens WHERE token_hash = $1`, tokenHash).
+        Scan(&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash, &token.ExpiresAt,
+            &token.CreatedAt, &revokedAt, &token.ReplacedBy)
+    if errors.Is(err, sql.ErrNoRows) {
+        return nil, domain.ErrTokenNotFound
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    if revokedAt.Valid {
+        token.RevokedAt = &revokedAt.Time
+    }
+    return &token, nil
+}
+
+func (s *PostgresStore) RotateRefreshToken(ctx context.Context, id string, next *domain.RefreshToken) error {
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    // Only the first of concurrent rotations matches the unrevoked row
+    result, err := tx.ExecContext(ctx, `
+        UPDATE refresh_tokens SET revoked_at = $2, replaced_by = $3
+        WHERE id = $1 AND revoked_at IS NULL`, id, time.Now(), next.ID)
+    if err != nil {
+        return err
+    }
+    if err := expectRow(result, domain.ErrTokenRevoked); err != nil {
+        return err
+    }
+
+    if err := saveRefreshToken(ctx, tx, next); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+func (s *PostgresStore) RevokeTokenFamily(ctx context.Context, familyID string) error {
+    _, err := s.db.ExecContext(ctx, `
+        UPDATE refresh_tokens SET revoked_at = $2
+        WHERE family_id = $1 AND revoked_at IS NULL`, familyID, time.Now())
+    return err
+}
+
+func (s *PostgresStore) RevokeUserTokens(ctx context.Context, userID string) error {
+    _, err := s.db.ExecContext(ctx, `
+        UPDATE refresh_tokens SET revoked_at = $2
+        WHERE user_id = $1 AND revoked_at IS NULL`, userID, time.Now())
+    return err
+}
+
+func (s *PostgresStore) SaveMFA(ctx context.Context, userID string, mfa *domain.MFA) error {
+    result, err := s.db.ExecContext(ctx, `
+        UPDATE users SET mfa_enabled = $2, mfa_enabled_at = $3, mfa_secret = $4, mfa_pending_secret = $5,
+            mfa_recovery_codes = $6, mfa_failed_attempts = 0, mfa_last_failure_at = NULL
+        WHERE id = $1`,
+        userID, mfa.Enabled, mfa.EnabledAt, mfa.Secret, mfa.PendingSecret, pq.Array(mfa.RecoveryCodes))
+    if err != nil {
+        return err
+    }
+    return expectRow(result, domain.ErrUserNotFound)
+}
+
+func (s *PostgresStore) ConsumeTOTPStep(ctx context.Context, userID string, step int64) error {
+    // Only the first of concurrent logins with the same code matches the older step
+    result, err := s.db.ExecContext(ctx, `
+        UPDATE users SET mfa_last_step = $2, mfa_failed_attempts = 0
+        WHERE id = $1 AND mfa_last_step < $2`, userID, step)
+    if err != nil {
+        return err
+    }
+    return expectRow(result, domain.ErrCodeUsed)
+}
+
+func (s *PostgresStore) ConsumeRecoveryCode(ctx context.Context, userID, codeHash string) error {
+    result, err := s.db.ExecContext(ctx, `
+        UPDATE users SET mfa_recovery_codes = array_remove(mfa_recovery_codes, $2::text), mfa_failed_attempts = 0
+        WHERE id = $1 AND $2::text = ANY(mfa_recovery_codes)`, userID, codeHash)
+    if err != nil {
+        return err
+    }
+    return expectRow(result, domain.ErrCodeUsed)
+}
+
+func (s *PostgresStore) RecordMFAFailure(ctx context.Context, userID string, at time.Time) (int, error) {
+    var failures int
+    err := s.db.QueryRowContext(ctx, `
+        UPDATE users SET mfa_failed_attempts = mfa_failed_attempts + 1, mfa_last_failure_at = $2
+        WHERE id = $1 RETURNING mfa_failed_attempts`, userID, at).Scan(&failures)
+    if errors.Is(err, sql.ErrNoRows) {
+        return 0, domain.ErrUserNotFound
+    }
+    return failures, err
+}
+
+func (s *PostgresStore) GetMFAPolicy(ctx context.Context) (*domain.MFAPolicy, error) {
+    policy := &domain.MFAPolicy{RequiredRoles: []string{}}
+    err := s.db.QueryRowContext(ctx, `SELECT required_roles, updated_at, updated_by FROM mfa_policy`).
+        Scan(pq.Array(&policy.RequiredRoles), &policy.UpdatedAt, &policy.UpdatedBy)
+    if errors.Is(err, sql.ErrNoRows) {
+        return policy, nil
+    }
+    return policy, err
+}
+
+func (s *PostgresStore) SaveMFAPolicy(ctx context.Context, policy *domain.MFAPolicy) error {
+    _, err := s.db.ExecContext(ctx, `
+        INSERT INTO mfa_policy (id, required_roles, updated_at, updated_by) VALUES (TRUE, $1, $2, $3)
+        ON CONFLICT (id) DO UPDATE SET required_roles = $1, updated_at = $2, updated_by = $3`,
+        pq.Array(policy.RequiredRoles), policy.UpdatedAt, policy.UpdatedBy)
+    return err
+}
+
+// accessTokenColumns are the columns scanned by scanAccessToken
+const accessTokenColumns = `id, user_id, name, prefix, token_hash, scopes, expires_at, created_at, last_used_at, revoked_at`
+
+func scanAccessToken(row rowScanner) (*domain.AccessToken, error) {
+    var token domain.AccessToken
+    var lastUsedAt, revokedAt sql.NullTime
+    err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.Prefix, &token.TokenHash,
+        pq.Array(&token.Scopes), &token.ExpiresAt, &token.CreatedAt, &lastUsedAt, &revokedAt)
+    if err != nil {
+        return nil, err
+    }
+
+    if lastUsedAt.Valid {
+        token.LastUsedAt = &lastUsedAt.Time
+    }
+    if revokedAt.Valid {
+        token.RevokedAt = &revokedAt.Time
+    }
+    return &token, nil
+}
+
+func (s *PostgresStore) CreateAccessToken(ctx context.Context, token *domain.AccessToken) error {
+    _, err := s.db.ExecContext(ctx, `
+        INSERT INTO access_tokens (id, user_id, name, prefix, token_hash, scopes, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+        token.ID, token.UserID, token.Name, token.Prefix, token.TokenHash, pq.Array(token.Scopes),
+        token.ExpiresAt, token.CreatedAt)
+    return err
+}
+
+func (s *PostgresStore) GetAccessToken(ctx context.Context, tokenHash string) (*domain.AccessToken, error) {
+    token, err := scanAccessToken(s.db.QueryRowContext(ctx,
+        `SELECT `+accessTokenColumns+` FROM access_tokens WHERE token_hash = $1`, tokenHash))
+    if errors.Is(err, sql.ErrNoRows) {
+        return nil, domain.ErrTokenNotFound
+    }
+    return token, err
+}
+
+func (s *PostgresStore) ListAccessTokens(ctx context.Context, userID string) ([]*domain.AccessToken, error) {
+    rows, err := s.db.QueryContext(ctx,
+        `SELECT `+accessTokenColumns+` FROM access_tokens WHERE user_id = $1 ORDER BY created_at DESC`, userID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    tokens := []*domain.AccessToken{}
+    for rows.Next() {
+        token, err := scanAccessToken(rows)
+        if err != nil {
+            return nil, err
+        }
+        tokens = append(tokens, token)
+    }
+    return tokens, rows.Err()
+}
+
+func (s *PostgresStore) RevokeAccessToken(ctx context.Context, userID, id string) error {
+    result, err := s.db.ExecContext(ctx, `
+        UPDATE access_tokens SET revoked_at = COALESCE(revoked_at, $3)
+        WHERE id = $1 AND user_id = $2`, id, userID, time.Now())
+    if err != nil {
+        return err
+    }
+    return expectRow(result, domain.ErrTokenNotFound)
+}
+
+func (s *PostgresStore) TouchAccessToken(ctx context.Context, id string, usedAt time.Time) error {
+    _, err := s.db.ExecContext(ctx, `UPDATE access_tokens SET last_used_at = $2 WHERE id = $1`, id, usedAt)
+    return err
+}
+
+func (s *PostgresStore) ListSigningKeys(ctx context.Context) ([]*domain.SigningKey, error) {
+    rows, err := s.db.QueryContext(ctx, `
+        SELECT id, algorithm, private_key, created_at, activates_at
+        FROM signing_keys ORDER BY activates_at`)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var keys []*domain.SigningKey
+    for rows.Next() {
+        var key domain.SigningKey
+        if err := rows.Scan(&key.ID, &key.Algorithm, &key.PrivateKey, &key.CreatedAt, &key.ActivatesAt); err != nil {
+            return nil, err
+        }
+        keys = append(keys, &key)
+    }
+    return keys, rows.Err()
+}
+
+func (s *PostgresStore) SaveSigningKey(ctx context.Context, key *domain.SigningKey) error {
+    _, err := s.db.ExecContext(ctx, `
+        INSERT INTO signing_keys (id, algorithm, private_key, created_at, activates_at)
+        VALUES ($1, $2, $3, $4, $5)`,
+        key.ID, key.Algorithm, key.PrivateKey, key.CreatedAt, key.ActivatesAt)
+    return err
+}
+
+func (s *PostgresStore) DeleteSigningKey(ctx context.Context, id string) error {
+    _, err := s.db.ExecContext(ctx, `DELETE FROM signing_keys WHERE id = $1`, id)
+    return err
+}
+
+// userError translates a duplicate email into domain.ErrEmailTaken
+func userError(err error) error {
+    var pqErr *pq.Error
+    if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+        return domain.ErrEmailTaken
+    }
+    return err
+}
+
+// expectRow returns notFound when a statement affected no rows
+func expectRow(result sql.Result, notFound error) error {
+    rows, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if rows == 0 {
+        return notFound
+    }
+    return nil
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+    "context"
+    "time"
+
+    "devops-ide/services/auth/internal/domain"
+)
+
+// UserStore persists user accounts. Emails are matched case-insensitively.
+type UserStore interface {
+    CreateUser(ctx context.Context, user *domain.User) error
+    GetUserByID(ctx context.Context, id string) (*domain.User, error)
+    GetUserByEmail(ctx context.Context, email string) (*domain.User, error)
+    GetUserByExternalID(ctx context.Context, provider, externalID string) (*domain.User, error)
+    UpdateUser(ctx context.Context, user *domain.User) error
+    ListServiceAccounts(ctx context.Context) ([]*domain.User, error)
+}
+
+// RefreshTokenStore persists refresh tokens by the hash of their value
+type RefreshTokenStore interface {
+    SaveRefreshToken(ctx context.Context, token *domain.RefreshToken) error
+    GetRefreshToken(ctx context.Context, tokenHash string) (*domain.RefreshToken, error)
+    // RotateRefreshToken revokes a token in favour of next in one step, failing with
+    // domain.ErrTokenRevoked when a concurrent request already rotated it
+    RotateRefreshToken(ctx context.Context, id string, next *domain.RefreshToken) error
+    RevokeTokenFamily(ctx context.Context, familyID string) error
+    RevokeUserTokens(ctx context.Context, userID string) error
+}
+
+// AccessTokenStore persists personal access and service account tokens by the hash of
+// their value
+type AccessTokenStore interface {
+    CreateAccessToken(ctx context.Context, token *domain.AccessToken) error
+    GetAccessToken(ctx context.Context, tokenHash string) (*domain.AccessToken, error)
+    ListAccessTokens(ctx context.Context, userID string) ([]*domain.AccessToken, error)
+    // RevokeAccessToken revokes a token of the user, failing with domain.ErrTokenNotFound
+    // when the user has no such token
+    RevokeAccessToken(ctx context.Context, userID, id string) error
+    TouchAccessToken(ctx context.Context, id string, usedAt time.Time) error
+}
+
+// MFAStore persists second factor state. Codes are consumed atomically, so concurrent
+// logins cannot use the same code twice.
+type MFAStore interface {
+    // SaveMFA replaces the user's MFA state and resets the failure counter. The last
+    // accepted time step is kept, so codes used before stay used.
+    SaveMFA(ctx context.Context, userID string, mfa *domain.MFA) error
+    // ConsumeTOTPStep records the time step of an accepted code, failing with
+    // domain.ErrCodeUsed unless it is later than the last recorded step
+    ConsumeTOTPStep(ctx context.Context, userID string, step int64) error
+    // ConsumeRecoveryCode removes a recovery code, failing with domain.ErrCodeUsed when
+    // the user has no such code
+    ConsumeRecoveryCode(ctx context.Context, userID, codeHash string) error
+    // RecordMFAFailure counts a wrong code and returns the failures since the last success
+    RecordMFAFailure(ctx context.Context, userID string, at time.Time) (int, error)
+    GetMFAPolicy(ctx context.Context) (*domain.MFAPolicy, error)
+    SaveMFAPolicy(ctx context.Context, policy *domain.MFAPolicy) error
+}
+
+// SigningKeyStore persists token signing keys so restarts and replicas share them
+type SigningKeyStore interface {
+    ListSigningKeys(ctx context.Context) ([]*domain.SigningKey, error)
+    SaveSigningKey(ctx context.Context, key *domain.SigningKey) error
+    DeleteSigningKey(ctx context.Context, id string) error
+}
+
+// Store combines the stores the auth service needs
+type Store interface {
+    UserStore
+    RefreshTokenStore
+    AccessTokenStore
+    MFAStore
+    SigningKeyStore
+}
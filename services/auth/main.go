@@ -1,13 +1,68 @@
 package main
 
 import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
     "log"
     "net/http"
+    "net/url"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "devops-ide/services/auth/internal/domain"
+    "devops-ide/services/auth/internal/keys"
+    "devops-ide/services/auth/internal/oidc"
+    "devops-ide/services/auth/internal/service"
+    "devops-ide/services/auth/internal/store"
 
     "github.com/gorilla/mux"
 )
 
+var authService *service.AuthService
+
+// keyring rotates the published signing keys, nil when signing with HS256
+var keyring *keys.Keyring
+
+// ssoProvider is set when single sign-on is configured with OIDC_ISSUER_URL
+var ssoProvider *oidc.Provider
+
+// postLoginRedirect is the IDE page receiving tokens after single sign-on
+var postLoginRedirect string
+
+// Cookie binding the provider callback to the browser that started the login
+const oidcStateCookie = "oidc_state"
+
 func main() {
+    userStore, err := newStore()
+    if err != nil {
+        log.Fatalf("Failed to open user store: %v", err)
+    }
+
+    signer, err := newSigner(userStore)
+    if err != nil {
+        log.Fatalf("Failed to set up token signing: %v", err)
+    }
+
+    authService = service.NewAuthService(signer, userStore)
+    authService.Issuer = getEnv("AUTH_ISSUER", authService.Issuer)
+    authService.Audience = getEnv("AUTH_AUDIENCE", authService.Audience)
+    authService.MFAIssuer = getEnv("AUTH_MFA_ISSUER", authService.MFAIssuer)
+
+    if keyring != nil {
+        if keyring.Overlap < authService.AccessTokenTTL {
+            log.Fatalf("AUTH_KEY_OVERLAP must be at least the access token lifetime of %s", authService.AccessTokenTTL)
+        }
+        go keyring.Run(context.Background(), time.Minute)
+    }
+
+    if err := bootstrapAdmin(); err != nil {
+        log.Fatalf("Failed to create admin user: %v", err)
+    }
+
     r := mux.NewRouter()
 
     // Auth routes
@@ -15,22 +70,368 @@ func main() {
     r.HandleFunc("/auth/refresh", refreshTokenHandler).Methods("POST")
     r.HandleFunc("/auth/logout", logoutHandler).Methods("POST")
     r.HandleFunc("/auth/verify", verifyTokenHandler).Methods("GET")
+    r.HandleFunc("/.well-known/jwks.json", jwksHandler).Methods("GET")
+    registerTokenRoutes(r)
+    registerMFARoutes(r)
+
+    if issuer := os.Getenv("OIDC_ISSUER_URL"); issuer != "" {
+        config, err := oidcConfig(issuer)
+        if err != nil {
+            log.Fatalf("Invalid OIDC configuration: %v", err)
+        }
+        ssoProvider = oidc.NewProvider(config)
+        postLoginRedirect = getEnv("OIDC_POST_LOGIN_REDIRECT", "http://localhost:5173/auth/callback")
+
+        r.HandleFunc("/auth/oidc/login", oidcLoginHandler).Methods("GET")
+        r.HandleFunc("/auth/oidc/callback", oidcCallbackHandler).Methods("GET")
+    }
 
     log.Fatal(http.ListenAndServe(":8081", r))
 }
 
+// newStore uses PostgreSQL when DB_HOST is set and keeps users in memory otherwise
+func newStore() (store.Store, error) {
+    host := os.Getenv("DB_HOST")
+    if host == "" {
+        log.Printf("DB_HOST not set, keeping users in memory")
+        return store.NewMemoryStore(), nil
+    }
+
+    dsn := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s",
+        host,
+        getEnv("DB_PORT", "5432"),
+        getEnv("DB_NAME", "auth"),
+        getEnv("DB_USER", "postgres"),
+        os.Getenv("DB_PASSWORD"),
+        getEnv("DB_SSLMODE", "disable"))
+
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+    return store.NewPostgresStore(ctx, dsn)
+}
+
+// newSigner signs with rotating keys of AUTH_SIGNING_ALG (RS256 or EdDSA), or with the
+// JWT_SECRET shared secret when AUTH_SIGNING_ALG=HS256 for local development
+func newSigner(userStore store.Store) (keys.Signer, error) {
+    algorithm := getEnv("AUTH_SIGNING_ALG", keys.AlgorithmRS256)
+    if algorithm == keys.AlgorithmHS256 {
+        secret := os.Getenv("JWT_SECRET")
+        if secret == "" {
+            return nil, errors.New("JWT_SECRET is required for HS256 signing")
+        }
+        log.Printf("WARNING: signing tokens with the HS256 JWT_SECRET, do not use in production")
+        return keys.NewHMACSigner(secret), nil
+    }
+
+    var err error
+    keyring, err = keys.NewKeyring(userStore, algorithm)
+    if err != nil {
+        return nil, err
+    }
+
+    if keyring.RotationInterval, err = getDuration("AUTH_KEY_ROTATION_INTERVAL", keyring.RotationInterval); err != nil {
+        return nil, err
+    }
+    if keyring.Overlap, err = getDuration("AUTH_KEY_OVERLAP", keyring.Overlap); err != nil {
+        return nil, err
+    }
+    if keyring.RotationInterval <= 2*keyring.Overlap {
+        return nil, errors.New("AUTH_KEY_ROTATION_INTERVAL must be more than twice AUTH_KEY_OVERLAP")
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+    return keyring, keyring.Rotate(ctx)
+}
+
+// bootstrapAdmin creates the AUTH_ADMIN_EMAIL account on first start so someone can log in
+func bootstrapAdmin() error {
+    email, password := os.Getenv("AUTH_ADMIN_EMAIL"), os.Getenv("AUTH_ADMIN_PASSWORD")
+    if email == "" || password == "" {
+        return nil
+    }
+
+    _, err := authService.CreateUser(context.Background(), email, password, []string{"admin"})
+    if errors.Is(err, domain.ErrEmailTaken) {
+        return nil
+    }
+    return err
+}
+
+// oidcConfig reads the provider settings. Group mappings are given as "group=role"
+// pairs separated by commas.
+func oidcConfig(issuer string) (oidc.Config, error) {
+    config := oidc.Config{
+        IssuerURL:    issuer,
+        ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+        ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+        RedirectURL:  getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/auth/oidc/callback"),
+        GroupsClaim:  getEnv("OIDC_GROUPS_CLAIM", "groups"),
+        DefaultRole:  getEnv("OIDC_DEFAULT_ROLE", "viewer"),
+        RoleMapping:  make(map[string]string),
+    }
+    if scopes := os.Getenv("OIDC_SCOPES"); scopes != "" {
+        config.Scopes = strings.Fields(scopes)
+    }
+
+    if config.ClientID == "" {
+        return config, errors.New("OIDC_CLIENT_ID is required")
+    }
+
+    if mapping := os.Getenv("OIDC_ROLE_MAPPING"); mapping != "" {
+        for _, pair := range strings.Split(mapping, ",") {
+            group, role, found := strings.Cut(strings.TrimSpace(pair), "=")
+            if !found || group == "" || role == "" {
+                return config, fmt.Errorf("invalid OIDC role mapping entry: %q", pair)
+            }
+            config.RoleMapping[group] = role
+        }
+    }
+
+    return config, nil
+}
+
+type loginRequest struct {
+    Email    string `json:"email"`
+    Password string `json:"password"`
+}
+
+type refreshRequest struct {
+    RefreshToken string `json:"refresh_token"`
+    // Everywhere revokes every session of the user on logout
+    Everywhere bool `json:"everywhere"`
+}
+
 func loginHandler(w http.ResponseWriter, r *http.Request) {
-    // Implement OAuth2/OpenID Connect login logic
+    var req loginRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" || req.Password == "" {
+        writeError(w, http.StatusBadRequest, "Email and password are required")
+        return
+    }
+
+    tokens, err := authService.Login(r.Context(), req.Email, req.Password)
+    if errors.Is(err, service.ErrInvalidCredentials) {
+        writeError(w, http.StatusUnauthorized, err.Error())
+        return
+    }
+    var mfaErr *service.MFARequiredError
+    if errors.As(err, &mfaErr) {
+        writeMFAChallenge(w, mfaErr)
+        return
+    }
+    if err != nil {
+        log.Printf("Login failed: %v", err)
+        writeError(w, http.StatusInternalServerError, "Login failed")
+        return
+    }
+
+    writeJSON(w, http.StatusOK, tokens)
 }
 
 func refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
-    // Implement token refresh logic
+    var req refreshRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+        writeError(w, http.StatusBadRequest, "A refresh token is required")
+        return
+    }
+
+    tokens, err := authService.Refresh(r.Context(), req.RefreshToken)
+    switch {
+    case errors.Is(err, service.ErrTokenReuse):
+        log.Printf("Refresh token reuse detected, session revoked")
+        writeError(w, http.StatusUnauthorized, err.Error())
+        return
+    case errors.Is(err, service.ErrInvalidToken):
+        writeError(w, http.StatusUnauthorized, err.Error())
+        return
+    case err != nil:
+        log.Printf("Token refresh failed: %v", err)
+        writeError(w, http.StatusInternalServerError, "Token refresh failed")
+        return
+    }
+
+    writeJSON(w, http.StatusOK, tokens)
 }
 
 func logoutHandler(w http.ResponseWriter, r *http.Request) {
-    // Implement logout logic
+    var req refreshRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+        writeError(w, http.StatusBadRequest, "A refresh token is required")
+        return
+    }
+
+    if err := authService.Logout(r.Context(), req.RefreshToken, req.Everywhere); err != nil {
+        log.Printf("Logout failed: %v", err)
+        writeError(w, http.StatusInternalServerError, "Logout failed")
+        return
+    }
+
+    w.WriteHeader(http.StatusNoContent)
 }
 
+// verifyTokenHandler validates the bearer token and returns its claims, also as
+// X-User-* headers so the gateway can use it for forward authentication. It accepts
+// access tokens as well as session tokens and is how services introspect the former.
 func verifyTokenHandler(w http.ResponseWriter, r *http.Request) {
-    // Implement token verification logic
+    scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+    if !strings.EqualFold(scheme, "Bearer") || token == "" {
+        w.Header().Set("WWW-Authenticate", `Bearer realm="devops-ide"`)
+        writeError(w, http.StatusUnauthorized, "A bearer token is required")
+        return
+    }
+
+    var claims *service.Claims
+    var err error
+    if service.IsAccessToken(token) {
+        claims, err = authService.IntrospectAccessToken(r.Context(), token)
+    } else {
+        claims, err = authService.VerifyAccessToken(token)
+    }
+    if errors.Is(err, service.ErrInvalidToken) {
+        w.Header().Set("WWW-Authenticate", `Bearer realm="devops-ide", error="invalid_token"`)
+        writeError(w, http.StatusUnauthorized, err.Error())
+        return
+    }
+    if err != nil {
+        log.Printf("Token verification failed: %v", err)
+        writeError(w, http.StatusInternalServerError, "Token verification failed")
+        return
+    }
+
+    w.Header().Set("X-User-ID", claims.UserID)
+    w.Header().Set("X-User-Email", claims.Email)
+    w.Header().Set("X-User-Roles", strings.Join(claims.Roles, ","))
+    if len(claims.Scopes) > 0 {
+        w.Header().Set("X-User-Scopes", strings.Join(claims.Scopes, ","))
+    }
+    writeJSON(w, http.StatusOK, claims)
+}
+
+// jwksHandler publishes the public signing keys. The cache lifetime is well below the
+// overlap window, so verifiers learn new keys before they are used.
+func jwksHandler(w http.ResponseWriter, r *http.Request) {
+    set := keys.JWKS{Keys: []keys.JWK{}}
+    if keyring != nil {
+        set = keyring.JWKS()
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "public, max-age=300")
+    json.NewEncoder(w).Encode(set)
+}
+
+// oidcLoginHandler sends the browser to the identity provider
+func oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+    authURL, state, err := ssoProvider.StartLogin(r.Context())
+    if err != nil {
+        log.Printf("Failed to start single sign-on: %v", err)
+        writeError(w, http.StatusBadGateway, "Identity provider unavailable")
+        return
+    }
+
+    http.SetCookie(w, &http.Cookie{
+        Name:     oidcStateCookie,
+        Value:    state,
+        Path:     "/auth/oidc",
+        MaxAge:   600,
+        HttpOnly: true,
+        Secure:   strings.HasPrefix(postLoginRedirect, "https://"),
+        SameSite: http.SameSiteLaxMode,
+    })
+    http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcCallbackHandler completes single sign-on and hands the tokens to the IDE in the
+// URL fragment of the post-login page, which keeps them out of server logs
+func oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    if providerError := query.Get("error"); providerError != "" {
+        redirectAfterLogin(w, r, url.Values{"error": {providerError}})
+        return
+    }
+
+    state := query.Get("state")
+    cookie, err := r.Cookie(oidcStateCookie)
+    if err != nil || state == "" || cookie.Value != state {
+        redirectAfterLogin(w, r, url.Values{"error": {"invalid_state"}})
+        return
+    }
+    http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/auth/oidc", MaxAge: -1})
+
+    identity, err := ssoProvider.FinishLogin(r.Context(), state, query.Get("code"))
+    if err != nil {
+        log.Printf("Single sign-on failed: %v", err)
+        redirectAfterLogin(w, r, url.Values{"error": {"login_failed"}})
+        return
+    }
+
+    tokens, err := authService.LoginExternal(r.Context(), service.ExternalIdentity{
+        Provider:      identity.Issuer,
+        Subject:       identity.Subject,
+        Email:         identity.Email,
+        EmailVerified: identity.EmailVerified,
+        Roles:         ssoProvider.Roles(identity),
+    })
+    if errors.Is(err, service.ErrEmailNotVerified) {
+        redirectAfterLogin(w, r, url.Values{"error": {"email_not_verified"}})
+        return
+    }
+    var mfaErr *service.MFARequiredError
+    if errors.As(err, &mfaErr) {
+        redirectAfterLogin(w, r, url.Values{
+            "mfa_required":            {"true"},
+            "mfa_enrollment_required": {strconv.FormatBool(mfaErr.Enroll)},
+            "mfa_token":               {mfaErr.Token},
+            "expires_in":              {strconv.FormatInt(int64(mfaErr.ExpiresIn.Seconds()), 10)},
+        })
+        return
+    }
+    if err != nil {
+        log.Printf("Failed to provision single sign-on user: %v", err)
+        redirectAfterLogin(w, r, url.Values{"error": {"login_failed"}})
+        return
+    }
+
+    redirectAfterLogin(w, r, url.Values{
+        "access_token":  {tokens.AccessToken},
+        "refresh_token": {tokens.RefreshToken},
+        "token_type":    {tokens.TokenType},
+        "expires_in":    {strconv.FormatInt(tokens.ExpiresIn, 10)},
+    })
+}
+
+func redirectAfterLogin(w http.ResponseWriter, r *http.Request, fragment url.Values) {
+    w.Header().Set("Cache-Control", "no-store")
+    http.Redirect(w, r, postLoginRedirect+"#"+fragment.Encode(), http.StatusFound)
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+    writeJSON(w, status, map[string]string{"error": message})
+}
+
+func getEnv(key, defaultValue string) string {
+    if value := os.Getenv(key); value != "" {
+        return value
+    }
+    return defaultValue
+}
+
+func getDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+    value := os.Getenv(key)
+    if value == "" {
+        return defaultValue, nil
+    }
+
+    duration, err := time.ParseDuration(value)
+    if err != nil {
+        return 0, fmt.Errorf("invalid %s: %v", key, err)
+    }
+    return duration, nil
 }
\ No newline at end of file
@@ -0,0 +1,267 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "log"
+    "net/http"
+    "strings"
+
+    "devops-ide/services/auth/internal/domain"
+    "devops-ide/services/auth/internal/service"
+
+    "github.com/gorilla/mux"
+)
+
+type mfaLoginRequest struct {
+    MFAToken     string `json:"mfa_token"`
+    Code         string `json:"code"`
+    RecoveryCode string `json:"recovery_code"`
+}
+
+type mfaCodeRequest struct {
+    Code         string `json:"code"`
+    RecoveryCode string `json:"recovery_code"`
+}
+
+type mfaPolicyRequest struct {
+    RequiredRoles []string `json:"required_roles"`
+}
+
+// mfaActivation returns the recovery codes, and the tokens when the enrollment finished a login
+type mfaActivation struct {
+    RecoveryCodes []string `json:"recovery_codes"`
+    *domain.TokenPair
+}
+
+// registerMFARoutes adds the second login step and the endpoints managing MFA
+func registerMFARoutes(r *mux.Router) {
+    r.HandleFunc("/auth/login/mfa", mfaLoginHandler).Methods("POST")
+
+    r.HandleFunc("/auth/mfa", withSession(mfaStatusHandler)).Methods("GET")
+    r.HandleFunc("/auth/mfa/enroll", withEnrollment(mfaEnrollHandler)).Methods("POST")
+    r.HandleFunc("/auth/mfa/activate", withEnrollment(mfaActivateHandler)).Methods("POST")
+    r.HandleFunc("/auth/mfa/disable", withSession(mfaDisableHandler)).Methods("POST")
+    r.HandleFunc("/auth/mfa/recovery-codes", withSession(mfaRecoveryCodesHandler)).Methods("POST")
+
+    r.HandleFunc("/auth/mfa/policy", withAdmin(getMFAPolicyHandler)).Methods("GET")
+    r.HandleFunc("/auth/mfa/policy", withAdmin(setMFAPolicyHandler)).Methods("PUT")
+    r.HandleFunc("/auth/users/{id}/mfa", withAdmin(resetMFAHandler)).Methods("DELETE")
+}
+
+// writeMFAChallenge answers a login that needs a second step. It is a 401 so clients
+// unaware of MFA treat it as a failed login rather than looking for tokens.
+func writeMFAChallenge(w http.ResponseWriter, challenge *service.MFARequiredError) {
+    writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+        "error":                   challenge.Error(),
+        "mfa_required":            true,
+        "mfa_enrollment_required": challenge.Enroll,
+        "mfa_token":               challenge.Token,
+        "expires_in":              int64(challenge.ExpiresIn.Seconds()),
+    })
+}
+
+// writeMFAError maps MFA errors to responses, logging unexpected ones
+func writeMFAError(w http.ResponseWriter, err error, action string) {
+    switch {
+    case errors.Is(err, service.ErrInvalidCode):
+        writeError(w, http.StatusBadRequest, err.Error())
+    case errors.Is(err, service.ErrMFALocked):
+        writeError(w, http.StatusTooManyRequests, err.Error())
+    case errors.Is(err, service.ErrMFAEnabled), errors.Is(err, service.ErrMFANotEnabled),
+        errors.Is(err, service.ErrNoPendingEnrollment):
+        writeError(w, http.StatusConflict, err.Error())
+    case errors.Is(err, service.ErrMFARequiredByPolicy):
+        writeError(w, http.StatusForbidden, err.Error())
+    case errors.Is(err, domain.ErrUserNotFound):
+        writeError(w, http.StatusNotFound, err.Error())
+    default:
+        log.Printf("%s failed: %v", action, err)
+        writeError(w, http.StatusInternalServerError, action+" failed")
+    }
+}
+
+type enrollmentHandler func(w http.ResponseWriter, r *http.Request, user *domain.User, challenge bool)
+
+// withEnrollment runs the handler for a session token or for the challenge token of a
+// login that has to enroll MFA first
+func withEnrollment(handler enrollmentHandler) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        _, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+        if challenge, err := authService.ParseMFAChallenge(token); err == nil && challenge.Enroll {
+            user, err := authService.GetUser(r.Context(), challenge.UserID)
+            if err != nil {
+                writeError(w, http.StatusUnauthorized, service.ErrInvalidToken.Error())
+                return
+            }
+            handler(w, r, user, true)
+            return
+        }
+
+        withSession(func(w http.ResponseWriter, r *http.Request, claims *service.Claims) {
+            if user, ok := sessionUser(w, r, claims); ok {
+                handler(w, r, user, false)
+            }
+        })(w, r)
+    }
+}
+
+// sessionUser loads the user a session token was issued to
+func sessionUser(w http.ResponseWriter, r *http.Request, claims *service.Claims) (*domain.User, bool) {
+    user, err := authService.GetUser(r.Context(), claims.UserID)
+    if err != nil {
+        writeError(w, http.StatusUnauthorized, service.ErrInvalidToken.Error())
+        return nil, false
+    }
+    return user, true
+}
+
+func mfaLoginHandler(w http.ResponseWriter, r *http.Request) {
+    var req mfaLoginRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" ||
+        (req.Code == "" && req.RecoveryCode == "") {
+        writeError(w, http.StatusBadRequest, "An MFA token and a code or recovery code are required")
+        return
+    }
+
+    tokens, err := authService.VerifyMFA(r.Context(), req.MFAToken, req.Code, req.RecoveryCode)
+    switch {
+    case errors.Is(err, service.ErrInvalidToken), errors.Is(err, service.ErrInvalidCode):
+        writeError(w, http.StatusUnauthorized, err.Error())
+        return
+    case err != nil:
+        writeMFAError(w, err, "Login")
+        return
+    }
+
+    writeJSON(w, http.StatusOK, tokens)
+}
+
+func mfaStatusHandler(w http.ResponseWriter, r *http.Request, claims *service.Claims) {
+    user, ok := sessionUser(w, r, claims)
+    if !ok {
+        return
+    }
+
+    status, err := authService.GetMFAStatus(r.Context(), user)
+    if err != nil {
+        writeMFAError(w, err, "Loading MFA status")
+        return
+    }
+    writeJSON(w, http.StatusOK, status)
+}
+
+func mfaEnrollHandler(w http.ResponseWriter, r *http.Request, user *domain.User, challenge bool) {
+    enrollment, err := authService.BeginMFAEnrollment(r.Context(), user)
+    if err != nil {
+        writeMFAError(w, err, "MFA enrollment")
+        return
+    }
+    writeJSON(w, http.StatusOK, enrollment)
+}
+
+func mfaActivateHandler(w http.ResponseWriter, r *http.Request, user *domain.User, challenge bool) {
+    var req mfaCodeRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+        writeError(w, http.StatusBadRequest, "A code from the authenticator app is required")
+        return
+    }
+
+    codes, err := authService.ConfirmMFAEnrollment(r.Context(), user, req.Code)
+    if err != nil {
+        writeMFAError(w, err, "MFA activation")
+        return
+    }
+    log.Printf("MFA enabled for %s", user.Email)
+
+    activation := mfaActivation{RecoveryCodes: codes}
+    if challenge {
+        // The login that required enrollment completes now
+        if activation.TokenPair, err = authService.GenerateTokens(r.Context(), user); err != nil {
+            writeMFAError(w, err, "Login")
+            return
+        }
+    }
+    writeJSON(w, http.StatusOK, activation)
+}
+
+func mfaDisableHandler(w http.ResponseWriter, r *http.Request, claims *service.Claims) {
+    user, ok := sessionUser(w, r, claims)
+    if !ok {
+        return
+    }
+
+    var req mfaCodeRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+        writeError(w, http.StatusBadRequest, "A code or recovery code is required")
+        return
+    }
+
+    if err := authService.DisableMFA(r.Context(), user, req.Code, req.RecoveryCode); err != nil {
+        writeMFAError(w, err, "Disabling MFA")
+        return
+    }
+    log.Printf("MFA disabled for %s", user.Email)
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func mfaRecoveryCodesHandler(w http.ResponseWriter, r *http.Request, claims *service.Claims) {
+    user, ok := sessionUser(w, r, claims)
+    if !ok {
+        return
+    }
+
+    var req mfaCodeRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+        writeError(w, http.StatusBadRequest, "A code from the authenticator app is required")
+        return
+    }
+
+    codes, err := authService.RegenerateRecoveryCodes(r.Context(), user, req.Code)
+    if err != nil {
+        writeMFAError(w, err, "Generating recovery codes")
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string][]string{"recovery_codes": codes})
+}
+
+func getMFAPolicyHandler(w http.ResponseWriter, r *http.Request, claims *service.Claims) {
+    policy, err := authService.GetMFAPolicy(r.Context())
+    if err != nil {
+        writeMFAError(w, err, "Loading MFA policy")
+        return
+    }
+    writeJSON(w, http.StatusOK, policy)
+}
+
+func setMFAPolicyHandler(w http.ResponseWriter, r *http.Request, claims *service.Claims) {
+    var req mfaPolicyRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, http.StatusBadRequest, "Invalid request body")
+        return
+    }
+
+    policy, err := authService.SetMFAPolicy(r.Context(), req.RequiredRoles, claims.Email)
+    if errors.Is(err, service.ErrInvalidMFAPolicy) {
+        writeError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    if err != nil {
+        writeMFAError(w, err, "Saving MFA policy")
+        return
+    }
+
+    log.Printf("MFA required for roles %v by %s", policy.RequiredRoles, claims.Email)
+    writeJSON(w, http.StatusOK, policy)
+}
+
+func resetMFAHandler(w http.ResponseWriter, r *http.Request, claims *service.Claims) {
+    id := mux.Vars(r)["id"]
+    if err := authService.ResetMFA(r.Context(), id); err != nil {
+        writeMFAError(w, err, "Resetting MFA")
+        return
+    }
+
+    log.Printf("MFA of user %s reset by %s", id, claims.Email)
+    w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "log"
+    "net/http"
+    "strings"
+    "time"
+
+    "devops-ide/services/auth/internal/domain"
+    "devops-ide/services/auth/internal/service"
+
+    "github.com/gorilla/mux"
+)
+
+type createTokenRequest struct {
+    Name   string   `json:"name"`
+    Scopes []string `json:"scopes"`
+    // ExpiresIn is the lifetime in seconds, 30 days when omitted
+    ExpiresIn int64 `json:"expires_in"`
+}
+
+// createTokenResponse carries the token value, which is shown only once
+type createTokenResponse struct {
+    *domain.AccessToken
+    Token string `json:"token"`
+}
+
+type createServiceAccountRequest struct {
+    Name  string   `json:"name"`
+    Roles []string `json:"roles"`
+}
+
+// registerTokenRoutes adds the endpoints managing access tokens and service accounts.
+// They need a session token, so access tokens cannot be used to mint further tokens.
+func registerTokenRoutes(r *mux.Router) {
+    r.HandleFunc("/auth/tokens", withSession(createTokenHandler)).Methods("POST")
+    r.HandleFunc("/auth/tokens", withSession(listTokensHandler)).Methods("GET")
+    r.HandleFunc("/auth/tokens/{id}", withSession(revokeTokenHandler)).Methods("DELETE")
+
+    r.HandleFunc("/auth/service-accounts", withAdmin(createServiceAccountHandler)).Methods("POST")
+    r.HandleFunc("/auth/service-accounts", withAdmin(listServiceAccountsHandler)).Methods("GET")
+    r.HandleFunc("/auth/service-accounts/{id}/tokens", withAdmin(createServiceAccountTokenHandler)).Methods("POST")
+    r.HandleFunc("/auth/service-accounts/{id}/tokens", withAdmin(listServiceAccountTokensHandler)).Methods("GET")
+    r.HandleFunc("/auth/service-accounts/{id}/tokens/{tokenID}", withAdmin(revokeServiceAccountTokenHandler)).Methods("DELETE")
+}
+
+type sessionHandler func(w http.ResponseWriter, r *http.Request, claims *service.Claims)
+
+// withSession only runs the handler for requests carrying a valid session token
+func withSession(handler sessionHandler) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+        if !strings.EqualFold(scheme, "Bearer") || token == "" {
+            w.Header().Set("WWW-Authenticate", `Bearer realm="devops-ide"`)
+            writeError(w, http.StatusUnauthorized, "A bearer token is required")
+            return
+        }
+        if service.IsAccessToken(token) {
+            writeError(w, http.StatusForbidden, "Access tokens cannot manage tokens, log in instead")
+            return
+        }
+
+        claims, err := authService.VerifyAccessToken(token)
+        if err != nil {
+            w.Header().Set("WWW-Authenticate", `Bearer realm="devops-ide", error="invalid_token"`)
+            writeError(w, http.StatusUnauthorized, err.Error())
+            return
+        }
+        handler(w, r, claims)
+    }
+}
+
+// withAdmin only runs the handler for administrators
+func withAdmin(handler sessionHandler) http.HandlerFunc {
+    return withSession(func(w http.ResponseWriter, r *http.Request, claims *service.Claims) {
+        for _, role := range claims.Roles {
+            if role == "admin" {
+                handler(w, r, claims)
+                return
+            }
+        }
+        writeError(w, http.StatusForbidden, "Managing service accounts requires the admin role")
+    })
+}
+
+func createTokenHandler(w http.ResponseWriter, r *http.Request, claims *service.Claims) {
+    user, err := authService.GetUser(r.Context(), claims.UserID)
+    if err != nil {
+        writeError(w, http.StatusUnauthorized, service.ErrInvalidToken.Error())
+        return
+    }
+    issueToken(w, r, user)
+}
+
+func listTokensHandler(w http.ResponseWriter, r *http.Request, claims *service.Claims) {
+    listTokens(w, r, claims.UserID)
+}
+
+func revokeTokenHandler(w http.ResponseWriter, r *http.Request, claims *service.Claims) {
+    revokeToken(w, r, claims.UserID, mux.Vars(r)["id"])
+}
+
+func createServiceAccountHandler(w http.ResponseWriter, r *http.Request, claims *service.Claims) {
+    var req createServiceAccountRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, http.StatusBadRequest, "Invalid request body")
+        return
+    }
+
+    account, err := authService.CreateServiceAccount(r.Context(), req.Name, req.Roles)
+    switch {
+    case errors.Is(err, service.ErrServiceAccountName):
+        writeError(w, http.StatusBadRequest, err.Error())
+        return
+    case errors.Is(err, domain.ErrEmailTaken):
+        writeError(w, http.StatusConflict, "A service account with this name already exists")
+        return
+    case err != nil:
+        log.Printf("Creating service account failed: %v", err)
+        writeError(w, http.StatusInternalServerError, "Creating service account failed")
+        return
+    }
+
+    log.Printf("Service account %s created by %s with roles %v", account.Email, claims.Email, account.Roles)
+    writeJSON(w, http.StatusCreated, account)
+}
+
+func listServiceAccountsHandler(w http.ResponseWriter, r *http.Request, claims *service.Claims) {
+    accounts, err := authService.ListServiceAccounts(r.Context())
+    if err != nil {
+        log.Printf("Listing service accounts failed: %v", err)
+        writeError(w, http.StatusInternalServerError, "Listing service accounts failed")
+        return
+    }
+    writeJSON(w, http.StatusOK, accounts)
+}
+
+func createServiceAccountTokenHandler(w http.ResponseWriter, r *http.Request, claims *service.Claims) {
+    account, ok := serviceAccount(w, r)
+    if !ok {
+        return
+    }
+    issueToken(w, r, account)
+}
+
+func listServiceAccountTokensHandler(w http.ResponseWriter, r *http.Request, claims *service.Claims) {
+    if account, ok := serviceAccount(w, r); ok {
+        listTokens(w, r, account.ID)
+    }
+}
+
+func revokeServiceAccountTokenHandler(w http.ResponseWriter, r *http.Request, claims *service.Claims) {
+    if account, ok := serviceAccount(w, r); ok {
+        revokeToken(w, r, account.ID, mux.Vars(r)["tokenID"])
+    }
+}
+
+// serviceAccount loads the service account named by the {id} route variable
+func serviceAccount(w http.ResponseWriter, r *http.Request) (*domain.User, bool) {
+    account, err := authService.GetServiceAccount(r.Context(), mux.Vars(r)["id"])
+    if errors.Is(err, service.ErrNotServiceAccount) {
+        writeError(w, http.StatusNotFound, err.Error())
+        return nil, false
+    }
+    if err != nil {
+        log.Printf("Loading service account failed: %v", err)
+        writeError(w, http.StatusInternalServerError, "Loading service account failed")
+        return nil, false
+    }
+    return account, true
+}
+
+func issueToken(w http.ResponseWriter, r *http.Request, user *domain.User) {
+    var req createTokenRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, http.StatusBadRequest, "Invalid request body")
+        return
+    }
+
+    lifetime := time.Duration(req.ExpiresIn) * time.Second
+    if req.ExpiresIn < 0 || req.ExpiresIn > int64(service.MaxAccessTokenLifetime/time.Second) {
+        lifetime = -1
+    }
+
+    raw, token, err := authService.CreateAccessToken(r.Context(), user, req.Name, req.Scopes, lifetime)
+    switch {
+    case errors.Is(err, service.ErrInvalidName), errors.Is(err, service.ErrInvalidScope),
+        errors.Is(err, service.ErrInvalidLifetime):
+        writeError(w, http.StatusBadRequest, err.Error())
+        return
+    case err != nil:
+        log.Printf("Creating access token failed: %v", err)
+        writeError(w, http.StatusInternalServerError, "Creating access token failed")
+        return
+    }
+
+    writeJSON(w, http.StatusCreated, createTokenResponse{AccessToken: token, Token: raw})
+}
+
+func listTokens(w http.ResponseWriter, r *http.Request, userID string) {
+    tokens, err := authService.ListAccessTokens(r.Context(), userID)
+    if err != nil {
+        log.Printf("Listing access tokens failed: %v", err)
+        writeError(w, http.StatusInternalServerError, "Listing access tokens failed")
+        return
+    }
+    writeJSON(w, http.StatusOK, tokens)
+}
+
+func revokeToken(w http.ResponseWriter, r *http.Request, userID, id string) {
+    err := authService.RevokeAccessToken(r.Context(), userID, id)
+    if errors.Is(err, domain.ErrTokenNotFound) {
+        writeError(w, http.StatusNotFound, err.Error())
+        return
+    }
+    if err != nil {
+        log.Printf("Revoking access token failed: %v", err)
+        writeError(w, http.StatusInternalServerError, "Revoking access token failed")
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
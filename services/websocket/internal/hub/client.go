@@ -1,9 +1,22 @@
 package hub
 
 import (
+    "time"
+
     "github.com/gorilla/websocket"
 )
 
+const (
+    // writeWait bounds the time to write a message to the client
+    writeWait = 10 * time.Second
+    // pongWait is how long a client may stay silent, including pongs, before it is dropped
+    pongWait = 60 * time.Second
+    // pingPeriod must be shorter than pongWait
+    pingPeriod = pongWait * 9 / 10
+    // maxMessageSize bounds inbound frames, which are control messages only
+    maxMessageSize = 512
+)
+
 type Client struct {
     hub  *Hub
     conn *websocket.Conn
@@ -18,27 +31,39 @@ func NewClient(hub *Hub, conn *websocket.Conn) *Client {
     }
 }
 
+// ReadPump keeps the connection alive and detects when it closes. Events only flow from
+// the server to clients, so inbound messages are discarded and never broadcast.
 func (c *Client) ReadPump() {
     defer func() {
         c.hub.unregister <- c
         c.conn.Close()
     }()
 
+    c.conn.SetReadLimit(maxMessageSize)
+    c.conn.SetReadDeadline(time.Now().Add(pongWait))
+    c.conn.SetPongHandler(func(string) error {
+        return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+    })
+
     for {
-        _, message, err := c.conn.ReadMessage()
-        if err != nil {
+        if _, _, err := c.conn.ReadMessage(); err != nil {
             break
         }
-        c.hub.broadcast <- message
+        c.conn.SetReadDeadline(time.Now().Add(pongWait))
     }
 }
 
 func (c *Client) WritePump() {
-    defer c.conn.Close()
+    ticker := time.NewTicker(pingPeriod)
+    defer func() {
+        ticker.Stop()
+        c.conn.Close()
+    }()
 
     for {
         select {
         case message, ok := <-c.send:
+            c.conn.SetWriteDeadline(time.Now().Add(writeWait))
             if !ok {
                 c.conn.WriteMessage(websocket.CloseMessage, []byte{})
                 return
@@ -47,6 +72,11 @@ func (c *Client) WritePump() {
             if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
                 return
             }
+        case <-ticker.C:
+            c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+            if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+                return
+            }
         }
     }
 }
\ No newline at end of file
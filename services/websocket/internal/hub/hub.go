@@ -21,6 +21,16 @@ func NewHub() *Hub {
     }
 }
 
+// Register adds a client to the hub so it receives broadcasts
+func (h *Hub) Register(client *Client) {
+    h.register <- client
+}
+
+// Broadcast sends a message to every connected client
+func (h *Hub) Broadcast(message []byte) {
+    h.broadcast <- message
+}
+
 func (h *Hub) Run() {
     for {
         select {
@@ -0,0 +1,190 @@
+package webhook
+
+import (
+    "encoding/json"
+    "fmt"
+    "strings"
+    "time"
+)
+
+// Event is the normalized form of a CI/CD notification pushed to dashboards
+type Event struct {
+    ID         string    `json:"id,omitempty"`
+    Source     string    `json:"source"`
+    Type       string    `json:"type"`
+    Action     string    `json:"action,omitempty"`
+    Repository string    `json:"repository,omitempty"`
+    Branch     string    `json:"branch,omitempty"`
+    SHA        string    `json:"sha,omitempty"`
+    Number     int       `json:"number,omitempty"`
+    Name       string    `json:"name,omitempty"`
+    Status     string    `json:"status,omitempty"`
+    Conclusion string    `json:"conclusion,omitempty"`
+    URL        string    `json:"url,omitempty"`
+    Actor      string    `json:"actor,omitempty"`
+    Timestamp  time.Time `json:"timestamp"`
+}
+
+// Message is the envelope broadcast to websocket clients
+type Message struct {
+    Type      string    `json:"type"`
+    Payload   *Event    `json:"payload"`
+    Timestamp time.Time `json:"timestamp"`
+}
+
+// githubPayload holds the fields shared by the GitHub events we normalize
+type githubPayload struct {
+    Action     string `json:"action"`
+    Number     int    `json:"number"`
+    Ref        string `json:"ref"`
+    After      string `json:"after"`
+    Compare    string `json:"compare"`
+    Repository struct {
+        FullName string `json:"full_name"`
+    } `json:"repository"`
+    Sender struct {
+        Login string `json:"login"`
+    } `json:"sender"`
+    WorkflowRun struct {
+        Name       string `json:"name"`
+        Status     string `json:"status"`
+        Conclusion string `json:"conclusion"`
+        HeadBranch string `json:"head_branch"`
+        HeadSHA    string `json:"head_sha"`
+        HTMLURL    string `json:"html_url"`
+        RunNumber  int    `json:"run_number"`
+    } `json:"workflow_run"`
+    CheckRun struct {
+        Name       string `json:"name"`
+        Status     string `json:"status"`
+        Conclusion string `json:"conclusion"`
+        HeadSHA    string `json:"head_sha"`
+        HTMLURL    string `json:"html_url"`
+        CheckSuite struct {
+            HeadBranch string `json:"head_branch"`
+        } `json:"check_suite"`
+    } `json:"check_run"`
+    PullRequest struct {
+        Title   string `json:"title"`
+        State   string `json:"state"`
+        Merged  bool   `json:"merged"`
+        HTMLURL string `json:"html_url"`
+        Head    struct {
+            Ref string `json:"ref"`
+            SHA string `json:"sha"`
+        } `json:"head"`
+    } `json:"pull_request"`
+}
+
+// jenkinsPayload is the body sent by the Jenkins Notification plugin
+type jenkinsPayload struct {
+    Name  string `json:"name"`
+    URL   string `json:"url"`
+    Build struct {
+        FullURL string `json:"full_url"`
+        Number  int    `json:"number"`
+        Phase   string `json:"phase"`
+        Status  string `json:"status"`
+        SCM     struct {
+            URL    string `json:"url"`
+            Branch string `json:"branch"`
+            Commit string `json:"commit"`
+        } `json:"scm"`
+    } `json:"build"`
+}
+
+// NormalizeGitHub converts a GitHub webhook delivery into an Event. It returns
+// nil without error for event types that are not forwarded to dashboards.
+func NormalizeGitHub(eventType, deliveryID string, body []byte) (*Event, error) {
+    var payload githubPayload
+    if err := json.Unmarshal(body, &payload); err != nil {
+        return nil, fmt.Errorf("invalid GitHub payload: %v", err)
+    }
+
+    event := &Event{
+        ID:         deliveryID,
+        Source:     "github",
+        Type:       eventType,
+        Action:     payload.Action,
+        Repository: payload.Repository.FullName,
+        Actor:      payload.Sender.Login,
+        Timestamp:  time.Now().UTC(),
+    }
+
+    switch eventType {
+    case "workflow_run":
+        run := payload.WorkflowRun
+        event.Name = run.Name
+        event.Status = run.Status
+        event.Conclusion = run.Conclusion
+        event.Branch = run.HeadBranch
+        event.SHA = run.HeadSHA
+        event.URL = run.HTMLURL
+        event.Number = run.RunNumber
+    case "check_run":
+        check := payload.CheckRun
+        event.Name = check.Name
+        event.Status = check.Status
+        event.Conclusion = check.Conclusion
+        event.Branch = check.CheckSuite.HeadBranch
+        event.SHA = check.HeadSHA
+        event.URL = check.HTMLURL
+    case "push":
+        event.Branch = strings.TrimPrefix(payload.Ref, "refs/heads/")
+        event.SHA = payload.After
+        event.URL = payload.Compare
+    case "pull_request":
+        pull := payload.PullRequest
+        event.Number = payload.Number
+        event.Name = pull.Title
+        event.Status = pull.State
+        if pull.Merged {
+            event.Conclusion = "merged"
+        }
+        event.Branch = pull.Head.Ref
+        event.SHA = pull.Head.SHA
+        event.URL = pull.HTMLURL
+    default:
+        return nil, nil
+    }
+
+    return event, nil
+}
+
+// NormalizeJenkins converts a Jenkins Notification plugin payload into an Event
+func NormalizeJenkins(body []byte) (*Event, error) {
+    var payload jenkinsPayload
+    if err := json.Unmarshal(body, &payload); err != nil {
+        return nil, fmt.Errorf("invalid Jenkins payload: %v", err)
+    }
+
+    if payload.Name == "" || payload.Build.Phase == "" {
+        return nil, fmt.Errorf("invalid Jenkins payload: missing job name or build phase")
+    }
+
+    event := &Event{
+        Source:     "jenkins",
+        Type:       "build",
+        Action:     strings.ToLower(payload.Build.Phase),
+        Repository: payload.Build.SCM.URL,
+        Branch:     strings.TrimPrefix(payload.Build.SCM.Branch, "origin/"),
+        SHA:        payload.Build.SCM.Commit,
+        Number:     payload.Build.Number,
+        Name:       payload.Name,
+        URL:        payload.Build.FullURL,
+        Timestamp:  time.Now().UTC(),
+    }
+
+    // Map Jenkins phases onto the GitHub style status/conclusion pair
+    switch payload.Build.Phase {
+    case "QUEUED":
+        event.Status = "queued"
+    case "STARTED":
+        event.Status = "in_progress"
+    default:
+        event.Status = "completed"
+        event.Conclusion = strings.ToLower(payload.Build.Status)
+    }
+
+    return event, nil
+}
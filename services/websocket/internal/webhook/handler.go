@@ -0,0 +1,152 @@
+package webhook
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/hex"
+    "encoding/json"
+    "io"
+    "log"
+    "net/http"
+    "strings"
+    "time"
+)
+
+// maxPayloadSize matches the 25 MB cap GitHub applies to webhook deliveries
+const maxPayloadSize = 25 << 20
+
+// Handler verifies inbound webhooks and publishes them as normalized events
+type Handler struct {
+    githubSecret []byte
+    jenkinsToken string
+    publish      func(message []byte)
+}
+
+// NewHandler creates a webhook handler. githubSecret is the secret configured on
+// the GitHub webhook, jenkinsToken the shared token expected from Jenkins, and
+// publish receives every encoded event message.
+func NewHandler(githubSecret, jenkinsToken string, publish func(message []byte)) *Handler {
+    return &Handler{
+        githubSecret: []byte(githubSecret),
+        jenkinsToken: jenkinsToken,
+        publish:      publish,
+    }
+}
+
+// GitHub handles deliveries signed with X-Hub-Signature-256
+func (h *Handler) GitHub(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    if len(h.githubSecret) == 0 {
+        http.Error(w, "GitHub webhook secret not configured", http.StatusServiceUnavailable)
+        return
+    }
+
+    body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+    if err != nil {
+        http.Error(w, "Failed to read payload", http.StatusBadRequest)
+        return
+    }
+
+    if !h.validGitHubSignature(r.Header.Get("X-Hub-Signature-256"), body) {
+        http.Error(w, "Invalid signature", http.StatusUnauthorized)
+        return
+    }
+
+    eventType := r.Header.Get("X-GitHub-Event")
+    if eventType == "ping" {
+        w.WriteHeader(http.StatusOK)
+        return
+    }
+
+    event, err := NormalizeGitHub(eventType, r.Header.Get("X-GitHub-Delivery"), body)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    if event == nil {
+        // Valid delivery for an event type dashboards do not track
+        w.WriteHeader(http.StatusAccepted)
+        return
+    }
+
+    h.dispatch(w, event)
+}
+
+// Jenkins handles Notification plugin deliveries authenticated with a shared token
+func (h *Handler) Jenkins(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    if h.jenkinsToken == "" {
+        http.Error(w, "Jenkins webhook token not configured", http.StatusServiceUnavailable)
+        return
+    }
+
+    // The Notification plugin cannot sign payloads, so the token travels in a header or the URL
+    token := r.Header.Get("X-Jenkins-Token")
+    if token == "" {
+        token = r.URL.Query().Get("token")
+    }
+    if subtle.ConstantTimeCompare([]byte(token), []byte(h.jenkinsToken)) != 1 {
+        http.Error(w, "Invalid token", http.StatusUnauthorized)
+        return
+    }
+
+    body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+    if err != nil {
+        http.Error(w, "Failed to read payload", http.StatusBadRequest)
+        return
+    }
+
+    event, err := NormalizeJenkins(body)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    h.dispatch(w, event)
+}
+
+// dispatch wraps the event in a websocket message and publishes it
+func (h *Handler) dispatch(w http.ResponseWriter, event *Event) {
+    message, err := json.Marshal(Message{
+        Type:      "devops_event",
+        Payload:   event,
+        Timestamp: time.Now().UTC(),
+    })
+    if err != nil {
+        http.Error(w, "Failed to encode event", http.StatusInternalServerError)
+        return
+    }
+
+    h.publish(message)
+    log.Printf("Webhook event published: source=%s type=%s action=%s repo=%s",
+        event.Source, event.Type, event.Action, event.Repository)
+
+    w.WriteHeader(http.StatusAccepted)
+}
+
+// validGitHubSignature checks the sha256 HMAC GitHub computes over the raw body
+func (h *Handler) validGitHubSignature(header string, body []byte) bool {
+    signature, ok := strings.CutPrefix(header, "sha256=")
+    if !ok {
+        return false
+    }
+
+    expected, err := hex.DecodeString(signature)
+    if err != nil {
+        return false
+    }
+
+    mac := hmac.New(sha256.New, h.githubSecret)
+    mac.Write(body)
+    return hmac.Equal(mac.Sum(nil), expected)
+}
@@ -1,8 +1,16 @@
 package main
 
 import (
+    "fmt"
     "log"
     "net/http"
+    "os"
+    "strings"
+    "time"
+
+    "devops-ide/pkg/authtoken"
+    "devops-ide/services/websocket/internal/hub"
+    "devops-ide/services/websocket/internal/webhook"
 
     "github.com/gorilla/websocket"
 )
@@ -10,37 +18,106 @@ import (
 var upgrader = websocket.Upgrader{
     ReadBufferSize:  1024,
     WriteBufferSize: 1024,
-    CheckOrigin: func(r *http.Request) bool {
-        return true // In production, implement proper origin checking
-    },
+    CheckOrigin:     checkOrigin,
 }
 
+var eventHub = hub.NewHub()
+
+// allowedOrigins lists the browser origins allowed to open a connection
+var allowedOrigins []string
+
+var verifier *authtoken.Verifier
+
 func main() {
+    allowedOrigins = strings.Split(getEnv("WS_ALLOWED_ORIGINS", "http://localhost:5173"), ",")
+    verifier = newTokenVerifier()
+
+    go eventHub.Run()
+
+    // Webhooks are normalized into events and fanned out to dashboard clients
+    webhooks := webhook.NewHandler(
+        os.Getenv("GITHUB_WEBHOOK_SECRET"),
+        os.Getenv("JENKINS_WEBHOOK_TOKEN"),
+        eventHub.Broadcast,
+    )
+
     http.HandleFunc("/ws", handleWebSocket)
+    http.HandleFunc("/webhooks/github", webhooks.GitHub)
+    http.HandleFunc("/webhooks/jenkins", webhooks.Jenkins)
     log.Fatal(http.ListenAndServe(":8086", nil))
 }
 
 func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+    // Connections are authenticated before the upgrade, the gateway passes the token on
+    // as a bearer header while direct connections may use ?access_token=
+    token, err := authtoken.BearerToken(r.Header.Get("Authorization"))
+    if err == nil && token == "" {
+        token = r.URL.Query().Get("access_token")
+    }
+    if err != nil || token == "" {
+        w.Header().Set("WWW-Authenticate", `Bearer realm="devops-ide"`)
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+    if _, err := verifier.Verify(r.Context(), token); err != nil {
+        w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="devops-ide", error="invalid_token", error_description=%q`,
+            strings.ReplaceAll(err.Error(), `"`, `'`)))
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
     conn, err := upgrader.Upgrade(w, r, nil)
     if err != nil {
         log.Printf("WebSocket upgrade failed: %v", err)
         return
     }
-    defer conn.Close()
 
-    // Handle WebSocket connection
-    for {
-        messageType, message, err := conn.ReadMessage()
-        if err != nil {
-            log.Printf("Error reading message: %v", err)
-            break
+    // The client owns the connection from here and closes it when either pump exits
+    client := hub.NewClient(eventHub, conn)
+    eventHub.Register(client)
+
+    go client.WritePump()
+    client.ReadPump()
+}
+
+// checkOrigin accepts non-browser clients and the origins in WS_ALLOWED_ORIGINS
+func checkOrigin(r *http.Request) bool {
+    origin := r.Header.Get("Origin")
+    if origin == "" {
+        return true
+    }
+
+    for _, allowed := range allowedOrigins {
+        if strings.TrimSpace(allowed) == origin {
+            return true
         }
-        
-        // Handle different message types
-        handleMessage(conn, messageType, message)
     }
+    return false
+}
+
+// newTokenVerifier checks session tokens against the auth service signing keys and access
+// tokens against its verify endpoint. AUTH_DEV_HMAC_SECRET additionally accepts HS256
+// tokens and must only be set in local development.
+func newTokenVerifier() *authtoken.Verifier {
+    config := authtoken.Config{
+        Issuer:           getEnv("AUTH_ISSUER", "devops-ide-auth"),
+        Audience:         getEnv("AUTH_AUDIENCE", "devops-ide"),
+        JWKSURL:          getEnv("AUTH_JWKS_URL", "http://auth-service:8081/.well-known/jwks.json"),
+        IntrospectionURL: getEnv("AUTH_VERIFY_URL", "http://auth-service:8081/auth/verify"),
+        Leeway:           30 * time.Second,
+    }
+
+    if secret := os.Getenv("AUTH_DEV_HMAC_SECRET"); secret != "" {
+        log.Printf("WARNING: accepting HS256 tokens signed with AUTH_DEV_HMAC_SECRET, do not use in production")
+        config.HMACSecret = []byte(secret)
+    }
+
+    return authtoken.NewVerifier(config)
 }
 
-func handleMessage(conn *websocket.Conn, messageType int, message []byte) {
-    // Implement message handling logic
+func getEnv(key, defaultValue string) string {
+    if value := os.Getenv(key); value != "" {
+        return value
+    }
+    return defaultValue
 }
\ No newline at end of file